@@ -0,0 +1,34 @@
+{Exercises every statement in the Pascal subset}
+PROGRAM Sample3;
+	DECLARE
+		INTEGER n, i, total;
+		REAL average;
+
+	PROCEDURE Fact PARAMETERS INTEGER k;
+		DECLARE INTEGER product;
+	BEGIN
+		SET product = 1;
+		WHILE k > 1 DO
+			SET product = product * k;
+			SET k = k - 1
+		ENDWHILE;
+		WRITE product
+	END;
+
+	BEGIN
+		READ n;
+		SET i = 0;
+		SET total = 0;
+		UNTIL i = n DO
+			SET i = i + 1;
+			SET total = total + i
+		ENDUNTIL;
+		WRITE n, total;
+		IF n > 0 THEN
+			SET average = total / n;
+			WRITE average
+		ELSE
+			WRITE 0
+		ENDIF;
+		CALL Fact(n)
+	END.
@@ -1,42 +1,1065 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"flag"
 	"fmt"
+	"html"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 
+	"github.com/kdgwill/golang_dev/JAPC_WIG/diagnostics"
+	"github.com/kdgwill/golang_dev/JAPC_WIG/lsp"
 	"github.com/kdgwill/golang_dev/JAPC_WIG/pascomp"
 )
 
+//	compiler COMMAND [flags] FILE
+//	compiler check|lint|build|fmt [flags] FILE|DIRECTORY ...
+//
+//	tokens		list the tokens of FILE.pas with their classes and
+//				positions as text, JSON lines, CSV or a table
+//	highlight	color FILE.pas by what each token is for a terminal, or
+//				as HTML with a CSS class on each token
+//	symbols		parse FILE.pas and dump its symbol table
+//	parse		parse FILE.pas and print its syntax tree
+//	check		parse FILE.pas and report its errors and warnings
+//	lint		check FILE.pas for unused, hidden and over long names,
+//				empty procedures, constant conditions and magic numbers
+//	fmt			lay FILE.pas out canonically, printing it, its diff
+//				from the file with -d or writing it back with -w
+//	build		translate FILE.pas for a target, bytecode by default
+//	run			execute FILE.pas, or FILE.jbc on the virtual machine
+//	disasm		list the bytecode for FILE.pas or FILE.jbc
+//	lsp			serve the Language Server Protocol on standard input
+//				and output for an editor
+//	repl		read declarations, statements and expressions one at a
+//				time and run each at once
+//
+//	A FILE of - reads the program from standard input; run then needs
+//	-input for the program's own input.  Every command but check,
+//	lint, fmt, lsp and repl takes -o to write its output to a file instead of
+//	standard output; build writes bytecode next to the source file
+//	unless -o is given.
+//	The exit status is 0 on success, 1 if the program has an error,
+//	fails when it runs or cannot be read or written, and 2 if the
+//	command line is wrong.
+//
+//	check, lint, build and fmt take any number of files and directories,
+//	which stand for every .pas file under them, and work on up to -j
+//	files at once, each with its own scanner and symbol table.  What
+//	each file reports is printed in the order the files were named and
+//	a directory's files in lexical order.  When build has more than one
+//	file, each output goes next to its source with an extension for
+//	the target, such as .jbc, .asm or .ll.  fmt -l lists the files
+//	whose layout would change.  The -listing flag of check and build
+//	writes FILE.lst with the numbered source, its errors and warnings
+//	marked under the columns they point at, and the symbol table.
+//
+//	Errors and warnings are shown with the lines of source they are
+//	about, carets under the token each points at, any notes and
+//	suggested fixes, and a code such as E004 naming their kind.  Every
+//	command but lsp takes -color auto, always or never; auto colors
+//	them when standard error is a terminal and NO_COLOR is not set.
+//	check, lint and build also take -sarif FILE to write every file's
+//	diagnostics as a SARIF 2.1.0 log for code scanning.
+//
+//	lint reads which rules to check from the JSON file -config names,
+//	or .japclint.json in the current directory if there is one, and
+//	exits with status 1 if it reports anything.  A {lint:ignore}
+//	comment silences it for a line.
+//
+//	The older forms, such as compiler -asm64 FileName.pas or
+//	compiler -O -ir FileName.pas, still work.
+
+// The exit statuses
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command is one of the compiler's subcommands
+type command struct {
+	name, summary string
+	run           func(flags *flag.FlagSet, args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"tokens", "list the tokens of a program", tokensCommand},
+		{"highlight", "color a program for a terminal or a web page", highlightCommand},
+		{"symbols", "dump the symbol table of a program", symbolsCommand},
+		{"parse", "print the syntax tree of a program", parseCommand},
+		{"check", "report a program's errors and warnings", checkCommand},
+		{"lint", "check a program's style", lintCommand},
+		{"fmt", "lay a program out canonically", fmtCommand},
+		{"build", "translate a program for a target", buildCommand},
+		{"run", "execute a program or bytecode file", runCommand},
+		{"disasm", "list the bytecode for a program", disasmCommand},
+		{"lsp", "serve the Language Server Protocol over stdio", lspCommand},
+		{"repl", "run declarations and statements as they are typed", replCommand},
+	}
+}
+
+// The targets build can write and the older flags naming them
+var targets = []string{"bytecode", "ir", "cfg", "ssa", "x86-16", "x86-32", "x86-64",
+	"llvm", "c", "wat", "go"}
+
+var legacyTargets = map[string]string{"-ir": "ir", "-cfg": "cfg", "-ssa": "ssa",
+	"-asm": "x86-16", "-asm32": "x86-32", "-asm64": "x86-64", "-llvm": "llvm",
+	"-c": "c", "-wat": "wat", "-go": "go"}
+
 func main() {
-	//Get Arguments from command line
-	//TODO: Use flags isntead of bare arguments
-	//args := os.Args
-	//if len(arg) != 2 {
-	//	log.Fatal("Usage: ", filepath.Base(arg[0]), " FileName.pas")
-	//}
-	//EXT := "pas"
-	//fileExtension := string(filepath.Ext(arg[0]))
-	//fmt.Println(fileExtension)
-	//if strings.EqualFold(fileExtension, EXT) == false {
-	//	log.Fatal("Extension must be ", EXT)
-	//}
-	var scanner pascomp.Scanner //Since their is nill arguments can do C++ style init
-	//would use scanner:= new(Scanner) to allocate memory for fields set all members to respective zero and return a pointer
-	defer scanner.DeinitScanner() //Kind of a hack to mimic destructors
-	scanner.NewScanner()          //no constructor so do this way
-	var x = 0
+	log.SetFlags(0)
+	args := legacy(os.Args[1:])
+	if len(args) == 0 {
+		usage(os.Stderr)
+		os.Exit(exitUsage)
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(os.Stdout)
+		return
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			flags := flag.NewFlagSet(c.name, flag.ContinueOnError)
+			os.Exit(c.run(flags, args[1:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s: unknown command %q\n", program(), args[0])
+	usage(os.Stderr)
+	os.Exit(exitUsage)
+}
+
+// legacy() -	Rewrite the older command lines, compile FILE, -disasm
+//				FILE and [-O] -TARGET FILE, as subcommands
+func legacy(args []string) []string {
+	var opt []string
+	if len(args) == 3 && args[0] == "-O" {
+		opt, args = []string{"-O"}, args[1:]
+	}
+	if len(args) != 2 {
+		return append(opt, args...)
+	}
+	switch args[0] {
+	case "compile":
+		return []string{"build", args[1]}
+	case "-disasm":
+		return []string{"disasm", args[1]}
+	}
+	if target, ok := legacyTargets[args[0]]; ok {
+		return append(append([]string{"build", "-target", target}, opt...), args[1])
+	}
+	return append(opt, args...)
+}
+
+func program() string {
+	return filepath.Base(os.Args[0])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: %s command [flags] file.pas\n\ncommands:\n", program())
+	//The summaries line up after the longest command's name
+	width := 0
+	for _, c := range commands {
+		if len(c.name) > width {
+			width = len(c.name)
+		}
+	}
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nA file of - reads standard input.  Run %s command -h for its flags.\n", program())
+}
+
+// parseFlags() -	Parse a command's flags, leaving the single file it
+//					works on; reports a usage error as an exit status
+func parseFlags(flags *flag.FlagSet, args []string) (string, int) {
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s %s [flags] file\n", program(), flags.Name())
+		flags.PrintDefaults()
+	}
+	if status := parseCommon(flags, args); status >= 0 {
+		return "", status
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return "", exitUsage
+	}
+	return flags.Arg(0), -1
+}
+
+// parseCommon() -	Parse a command's flags along with -color, which
+//					every command takes; reports a usage error or
+//					-help as an exit status
+func parseCommon(flags *flag.FlagSet, args []string) int {
+	color := flags.String("color", "auto", "color diagnostics: auto, always or never")
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	switch *color {
+	case "auto":
+		renderer.Color = diagnostics.IsTerminal(os.Stderr)
+	case "always":
+		renderer.Color = true
+	case "never":
+		renderer.Color = false
+	default:
+		fmt.Fprintf(os.Stderr, "%s: unknown -color %q; use auto, always or never\n", program(), *color)
+		return exitUsage
+	}
+	return -1
+}
+
+// redirect() -	Send standard output to the file named by -o, if
+//				any.  The returned function closes it.
+func redirect(path string) func() {
+	if path == "" || path == "-" {
+		return func() {}
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = out
+	return func() {
+		os.Stdout = stdout
+		if err := out.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Commands
+////////////////////////////////////////////////////////////////////
+
+func tokensCommand(flags *flag.FlagSet, args []string) int {
+	out := flags.String("o", "", "write the tokens to `file`")
+	format := flags.String("format", "text", "write the tokens as `format`: "+strings.Join(pascomp.TokenFormats, ", "))
+	filename, status := parseFlags(flags, args)
+	if status >= 0 {
+		return status
+	}
+	known := false
+	for _, f := range pascomp.TokenFormats {
+		known = known || f == *format
+	}
+	if !known {
+		fmt.Fprintf(os.Stderr, "%s: unknown format %q; use one of %s\n", program(), *format, strings.Join(pascomp.TokenFormats, ", "))
+		return exitUsage
+	}
+
+	j := &job{filename: filename}
+	if err := j.read(); err != nil {
+		log.Fatal(err)
+	}
+	var scanner pascomp.Scanner
+	scanner.NewScannerReader(bytes.NewReader(j.source))
+	tokens, serr := scanner.ScanAll()
+
+	restore := redirect(*out)
+	err := pascomp.WriteTokens(os.Stdout, scanner.St, tokens, *format)
+	restore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if serr != nil {
+		j.fail(serr)
+		j.exit()
+	}
+	return exitOK
+}
+
+func highlightCommand(flags *flag.FlagSet, args []string) int {
+	out := flags.String("o", "", "write the highlighted program to `file`")
+	format := flags.String("format", "ansi", "write the program as `format`: "+strings.Join(pascomp.HighlightFormats, ", "))
+	page := flags.Bool("page", false, "write a whole HTML page with the stylesheet")
+	filename, status := parseFlags(flags, args)
+	if status >= 0 {
+		return status
+	}
+	known := false
+	for _, f := range pascomp.HighlightFormats {
+		known = known || f == *format
+	}
+	if !known {
+		fmt.Fprintf(os.Stderr, "%s: unknown format %q; use one of %s\n", program(), *format, strings.Join(pascomp.HighlightFormats, ", "))
+		return exitUsage
+	}
+
+	j := &job{filename: filename}
+	if err := j.read(); err != nil {
+		log.Fatal(err)
+	}
+	fragments := pascomp.Highlight(j.source)
+
+	defer redirect(*out)()
+	if *page && *format == "html" {
+		fmt.Printf("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s</style>\n</head>\n<body>\n",
+			html.EscapeString(filepath.Base(j.src().Name)), pascomp.HighlightCSS)
+		defer fmt.Print("</body>\n</html>\n")
+	}
+	if err := pascomp.WriteHighlight(os.Stdout, fragments, *format); err != nil {
+		log.Fatal(err)
+	}
+	return exitOK
+}
+
+func symbolsCommand(flags *flag.FlagSet, args []string) int {
+	out := flags.String("o", "", "write the symbol table to `file`")
+	filename, status := parseFlags(flags, args)
+	if status >= 0 {
+		return status
+	}
+	prog := parse(filename)
+	defer redirect(*out)()
+	pascomp.DumpSymbolTable(prog.St)
+	return exitOK
+}
+
+func parseCommand(flags *flag.FlagSet, args []string) int {
+	out := flags.String("o", "", "write the tree to `file`")
+	filename, status := parseFlags(flags, args)
+	if status >= 0 {
+		return status
+	}
+	prog := parse(filename)
+	defer redirect(*out)()
+	if err := prog.Dump(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	return exitOK
+}
+
+func checkCommand(flags *flag.FlagSet, args []string) int {
+	werror := flags.Bool("Werror", false, "treat warnings as errors")
+	jobs := flags.Int("j", runtime.NumCPU(), "check up to `n` files at once")
+	listing := flags.Bool("listing", false, "write a listing of each file to FILE.lst")
+	files, status := parseFiles(flags, args)
+	if status >= 0 {
+		return status
+	}
+	return each(files, *jobs, func(j *job) {
+		if *listing {
+			defer j.list()
+		}
+		prog, err := j.parse()
+		if err != nil {
+			j.fail(err)
+			return
+		}
+		if j.check(pascomp.GenerateIR(prog)) > 0 && *werror {
+			j.failed = true
+		}
+	})
+}
+
+// The lint configuration read when -config is not given, if it exists
+const lintConfigFile = ".japclint.json"
+
+func lintCommand(flags *flag.FlagSet, args []string) int {
+	configPath := flags.String("config", "", "read the rules to check from `file` (default "+lintConfigFile+")")
+	jobs := flags.Int("j", runtime.NumCPU(), "lint up to `n` files at once")
+	files, status := parseFiles(flags, args)
+	if status >= 0 {
+		return status
+	}
+	config, err := lintConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", program(), err)
+		return exitError
+	}
+
+	return each(files, *jobs, func(j *job) {
+		if err := j.read(); err != nil {
+			j.fail(err)
+			return
+		}
+		warnings, err := pascomp.Lint(j.source, config)
+		if err != nil {
+			j.fail(err)
+			return
+		}
+		for _, w := range warnings {
+			j.diagnose(w.Diagnostic())
+		}
+		if len(warnings) > 0 {
+			j.failed = true
+		}
+	})
+}
+
+// lintConfig() -	Read the lint configuration from a file, or from
+//					lintConfigFile if there is one when none is named
+func lintConfig(path string) (pascomp.LintConfig, error) {
+	if path == "" {
+		if _, err := os.Stat(lintConfigFile); err != nil {
+			return pascomp.DefaultLintConfig(), nil
+		}
+		path = lintConfigFile
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return pascomp.LintConfig{}, err
+	}
+	defer in.Close()
+	config, err := pascomp.ReadLintConfig(in)
+	if err != nil {
+		return config, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+func fmtCommand(flags *flag.FlagSet, args []string) int {
+	write := flags.Bool("w", false, "write the result back to each file instead of to standard output")
+	diff := flags.Bool("d", false, "print the changes formatting makes as a unified diff")
+	list := flags.Bool("l", false, "list the files whose formatting differs")
+	keywords := flags.String("case", "upper", "write keywords in `case`: upper or lower")
+	jobs := flags.Int("j", runtime.NumCPU(), "format up to `n` files at once")
+	files, status := parseFiles(flags, args)
+	if status >= 0 {
+		return status
+	}
+	if *keywords != "upper" && *keywords != "lower" {
+		fmt.Fprintf(os.Stderr, "%s: unknown -case %q; use upper or lower\n", program(), *keywords)
+		return exitUsage
+	}
+	opts := pascomp.FormatOptions{LowerKeywords: *keywords == "lower"}
+
+	return each(files, *jobs, func(j *job) {
+		if err := j.read(); err != nil {
+			j.fail(err)
+			return
+		}
+		formatted, err := pascomp.Format(j.source, opts)
+		if err != nil {
+			j.fail(err)
+			return
+		}
+		changed := !bytes.Equal(j.source, formatted)
+		if *list && changed {
+			fmt.Fprintln(&j.out, j.src().Name)
+		}
+		if *diff {
+			name := j.src().Name
+			if err := writeDiff(&j.out, name+".orig", name, j.source, formatted); err != nil {
+				j.fail(err)
+				return
+			}
+		}
+		if *write && changed && j.filename != "-" {
+			info, err := os.Stat(j.filename)
+			if err == nil {
+				err = os.WriteFile(j.filename, formatted, info.Mode().Perm())
+			}
+			if err != nil {
+				j.fail(err)
+			}
+		}
+		if !*write && !*diff && !*list {
+			j.out.Write(formatted)
+		}
+	})
+}
+
+// The file extension build gives each target's output
+var targetExts = map[string]string{"bytecode": bytecodeExt, "ir": ".ir", "cfg": ".dot",
+	"ssa": ".ssa", "x86-16": ".asm", "x86-32": ".asm", "x86-64": ".asm", "llvm": ".ll",
+	"c": ".c", "wat": ".wat", "go": ".go"}
+
+// The targets made from the intermediate code, the only ones -O changes
+var irTargets = []string{"ir", "cfg", "ssa", "x86-16", "x86-32", "x86-64", "llvm"}
+
+func buildCommand(flags *flag.FlagSet, args []string) int {
+	target := flags.String("target", "bytecode", "the `target` to build: "+strings.Join(targets, ", "))
+	out := flags.String("o", "", "write the output to `file`")
+	jobs := flags.Int("j", runtime.NumCPU(), "build up to `n` files at once")
+	listing := flags.Bool("listing", false, "write a listing of each file to FILE.lst")
+	flags.BoolVar(&optimize, "O", false, "optimize the intermediate code of the "+strings.Join(irTargets, ", ")+" targets")
+	files, status := parseFiles(flags, args)
+	if status >= 0 {
+		return status
+	}
+	if _, ok := targetExts[*target]; !ok {
+		fmt.Fprintf(os.Stderr, "%s: unknown target %q; use one of %s\n", program(), *target, strings.Join(targets, ", "))
+		return exitUsage
+	}
+	optimizable := false
+	for _, t := range irTargets {
+		optimizable = optimizable || t == *target
+	}
+	if optimize && !optimizable {
+		fmt.Fprintf(os.Stderr, "%s: -O does not apply to the %s target; use it with %s\n",
+			program(), *target, strings.Join(irTargets, ", "))
+		return exitUsage
+	}
+	if *out != "" && len(files) > 1 {
+		fmt.Fprintf(os.Stderr, "%s: -o needs a single file\n", program())
+		return exitUsage
+	}
+
+	return each(files, *jobs, func(j *job) {
+		if *listing {
+			defer j.list()
+		}
+		//A lone text file goes to standard output; anything else
+		//goes next to its source
+		path := *out
+		if path == "" && j.filename != "-" && (len(files) > 1 || *target == "bytecode") {
+			path = strings.TrimSuffix(j.filename, filepath.Ext(j.filename)) + targetExts[*target]
+		}
+		if path == "" || path == "-" {
+			if err := j.build(*target, os.Stdout); err != nil {
+				j.fail(err)
+			}
+			return
+		}
+		w, err := os.Create(path)
+		if err != nil {
+			j.fail(err)
+			return
+		}
+		err = j.build(*target, w)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(path)
+			j.fail(err)
+		}
+	})
+}
+
+func runCommand(flags *flag.FlagSet, args []string) int {
+	input := flags.String("input", "", "read the program's input from `file` instead of standard input")
+	out := flags.String("o", "", "write the program's output to `file`")
+	filename, status := parseFlags(flags, args)
+	if status >= 0 {
+		return status
+	}
+	in := os.Stdin
+	if *input != "" && *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	defer redirect(*out)()
+	if filepath.Ext(filename) == bytecodeExt {
+		execute(filename, in)
+	} else {
+		run(filename, in)
+	}
+	return exitOK
+}
+
+func disasmCommand(flags *flag.FlagSet, args []string) int {
+	out := flags.String("o", "", "write the listing to `file`")
+	filename, status := parseFlags(flags, args)
+	if status >= 0 {
+		return status
+	}
+	var module *pascomp.Module
+	if filepath.Ext(filename) == bytecodeExt {
+		module = load(filename)
+	} else {
+		module = pascomp.CompileBytecode(parse(filename))
+	}
+	defer redirect(*out)()
+	if err := module.Disassemble(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	return exitOK
+}
+
+func lspCommand(flags *flag.FlagSet, args []string) int {
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s lsp\n", program())
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		log.Print(err)
+		return exitError
+	}
+	return exitOK
+}
+
+// The help repl prints for :help
+const replHelp = `Type declarations, statements and expressions, separated by semicolons:
+	DECLARE INTEGER a; REAL r;	or just	INTEGER a;
+	SET a = 6 * 7; WRITE a
+	a / 2
+A procedure or a statement with BEGIN, IF, WHILE or UNTIL may take
+several lines.  READ reads the next words typed.
+	:symbols		dump the symbol table
+	:tokens LINE	list the tokens of LINE
+	:help			show this help
+	:quit			leave; so does the end of input
+`
+
+func replCommand(flags *flag.FlagSet, args []string) int {
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s repl [flags]\n", program())
+		flags.PrintDefaults()
+	}
+	if status := parseCommon(flags, args); status >= 0 {
+		return status
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	//READ shares the input with the lines typed
+	in := bufio.NewReader(os.Stdin)
+	session := pascomp.NewSession(in, os.Stdout)
+	info, err := os.Stdin.Stat()
+	prompt := err == nil && info.Mode()&os.ModeCharDevice != 0
+	var input string
 	for {
-		//tok, _ := scanner.GetToken(&x)
-		tok, _ := scanner.GetToken(&x)
-		if tok == pascomp.Tokeof {
-			break
-		}
-		scanner.St.Printlexeme(x)
-		fmt.Print("\t")
-		scanner.St.Printtoken(x)
-		fmt.Print("\n")
-		//fmt.Printf("%-9s %s\n", tokString, tok)
-	}
-	//fmt.Println()
-	//pascomp.DumpSymbolTable(scanner.St)
-	//	pascomp.DumpSymbolTable2(scanner.St)
+		if prompt {
+			if input == "" {
+				fmt.Print("japc> ")
+			} else {
+				fmt.Print("....> ")
+			}
+		}
+		line, err := in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			log.Fatal(err)
+		}
+		if input == "" && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if !replMeta(session, strings.TrimSpace(line)) {
+				return exitOK
+			}
+		} else {
+			input += line
+			if strings.TrimSpace(input) == "" {
+				input = ""
+			} else if pascomp.Complete(input) || err == io.EOF {
+				replEval(session, input)
+				input = ""
+			}
+		}
+		if err == io.EOF {
+			if prompt {
+				fmt.Println()
+			}
+			return exitOK
+		}
+	}
+}
+
+// replMeta() -	Carry out one of repl's colon commands; returns false
+//				for :quit
+func replMeta(session *pascomp.Session, line string) bool {
+	name, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i:])
+	}
+	switch name {
+	case ":quit", ":q":
+		return false
+	case ":help", ":h":
+		fmt.Print(replHelp)
+	case ":symbols":
+		pascomp.WriteSymbolTable(os.Stdout, session.St)
+	case ":tokens":
+		if err := session.Tokens(os.Stdout, arg); err != nil {
+			replError(arg, err)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %s; type :help for the commands\n", name)
+	}
+	return true
+}
+
+// replEval() - Run an input, reporting its error if it has one
+func replEval(session *pascomp.Session, input string) {
+	if err := session.Eval(input); err != nil {
+		replError(input, err)
+	}
+}
+
+// replError() - Report an error in what was typed
+func replError(input string, err error) {
+	if serr, ok := err.(*pascomp.SyntaxError); ok {
+		renderer.Render(os.Stderr, diagnostics.NewSource("input", []byte(input)), serr.Diagnostic())
+		return
+	}
+	fmt.Fprintln(os.Stderr, err)
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Helpers
+////////////////////////////////////////////////////////////////////
+
+// run() - Parse a program and execute it with the tree walking interpreter
+func run(filename string, in io.Reader) {
+	if err := pascomp.NewInterpreter(parse(filename), in, os.Stdout).Run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// The extension of compiled bytecode files
+const bytecodeExt = ".jbc"
+
+// source() - Open a program's file, or standard input for -
+func source(filename string) (io.ReadCloser, error) {
+	if filename == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	if filepath.Ext(filename) != ".pas" {
+		return nil, fmt.Errorf("%s: only pascal files with extension `.pas` allowed", filename)
+	}
+	return os.Open(filename)
+}
+
+// read() - Read the file's source
+func (j *job) read() error {
+	in, err := source(j.filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if j.source, err = io.ReadAll(in); err != nil {
+		return fmt.Errorf("%s: %v", j.filename, err)
+	}
+	return nil
+}
+
+// parse() -	Scan and parse the file with a scanner and symbol table
+//				of its own, stopping at the first error, which is a
+//				*pascomp.SyntaxError if the program is wrong
+func (j *job) parse() (*pascomp.Program, error) {
+	if err := j.read(); err != nil {
+		return nil, err
+	}
+	var scanner pascomp.Scanner
+	scanner.NewScannerReader(bytes.NewReader(j.source))
+	j.st = scanner.St
+	return pascomp.NewParser(&scanner).Parse()
+}
+
+// parse() - Parse a program, exiting on the first error
+func parse(filename string) *pascomp.Program {
+	j := &job{filename: filename}
+	prog, err := j.parse()
+	if err != nil {
+		j.fail(err)
+		j.exit()
+	}
+	return prog
+}
+
+// Whether -O asked for the intermediate code to be optimized
+var optimize bool
+
+// How diagnostics are written, colored or not as -color decides
+var renderer diagnostics.Renderer
+
+// The file -sarif names, if any
+var sarifPath string
+
+// lower() - Lower a program to intermediate code after warning about it
+func (j *job) lower(prog *pascomp.Program) *pascomp.IrProgram {
+	ir := pascomp.GenerateIR(prog)
+	j.check(ir)
+	if optimize {
+		pascomp.Optimize(ir)
+	}
+	return ir
+}
+
+// build() -	Translate a program for a target, writing it to w, and
+//				warn about it the same way whatever the target
+func (j *job) build(target string, w io.Writer) error {
+	prog, err := j.parse()
+	if err != nil {
+		return err
+	}
+
+	//The targets made from the tree are written before the program is
+	//lowered to check it so that they see none of the temporaries
+	//lowering adds to the symbol table
+	switch target {
+	case "bytecode":
+		_, err = pascomp.CompileBytecode(prog).WriteTo(w)
+	case "c":
+		err = pascomp.GenerateC(prog, w)
+	case "wat":
+		err = pascomp.GenerateWAT(prog, w)
+	case "go":
+		err = pascomp.GenerateGo(prog, w)
+	default:
+		return j.buildIR(target, prog, w)
+	}
+	j.check(pascomp.GenerateIR(prog))
+	return err
+}
+
+// buildIR() - Translate a program for a target made from its quadruples
+func (j *job) buildIR(target string, prog *pascomp.Program, w io.Writer) error {
+	switch target {
+	case "ir":
+		return j.lower(prog).Dump(w)
+	case "cfg", "ssa":
+		ir := j.lower(prog)
+		var graphs []*pascomp.CFG
+		for _, p := range ir.Procs {
+			graphs = append(graphs, pascomp.BuildCFG(ir, p))
+		}
+		if target == "cfg" {
+			return pascomp.WriteDot(w, graphs)
+		}
+		for i, g := range graphs {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			g.ToSSA()
+			if err := g.Dump(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "x86-16", "x86-32", "x86-64":
+		x86 := map[string]pascomp.X86Target{"x86-16": pascomp.X86Dos16,
+			"x86-32": pascomp.X86Linux32, "x86-64": pascomp.X86Linux64}[target]
+		return pascomp.GenerateX86(j.lower(prog), x86, w)
+	case "llvm":
+		return pascomp.GenerateLLVM(j.lower(prog), w)
+	}
+	return fmt.Errorf("unknown target %q", target)
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Many Files
+////////////////////////////////////////////////////////////////////
+
+// job is the work done on one file of many.  What it reports is kept
+// until every file is done so that it prints in the order given.
+type job struct {
+	filename string
+	source   []byte
+	st       *pascomp.SymbolTable
+	diags    []diagnostics.Diagnostic
+	out      bytes.Buffer // what it writes to standard output
+	report   bytes.Buffer
+	failed   bool
+}
+
+// check() -	Warn about variables that may be read before they are
+//				set and names that are declared but never used;
+//				returns the number of warnings
+func (j *job) check(ir *pascomp.IrProgram) int {
+	warnings := append(pascomp.CheckAssigned(ir), pascomp.Unused(ir)...)
+	for _, w := range warnings {
+		j.diagnose(w.Diagnostic())
+	}
+	return len(warnings)
+}
+
+// fail() -	Report an error, showing an error in the program with
+//			its source
+func (j *job) fail(err error) {
+	if serr, ok := err.(*pascomp.SyntaxError); ok {
+		j.diagnose(serr.Diagnostic())
+	} else {
+		fmt.Fprintln(&j.report, err)
+	}
+	j.failed = true
+}
+
+// diagnose() - Report a diagnostic about the file
+func (j *job) diagnose(d diagnostics.Diagnostic) {
+	j.diags = append(j.diags, d)
+	renderer.Render(&j.report, j.src(), d)
+}
+
+// src() - The file's source as diagnostics show it
+func (j *job) src() *diagnostics.Source {
+	name := j.filename
+	if name == "-" {
+		name = "stdin"
+	}
+	return diagnostics.NewSource(name, j.source)
+}
+
+// exit() - Print what the file reported and exit with an error
+func (j *job) exit() {
+	os.Stderr.Write(j.report.Bytes())
+	os.Exit(exitError)
+}
+
+// list() -	Write the file's listing next to it, or to stdin.lst for
+//			standard input
+func (j *job) list() {
+	if j.source == nil {
+		return
+	}
+	path := "stdin.lst"
+	if j.filename != "-" {
+		path = strings.TrimSuffix(j.filename, filepath.Ext(j.filename)) + ".lst"
+	}
+	w, err := os.Create(path)
+	if err != nil {
+		j.fail(err)
+		return
+	}
+	var notes []pascomp.Note
+	for _, d := range j.diags {
+		notes = append(notes, pascomp.Note{Line: d.Primary.Line, Column: d.Primary.Column, Text: d.String()})
+	}
+	err = pascomp.WriteListing(w, j.filename, j.source, notes, j.st)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		j.fail(err)
+	}
+}
+
+// parseFiles() -	Parse a command's flags, leaving the files it works
+//					on with every directory replaced by the .pas files
+//					under it in lexical order
+func parseFiles(flags *flag.FlagSet, args []string) ([]string, int) {
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s %s [flags] file|directory ...\n", program(), flags.Name())
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&sarifPath, "sarif", "", "also write the diagnostics as a SARIF log to `file`")
+	if status := parseCommon(flags, args); status >= 0 {
+		return nil, status
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return nil, exitUsage
+	}
+
+	var files []string
+	for _, arg := range flags.Args() {
+		if info, err := os.Stat(arg); err != nil || !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err := filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && filepath.Ext(path) == ".pas" {
+				files = append(files, path)
+			}
+			return err
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	return files, -1
+}
+
+// each() -	Do the work for every file, at most jobs of them at once,
+//			then print what each reported in the order the files
+//			were given; returns the exit status
+func each(files []string, jobs int, work func(j *job)) int {
+	if jobs < 1 {
+		jobs = 1
+	}
+	done := make([]*job, len(files))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				done[i] = &job{filename: files[i]}
+				work(done[i])
+			}
+		}()
+	}
+	for i := range files {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	status := exitOK
+	sarif := &diagnostics.SARIF{Tool: "JAPC", Rules: pascomp.Rules}
+	for _, j := range done {
+		os.Stdout.Write(j.out.Bytes())
+		os.Stderr.Write(j.report.Bytes())
+		if j.failed {
+			status = exitError
+		}
+		sarif.Add(j.src(), j.diags)
+	}
+	if sarifPath != "" {
+		if err := writeSARIF(sarif); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = exitError
+		}
+	}
+	return status
+}
+
+// writeSARIF() - Write the SARIF log to the file -sarif names
+func writeSARIF(sarif *diagnostics.SARIF) error {
+	if sarifPath == "-" {
+		return sarif.Write(os.Stdout)
+	}
+	w, err := os.Create(sarifPath)
+	if err != nil {
+		return err
+	}
+	err = sarif.Write(w)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// load() - Read a compiled bytecode file
+func load(filename string) *pascomp.Module {
+	in, err := os.Open(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer in.Close()
+
+	module, err := pascomp.ReadModule(in)
+	if err != nil {
+		log.Fatal(filename, ": ", err)
+	}
+	return module
+}
+
+// execute() - Run a compiled bytecode file on the virtual machine
+func execute(filename string, in io.Reader) {
+	if err := pascomp.NewVM(load(filename), in, os.Stdout).Run(); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildWarnings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "warn.pas")
+	source := "PROGRAM Warn;\n\tDECLARE INTEGER used, spare;\nBEGIN\n\tREAD used;\n\tWRITE used\nEND.\n"
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	//Every target warns about the unused variable, and only that
+	for _, target := range targets {
+		j := &job{filename: path}
+		if err := j.build(target, io.Discard); err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		if len(j.diags) != 1 || j.diags[0].Code != "W001" || j.diags[0].Primary.Line != 2 {
+			t.Errorf("%s: warned %+v, want W001 on line 2", target, j.diags)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package diagnostics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//////////////////////////Diagnostics//////////////////////////
+//A diagnostic is an error, warning or note about a program.  It has a
+//code naming its kind, such as E004, the span of source it is about,
+//secondary spans that explain it, such as where a name was declared,
+//and any notes and suggested fixes.  A Renderer writes diagnostics for
+//people: the message, then each line a span falls on with carets under
+//the primary span and dashes under the others, then the notes and
+//suggestions.  sarif.go writes them for code scanning tools.
+
+// Severity is how bad a diagnostic is
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+// String() - The severity as messages and SARIF logs name it
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	}
+	return "note"
+}
+
+// Span is a stretch of one line of source
+type Span struct {
+	Line   int
+	Column int    // counting characters from 1, or 0 if only the line is known
+	Width  int    // in characters, or 0 for the word, number or operator at Column
+	Label  string // shown beside the span's underline
+}
+
+// Suggestion is a help message.  One with a span is a fix that puts
+// Replacement in place of the span.
+type Suggestion struct {
+	Message     string
+	Span        Span
+	Replacement string
+}
+
+// IsFix() - Whether the suggestion changes the source
+func (s Suggestion) IsFix() bool {
+	return s.Span.Line > 0
+}
+
+// Diagnostic is one error, warning or note
+type Diagnostic struct {
+	Severity    Severity
+	Code        string // such as E004, or empty
+	Message     string
+	Primary     Span
+	Secondary   []Span
+	Notes       []string
+	Suggestions []Suggestion
+}
+
+// String() - The diagnostic's first line, such as error[E004]: X is not declared
+func (d Diagnostic) String() string {
+	if d.Code == "" {
+		return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s[%s]: %s", d.Severity, d.Code, d.Message)
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Source
+////////////////////////////////////////////////////////////////////
+
+// Source is the text of a program diagnostics are about
+type Source struct {
+	Name  string
+	lines [][]rune
+}
+
+// NewSource() - Split a program's text into lines
+func NewSource(name string, text []byte) *Source {
+	src := &Source{Name: name}
+	s := strings.TrimSuffix(string(text), "\n")
+	if s == "" {
+		return src
+	}
+	for _, line := range strings.Split(s, "\n") {
+		src.lines = append(src.lines, []rune(strings.TrimSuffix(line, "\r")))
+	}
+	return src
+}
+
+// Line() - The text of a line counting from 1, and whether there is one
+func (src *Source) Line(n int) ([]rune, bool) {
+	if src == nil || n < 1 || n > len(src.lines) {
+		return nil, false
+	}
+	return src.lines[n-1], true
+}
+
+// Width() -	The number of characters a span covers, measuring the
+//				token at its column when it has no width of its own
+func (src *Source) Width(span Span) int {
+	if span.Width > 0 {
+		return span.Width
+	}
+	line, _ := src.Line(span.Line)
+	if at := span.Column - 1; at >= 0 && at < len(line) {
+		return TokenWidth(line[at:])
+	}
+	return 1
+}
+
+// TokenWidth() -	The number of characters in the token starting a
+//					line: a word, a number or a single operator
+func TokenWidth(runes []rune) int {
+	n := 1
+	switch {
+	case unicode.IsLetter(runes[0]):
+		for n < len(runes) && (unicode.IsLetter(runes[n]) || unicode.IsNumber(runes[n])) {
+			n++
+		}
+	case unicode.IsNumber(runes[0]):
+		for n < len(runes) && (unicode.IsNumber(runes[n]) || runes[n] == '.') {
+			n++
+		}
+	}
+	return n
+}
+
+// ExpandTabs() - Replace each tab with spaces up to the next tab stop
+func ExpandTabs(line string, tabStop int) string {
+	var b strings.Builder
+	column := 0
+	for _, r := range line {
+		if r == '\t' {
+			spaces := tabStop - column%tabStop
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+			continue
+		}
+		b.WriteRune(r)
+		column++
+	}
+	return b.String()
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Rendering
+////////////////////////////////////////////////////////////////////
+
+// Renderer writes diagnostics as text for people to read
+type Renderer struct {
+	Color   bool // use ANSI colors, as for a terminal
+	TabStop int  // 8 if not set
+}
+
+// The ANSI escape sequences a Renderer colors with
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[1;31m"
+	ansiYellow = "\x1b[1;33m"
+	ansiGreen  = "\x1b[1;32m"
+	ansiBlue   = "\x1b[1;34m"
+	ansiCyan   = "\x1b[1;36m"
+)
+
+// IsTerminal() -	Whether a file is a terminal that colors suit:
+//					NO_COLOR is not set and TERM is not dumb
+func IsTerminal(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (r Renderer) paint(color, text string) string {
+	if !r.Color || text == "" {
+		return text
+	}
+	return color + text + ansiReset
+}
+
+func (r Renderer) severityColor(s Severity) string {
+	switch s {
+	case Error:
+		return ansiRed
+	case Warning:
+		return ansiYellow
+	}
+	return ansiGreen
+}
+
+// Render() -	Write a diagnostic with the lines of source its spans
+//				fall on and a blank line after it, such as
+//
+//				error[E007]: cannot assign a real value to the integer N
+//				 --> r.pas:6:3
+//				  |
+//				2 | DECLARE INTEGER n;
+//				  |                 - declared INTEGER here
+//				...
+//				6 |   SET n = x * 2
+//				  |   ^^^
+//				  |
+//				  = note: a real is never converted to an integer
+func (r Renderer) Render(w io.Writer, src *Source, d Diagnostic) error {
+	if r.TabStop <= 0 {
+		r.TabStop = 8
+	}
+	bw := bufio.NewWriter(w)
+	color := r.severityColor(d.Severity)
+	head := d.Severity.String()
+	if d.Code != "" {
+		head += "[" + d.Code + "]"
+	}
+	fmt.Fprintf(bw, "%s%s\n", r.paint(color, head), r.paint(ansiBold, ": "+d.Message))
+
+	//The gutter is as wide as the largest line number shown
+	spans := append([]Span{d.Primary}, d.Secondary...)
+	last := 0
+	for _, s := range spans {
+		if s.Line > last {
+			last = s.Line
+		}
+	}
+	for _, s := range d.Suggestions {
+		if s.IsFix() && s.Span.Line > last {
+			last = s.Span.Line
+		}
+	}
+	gutter := strings.Repeat(" ", len(strconv.Itoa(last)))
+
+	where := src.Name
+	if d.Primary.Line > 0 {
+		where += ":" + strconv.Itoa(d.Primary.Line)
+		if d.Primary.Column > 0 {
+			where += ":" + strconv.Itoa(d.Primary.Column)
+		}
+	}
+	fmt.Fprintf(bw, "%s%s %s\n", gutter, r.paint(ansiBlue, "-->"), where)
+
+	shown := r.snippet(bw, src, gutter, spans, color)
+	if len(d.Notes) > 0 || len(d.Suggestions) > 0 {
+		if shown {
+			fmt.Fprintf(bw, "%s %s\n", gutter, r.paint(ansiBlue, "|"))
+		}
+		for _, note := range d.Notes {
+			fmt.Fprintf(bw, "%s %s %s %s\n", gutter, r.paint(ansiBlue, "="), r.paint(ansiBold, "note:"), note)
+		}
+		for _, s := range d.Suggestions {
+			if !s.IsFix() {
+				fmt.Fprintf(bw, "%s %s %s %s\n", gutter, r.paint(ansiBlue, "="), r.paint(ansiBold, "help:"), s.Message)
+			}
+		}
+		for _, s := range d.Suggestions {
+			if s.IsFix() {
+				r.fix(bw, src, gutter, s)
+			}
+		}
+	}
+	fmt.Fprintln(bw)
+	return bw.Flush()
+}
+
+// snippet() -	Write the lines the spans fall on, each followed by the
+//				underlines of its spans, the first span's in carets;
+//				reports whether any line was shown
+func (r Renderer) snippet(w io.Writer, src *Source, gutter string, spans []Span, color string) bool {
+	byLine := make(map[int][]int)
+	var lines []int
+	for i, s := range spans {
+		if _, ok := src.Line(s.Line); !ok {
+			continue
+		}
+		if byLine[s.Line] == nil {
+			lines = append(lines, s.Line)
+		}
+		byLine[s.Line] = append(byLine[s.Line], i)
+	}
+	if len(lines) == 0 {
+		return false
+	}
+	sort.Ints(lines)
+
+	bar := r.paint(ansiBlue, "|")
+	fmt.Fprintf(w, "%s %s\n", gutter, bar)
+	for n, line := range lines {
+		if n > 0 && line > lines[n-1]+1 {
+			fmt.Fprintln(w, r.paint(ansiBlue, "..."))
+		}
+		text, _ := src.Line(line)
+		fmt.Fprintf(w, "%s %s %s\n", r.paint(ansiBlue, fmt.Sprintf("%*d", len(gutter), line)), bar,
+			ExpandTabs(string(text), r.TabStop))
+		for _, i := range byLine[line] {
+			s := spans[i]
+			if s.Column < 1 {
+				if s.Label != "" {
+					fmt.Fprintf(w, "%s %s %s\n", gutter, bar, r.paint(ansiCyan, s.Label))
+				}
+				continue
+			}
+			mark, paint := "-", ansiCyan
+			if i == 0 {
+				mark, paint = "^", color
+			}
+			underline := strings.Repeat(mark, src.Width(s))
+			if s.Label != "" {
+				underline += " " + s.Label
+			}
+			fmt.Fprintf(w, "%s %s %s%s\n", gutter, bar, r.indent(text, s.Column), r.paint(paint, underline))
+		}
+	}
+	return true
+}
+
+// fix() -	Write a suggested fix with its line as it would read
+//			after the change, the replacement underlined
+func (r Renderer) fix(w io.Writer, src *Source, gutter string, s Suggestion) {
+	fmt.Fprintf(w, "%s %s\n", r.paint(ansiBold, "help:"), s.Message)
+	text, ok := src.Line(s.Span.Line)
+	at := s.Span.Column - 1
+	if !ok || at < 0 || at > len(text) {
+		return
+	}
+	end := at + src.Width(s.Span)
+	if end > len(text) {
+		end = len(text)
+	}
+	fixed := string(text[:at]) + s.Replacement + string(text[end:])
+
+	bar := r.paint(ansiBlue, "|")
+	fmt.Fprintf(w, "%s %s\n", gutter, bar)
+	fmt.Fprintf(w, "%s %s %s\n", r.paint(ansiBlue, fmt.Sprintf("%*d", len(gutter), s.Span.Line)), bar,
+		ExpandTabs(fixed, r.TabStop))
+	if width := len([]rune(s.Replacement)); width > 0 {
+		fmt.Fprintf(w, "%s %s %s%s\n", gutter, bar, r.indent(text, s.Span.Column),
+			r.paint(ansiGreen, strings.Repeat("~", width)))
+	}
+}
+
+// indent() -	The spaces that line up an underline with a column once
+//				the line's tabs are expanded
+func (r Renderer) indent(text []rune, column int) string {
+	at := column - 1
+	if at > len(text) {
+		at = len(text)
+	}
+	return strings.Repeat(" ", len([]rune(ExpandTabs(string(text[:at]), r.TabStop))))
+}
@@ -0,0 +1,175 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+//////////////////////////SARIF Logs//////////////////////////
+//SARIF 2.1.0 is the JSON format code scanning dashboards read.  A log
+//names the tool and the rules it checks, one to a diagnostic code, and
+//lists the results: each diagnostic with its file, the region of its
+//primary span, its secondary spans as related locations and its
+//suggested changes as fixes.  SARIF has no place for notes, so they
+//follow the message text on lines of their own.
+
+// Rule describes one diagnostic code for the tools reading a log
+type Rule struct {
+	ID       string // the code, such as E004
+	Name     string // such as undeclared-name
+	Severity Severity
+	Summary  string
+}
+
+// SARIF is a log of the diagnostics for any number of files
+type SARIF struct {
+	Tool  string
+	Rules []Rule
+
+	results []sarifResult
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifPhysical struct {
+	Artifact sarifArtifact `json:"artifactLocation"`
+	Region   *sarifRegion  `json:"region,omitempty"`
+}
+
+type sarifLocation struct {
+	ID       *int          `json:"id,omitempty"`
+	Physical sarifPhysical `json:"physicalLocation"`
+	Message  *sarifText    `json:"message,omitempty"`
+}
+
+type sarifReplacement struct {
+	Deleted  sarifRegion `json:"deletedRegion"`
+	Inserted sarifText   `json:"insertedContent"`
+}
+
+type sarifChange struct {
+	Artifact     sarifArtifact      `json:"artifactLocation"`
+	Replacements []sarifReplacement `json:"replacements"`
+}
+
+type sarifFix struct {
+	Description sarifText     `json:"description"`
+	Changes     []sarifChange `json:"artifactChanges"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId,omitempty"`
+	RuleIndex *int            `json:"ruleIndex,omitempty"`
+	Level     string          `json:"level"`
+	Message   sarifText       `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+	Related   []sarifLocation `json:"relatedLocations,omitempty"`
+	Fixes     []sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifRule struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name,omitempty"`
+	Summary sarifText `json:"shortDescription"`
+	Default struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+// region() - Where a span is, its end column just past it
+func region(src *Source, span Span) *sarifRegion {
+	if span.Line < 1 {
+		return nil
+	}
+	r := &sarifRegion{StartLine: span.Line}
+	if span.Column > 0 {
+		r.StartColumn = span.Column
+		r.EndColumn = span.Column + src.Width(span)
+	}
+	return r
+}
+
+// Add() - Add the diagnostics for one file to the log
+func (log *SARIF) Add(src *Source, diags []Diagnostic) {
+	artifact := sarifArtifact{URI: filepath.ToSlash(src.Name)}
+	for _, d := range diags {
+		text := d.Message
+		if len(d.Notes) > 0 {
+			text += "\nnote: " + strings.Join(d.Notes, "\nnote: ")
+		}
+		result := sarifResult{RuleID: d.Code, Level: d.Severity.String(), Message: sarifText{text},
+			Locations: []sarifLocation{{Physical: sarifPhysical{artifact, region(src, d.Primary)}}}}
+		for i, rule := range log.Rules {
+			if rule.ID == d.Code {
+				index := i
+				result.RuleIndex = &index
+				break
+			}
+		}
+		for i, span := range d.Secondary {
+			id := i + 1
+			related := sarifLocation{ID: &id, Physical: sarifPhysical{artifact, region(src, span)}}
+			if span.Label != "" {
+				related.Message = &sarifText{span.Label}
+			}
+			result.Related = append(result.Related, related)
+		}
+		for _, s := range d.Suggestions {
+			if !s.IsFix() {
+				continue
+			}
+			replacement := sarifReplacement{Deleted: *region(src, s.Span), Inserted: sarifText{s.Replacement}}
+			result.Fixes = append(result.Fixes, sarifFix{Description: sarifText{s.Message},
+				Changes: []sarifChange{{artifact, []sarifReplacement{replacement}}}})
+		}
+		log.results = append(log.results, result)
+	}
+}
+
+// Write() - Write the log as indented JSON
+func (log *SARIF) Write(w io.Writer) error {
+	type driver struct {
+		Name  string      `json:"name"`
+		Rules []sarifRule `json:"rules"`
+	}
+	type run struct {
+		Tool struct {
+			Driver driver `json:"driver"`
+		} `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+
+	var r run
+	r.Tool.Driver = driver{Name: log.Tool, Rules: []sarifRule{}}
+	for _, rule := range log.Rules {
+		sr := sarifRule{ID: rule.ID, Name: rule.Name, Summary: sarifText{rule.Summary}}
+		sr.Default.Level = rule.Severity.String()
+		r.Tool.Driver.Rules = append(r.Tool.Driver.Rules, sr)
+	}
+	r.Results = log.results
+	if r.Results == nil {
+		r.Results = []sarifResult{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Schema  string `json:"$schema"`
+		Version string `json:"version"`
+		Runs    []run  `json:"runs"`
+	}{"https://json.schemastore.org/sarif-2.1.0.json", "2.1.0", []run{r}})
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+//////////////////////////Unified Diffs//////////////////////////
+//fmt -d shows what formatting would change as a unified diff like
+//diff -u writes: the lines two texts do not share with three lines of
+//context around each change.  The lines kept are found with Myers'
+//algorithm in linear space: the middle snake of the shortest edit
+//script splits the texts in two, each half is diffed the same way,
+//and lines the texts begin or end with in common are set aside first.
+//The time taken grows with the size of the texts times the number of
+//lines changed, and the memory only with the size of the texts.
+
+// The lines of context around each change
+const diffContext = 3
+
+// writeDiff() -	Write the changes from one text to another as a
+//					unified diff, or nothing if they are the same
+func writeDiff(w io.Writer, oldName, newName string, a, b []byte) error {
+	x, y := splitLines(a), splitLines(b)
+	edits := diffLines(x, y)
+	if len(edits) == 0 {
+		return nil
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(edits); {
+		//A hunk runs until two changes have more than twice the
+		//context between them
+		end := start + 1
+		for end < len(edits) && edits[end].x-edits[end-1].x-edits[end-1].deleted() <= 2*diffContext {
+			end++
+		}
+		first, last := edits[start], edits[end-1]
+		before := diffContext
+		if first.x < before {
+			before = first.x
+		}
+		after := diffContext
+		if rest := len(x) - last.x - last.deleted(); rest < after {
+			after = rest
+		}
+		x0, y0 := first.x-before, first.y-before
+		x1, y1 := last.x+last.deleted()+after, last.y+last.inserted()+after
+		fmt.Fprintf(bw, "@@ -%s +%s @@\n", hunkRange(x0, x1), hunkRange(y0, y1))
+
+		i := x0
+		for _, e := range edits[start:end] {
+			for ; i < e.x; i++ {
+				writeDiffLine(bw, ' ', x[i])
+			}
+			if e.insert {
+				writeDiffLine(bw, '+', y[e.y])
+			} else {
+				writeDiffLine(bw, '-', x[e.x])
+				i++
+			}
+		}
+		for ; i < x1; i++ {
+			writeDiffLine(bw, ' ', x[i])
+		}
+		start = end
+	}
+	return bw.Flush()
+}
+
+// edit is one line deleted from the old text at x or inserted from the
+// new text at y; x and y are where the edit falls in both texts
+type edit struct {
+	x, y   int
+	insert bool
+}
+
+// deleted() - The number of old lines the edit removes
+func (this edit) deleted() int {
+	if this.insert {
+		return 0
+	}
+	return 1
+}
+
+// inserted() - The number of new lines the edit adds
+func (this edit) inserted() int {
+	return 1 - this.deleted()
+}
+
+// differ finds the edits that turn the lines x into the lines y
+type differ struct {
+	x, y          [][]byte
+	forward, back []int // the furthest x reached on each diagonal
+	edits         []edit
+}
+
+// diffLines() -	The edits that turn the lines x into the lines y, each
+//					change's deletions before its insertions
+func diffLines(x, y [][]byte) []edit {
+	size := len(x) + len(y) + 2
+	this := &differ{x: x, y: y, forward: make([]int, 2*size+1), back: make([]int, 2*size+1)}
+	this.compare(0, len(x), 0, len(y))
+
+	//The two halves of a split may leave a change's insertions before
+	//its deletions
+	edits := this.edits
+	for start := 0; start < len(edits); {
+		end := start + 1
+		for end < len(edits) && edits[end].x == edits[end-1].x+edits[end-1].deleted() &&
+			edits[end].y == edits[end-1].y+edits[end-1].inserted() {
+			end++
+		}
+		x, y, deletes := edits[start].x, edits[start].y, 0
+		for _, e := range edits[start:end] {
+			deletes += e.deleted()
+		}
+		for i := 0; i < end-start; i++ {
+			if i < deletes {
+				edits[start+i] = edit{x + i, y, false}
+			} else {
+				edits[start+i] = edit{x + deletes, y + i - deletes, true}
+			}
+		}
+		start = end
+	}
+	return edits
+}
+
+// compare() - Add the edits that turn x[x0:x1] into y[y0:y1]
+func (this *differ) compare(x0, x1, y0, y1 int) {
+	for x0 < x1 && y0 < y1 && bytes.Equal(this.x[x0], this.y[y0]) {
+		x0, y0 = x0+1, y0+1
+	}
+	for x0 < x1 && y0 < y1 && bytes.Equal(this.x[x1-1], this.y[y1-1]) {
+		x1, y1 = x1-1, y1-1
+	}
+	if x0 == x1 || y0 == y1 {
+		for i := x0; i < x1; i++ {
+			this.edits = append(this.edits, edit{i, y0, false})
+		}
+		for j := y0; j < y1; j++ {
+			this.edits = append(this.edits, edit{x1, j, true})
+		}
+		return
+	}
+	x, y, u, v := this.middleSnake(x0, x1, y0, y1)
+	this.compare(x0, x, y0, y)
+	this.compare(u, x1, v, y1)
+}
+
+// middleSnake() -	The run of common lines x..u and y..v in the middle of
+//					a shortest edit script from x[x0:x1] to y[y0:y1],
+//					found by searching from both ends at once until the
+//					paths overlap.  Both ranges are not empty and differ
+//					in their first and last lines.
+func (this *differ) middleSnake(x0, x1, y0, y1 int) (x, y, u, v int) {
+	n, m := x1-x0, y1-y0
+	delta := n - m
+	odd := delta%2 != 0
+	//Diagonal k is stored at k+off so that it is never negative
+	off := (n+m+1)/2 + 1
+	this.forward[off+1], this.back[off+1] = 0, 0
+
+	for d := 0; d <= (n+m+1)/2; d++ {
+		for k := -d; k <= d; k += 2 {
+			//Move down from the diagonal above or right from the one below
+			var fx int
+			if k == -d || k != d && this.forward[off+k-1] < this.forward[off+k+1] {
+				fx = this.forward[off+k+1]
+			} else {
+				fx = this.forward[off+k-1] + 1
+			}
+			fy := fx - k
+			sx, sy := fx, fy
+			for fx < n && fy < m && bytes.Equal(this.x[x0+fx], this.y[y0+fy]) {
+				fx, fy = fx+1, fy+1
+			}
+			this.forward[off+k] = fx
+			//The path back from the end on this diagonal took d-1 steps
+			if odd && k >= delta-(d-1) && k <= delta+(d-1) && fx+this.back[off+delta-k] >= n {
+				return x0 + sx, y0 + sy, x0 + fx, y0 + fy
+			}
+		}
+		//The same from the end, counting lines from the last
+		for k := -d; k <= d; k += 2 {
+			var bx int
+			if k == -d || k != d && this.back[off+k-1] < this.back[off+k+1] {
+				bx = this.back[off+k+1]
+			} else {
+				bx = this.back[off+k-1] + 1
+			}
+			by := bx - k
+			sx, sy := bx, by
+			for bx < n && by < m && bytes.Equal(this.x[x1-1-bx], this.y[y1-1-by]) {
+				bx, by = bx+1, by+1
+			}
+			this.back[off+k] = bx
+			if !odd && delta-k >= -d && delta-k <= d && bx+this.forward[off+delta-k] >= n {
+				return x1 - bx, y1 - by, x1 - sx, y1 - sy
+			}
+		}
+	}
+	panic("diff: the paths from both ends never met")
+}
+
+// splitLines() - A text's lines, each with its line break if it has one
+func splitLines(text []byte) [][]byte {
+	var lines [][]byte
+	for len(text) > 0 {
+		end := bytes.IndexByte(text, '\n') + 1
+		if end == 0 {
+			end = len(text)
+		}
+		lines = append(lines, text[:end])
+		text = text[end:]
+	}
+	return lines
+}
+
+// writeDiffLine() -	Write a line of a hunk, marking a last line that has
+//						no line break as diff does
+func writeDiffLine(w *bufio.Writer, mark byte, line []byte) {
+	w.WriteByte(mark)
+	w.Write(line)
+	if !bytes.HasSuffix(line, []byte("\n")) {
+		w.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// hunkRange() - The start and length of a hunk's lines from..to
+func hunkRange(from, to int) string {
+	if to-from == 1 {
+		return fmt.Sprint(from + 1)
+	}
+	if to == from {
+		//An empty range names the line before it
+		return fmt.Sprintf("%d,0", from)
+	}
+	return fmt.Sprintf("%d,%d", from+1, to-from)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// applyEdits() - The lines y as the edits rebuild them from the lines x
+func applyEdits(x, y [][]byte, edits []edit) [][]byte {
+	var out [][]byte
+	i := 0
+	for _, e := range edits {
+		for ; i < e.x; i++ {
+			out = append(out, x[i])
+		}
+		if e.insert {
+			out = append(out, y[e.y])
+		} else {
+			i++
+		}
+	}
+	return append(out, x[i:]...)
+}
+
+// lcsLength() - The length of a longest common subsequence of two texts
+func lcsLength(x, y [][]byte) int {
+	row := make([]int, len(y)+1)
+	for i := range x {
+		prev := 0
+		for j := range y {
+			next := row[j+1]
+			if bytes.Equal(x[i], y[j]) {
+				row[j+1] = prev + 1
+			} else if row[j] > row[j+1] {
+				row[j+1] = row[j]
+			}
+			prev = next
+		}
+	}
+	return row[len(y)]
+}
+
+func TestDiffLines(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	text := func() []byte {
+		var b strings.Builder
+		for n := r.Intn(30); n > 0; n-- {
+			fmt.Fprintf(&b, "%c\n", 'a'+r.Intn(4))
+		}
+		return []byte(b.String())
+	}
+	for i := 0; i < 2000; i++ {
+		x, y := splitLines(text()), splitLines(text())
+		edits := diffLines(x, y)
+		if got := applyEdits(x, y, edits); !bytes.Equal(bytes.Join(got, nil), bytes.Join(y, nil)) {
+			t.Fatalf("edits %v turn %q into %q, want %q", edits, x, got, y)
+		}
+		//The edits are as few as can be
+		if want := len(x) + len(y) - 2*lcsLength(x, y); len(edits) != want {
+			t.Fatalf("%d edits turn %q into %q, want %d", len(edits), x, y, want)
+		}
+		//Each change deletes before it inserts
+		for j := 1; j < len(edits); j++ {
+			if edits[j-1].insert && !edits[j].insert && edits[j].x == edits[j-1].x {
+				t.Fatalf("edits %v insert before deleting", edits)
+			}
+		}
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\ntwelve\n"
+	b := "one\n2\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\ntwelve\nthirteen"
+	want := `--- a.pas.orig
++++ a.pas
+@@ -1,5 +1,5 @@
+ one
+-two
++2
+ three
+ four
+ five
+@@ -10,3 +10,4 @@
+ ten
+ eleven
+ twelve
++thirteen
+\ No newline at end of file
+`
+	var out bytes.Buffer
+	if err := writeDiff(&out, "a.pas.orig", "a.pas", []byte(a), []byte(b)); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Errorf("diff is\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := writeDiff(&out, "a", "b", []byte(a), []byte(a)); err != nil || out.Len() != 0 {
+		t.Errorf("diff of a text with itself is %q, %v", out.String(), err)
+	}
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	//Every line of a large text changed must not need memory for
+	//every pair of lines
+	var a, b strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&a, "\tSET x%d = %d;\n", i, i)
+		fmt.Fprintf(&b, "\t\tSET x%d = %d;\n", i, i)
+	}
+	x, y := splitLines([]byte(a.String())), splitLines([]byte(b.String()))
+	if edits := diffLines(x, y); len(edits) != 10000 {
+		t.Errorf("%d edits, want 10000", len(edits))
+	}
+}
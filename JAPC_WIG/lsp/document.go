@@ -0,0 +1,242 @@
+package lsp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/kdgwill/golang_dev/JAPC_WIG/diagnostics"
+	"github.com/kdgwill/golang_dev/JAPC_WIG/pascomp"
+)
+
+//////////////////////////Documents//////////////////////////
+//Each open document is scanned and parsed afresh, with its own scanner
+//and a new symbol table, every time it changes, so what one version
+//declared never fills the table for the next.  The parser records every
+//identifier it reads with the attribute table entry the name resolves
+//to in its scope, so two identifiers refer to the same thing exactly
+//when they name the same entry.  A program with an error keeps the
+//identifiers read before the error.
+
+// document is an open file and what the compiler found in it
+type document struct {
+	uri      string
+	version  int
+	src      *diagnostics.Source
+	st       *pascomp.SymbolTable
+	refs     []pascomp.Reference
+	declared map[int]pascomp.Pos
+	diags    []diagnostics.Diagnostic
+}
+
+// analyze() -	Parse a document and check it for warnings if it has
+//				no errors
+func analyze(uri string, version int, text string) (d *document) {
+	d = &document{uri: uri, version: version, src: diagnostics.NewSource(uri, []byte(text))}
+	defer func() {
+		//A bug in the compiler should not take the editor's server down,
+		//nor should a program too big for the symbol table
+		if r := recover(); r != nil {
+			if serr, ok := r.(*pascomp.SyntaxError); ok {
+				d.diags = append(d.diags, serr.Diagnostic())
+				return
+			}
+			d.diags = append(d.diags, diagnostics.Diagnostic{Severity: diagnostics.Error,
+				Message: fmt.Sprintf("internal compiler error: %v", r)})
+		}
+	}()
+
+	var scanner pascomp.Scanner
+	scanner.NewScannerReader(bytes.NewReader([]byte(text)))
+	parser := pascomp.NewParser(&scanner)
+	prog, err := parser.Parse()
+	d.st, d.refs, d.declared = scanner.St, parser.References(), parser.Declared()
+	if err != nil {
+		if serr, ok := err.(*pascomp.SyntaxError); ok {
+			d.diags = append(d.diags, serr.Diagnostic())
+		}
+		return d
+	}
+	ir := pascomp.GenerateIR(prog)
+	for _, w := range append(pascomp.CheckAssigned(ir), pascomp.Unused(ir)...) {
+		d.diags = append(d.diags, w.Diagnostic())
+	}
+	return d
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Positions
+////////////////////////////////////////////////////////////////////
+
+// column() -	The compiler's line and column for a protocol position
+func (this *document) column(p position) (line, column int) {
+	text, _ := this.src.Line(p.Line + 1)
+	units := 0
+	for i, r := range text {
+		if units >= p.Character {
+			return p.Line + 1, i + 1
+		}
+		units += utf16.RuneLen(r)
+	}
+	return p.Line + 1, len(text) + 1
+}
+
+// position() -	The protocol position of a line and column
+func (this *document) position(line, column int) position {
+	text, _ := this.src.Line(line)
+	if column < 1 {
+		column = 1
+	}
+	if column > len(text)+1 {
+		column = len(text) + 1
+	}
+	return position{Line: line - 1, Character: len(utf16.Encode(text[:column-1]))}
+}
+
+// span() -	The range of a span, the whole line when it has no column
+func (this *document) span(s diagnostics.Span) span {
+	if s.Line < 1 {
+		s.Line = 1
+	}
+	if s.Column < 1 {
+		text, _ := this.src.Line(s.Line)
+		return span{this.position(s.Line, 1), this.position(s.Line, len(text)+1)}
+	}
+	return span{this.position(s.Line, s.Column), this.position(s.Line, s.Column+this.src.Width(s))}
+}
+
+// location() - Where a name appears, as a protocol location
+func (this *document) location(pos pascomp.Pos) location {
+	return location{this.uri, this.span(diagnostics.Span{Line: pos.Line, Column: pos.Column})}
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Queries
+////////////////////////////////////////////////////////////////////
+
+// published() - The document's diagnostics as the protocol has them
+func (this *document) published() []diagnostic {
+	severities := map[diagnostics.Severity]int{diagnostics.Error: severityError,
+		diagnostics.Warning: severityWarning, diagnostics.Note: severityInformation}
+	list := []diagnostic{}
+	for _, diag := range this.diags {
+		msg := diag.Message
+		for _, note := range diag.Notes {
+			msg += "\nnote: " + note
+		}
+		for _, s := range diag.Suggestions {
+			msg += "\nhelp: " + s.Message
+		}
+		out := diagnostic{Range: this.span(diag.Primary), Severity: severities[diag.Severity],
+			Code: diag.Code, Source: "japc", Message: msg}
+		for _, s := range diag.Secondary {
+			out.Related = append(out.Related, relatedInformation{location{this.uri, this.span(s)}, s.Label})
+		}
+		list = append(list, out)
+	}
+	return list
+}
+
+// reference() - The identifier at a position, if there is one
+func (this *document) reference(p position) (pascomp.Reference, bool) {
+	line, column := this.column(p)
+	for _, ref := range this.refs {
+		width := this.src.Width(diagnostics.Span{Line: ref.Line, Column: ref.Column})
+		if ref.Line == line && column >= ref.Column && column <= ref.Column+width {
+			return ref, true
+		}
+	}
+	return pascomp.Reference{}, false
+}
+
+// definition() -	Where the entry a name refers to was declared; the
+//					program's name is declared where it first appears
+func (this *document) definition(index int) (pascomp.Pos, bool) {
+	if pos, ok := this.declared[index]; ok {
+		return pos, true
+	}
+	if this.st.Getsmclass(index) == pascomp.Stprogram {
+		for _, ref := range this.refs {
+			if ref.Index == index {
+				return ref.Pos, true
+			}
+		}
+	}
+	return pascomp.Pos{}, false
+}
+
+// references() -	Every place a name refers to the same entry, with
+//					or without its declaration
+func (this *document) references(index int, declaration bool) []location {
+	declared, _ := this.definition(index)
+	list := []location{}
+	for _, ref := range this.refs {
+		if ref.Index == index && (declaration || ref.Pos != declared) {
+			list = append(list, this.location(ref.Pos))
+		}
+	}
+	return list
+}
+
+// describe() -	What the attribute table holds for a name: its
+//				semantic type, data type, value and owner
+func (this *document) describe(index int) string {
+	st := this.st
+	name := st.Getspelling(index)
+	kind := strings.TrimPrefix(st.Getsmclass(index).String(), "st")
+	dt := strings.TrimPrefix(st.Getdatatype(index).String(), "dt")
+
+	var sig string
+	switch st.Getsmclass(index) {
+	case pascomp.Stvariable, pascomp.Stparameter:
+		sig = fmt.Sprintf("(%s) %s: %s", kind, name, dt)
+	case pascomp.Stconstant:
+		lit := st.Getivalue(index)
+		sig = fmt.Sprintf("(%s) %s: %s = %s", kind, name, dt, st.Getlexeme(lit))
+	case pascomp.Stprocedure:
+		var params []string
+		for p := st.Getivalue(index); p != 0; p = st.Getivalue(p) {
+			params = append(params, fmt.Sprintf("%s: %s", st.Getspelling(p),
+				strings.TrimPrefix(st.Getdatatype(p).String(), "dt")))
+		}
+		sig = fmt.Sprintf("(%s) %s(%s)", kind, name, strings.Join(params, "; "))
+	case pascomp.Stprogram:
+		sig = fmt.Sprintf("(%s) %s", kind, name)
+	default:
+		return fmt.Sprintf("`%s` is not declared", name)
+	}
+
+	text := "```pascal\n" + sig + "\n```\n"
+	if owner := st.Getproc(index); owner >= 0 && owner != index {
+		where := "procedure"
+		if st.Getsmclass(owner) == pascomp.Stprogram {
+			where = "program"
+		}
+		text += fmt.Sprintf("\nDeclared in %s %s", where, st.Getspelling(owner))
+		if pos, ok := this.definition(index); ok {
+			text += fmt.Sprintf(" on line %d", pos.Line)
+		}
+		text += "."
+	}
+	return text
+}
+
+// keywords() -	The keywords, in the case of the word being typed at a
+//				position: lower case after a lower case letter and
+//				upper case otherwise
+func (this *document) keywords(p position) []completionItem {
+	line, column := this.column(p)
+	text, _ := this.src.Line(line)
+	lower := column >= 2 && column-2 < len(text) && unicode.IsLower(text[column-2])
+
+	items := []completionItem{}
+	for _, k := range pascomp.Keywords() {
+		if !lower {
+			k = strings.ToUpper(k)
+		}
+		items = append(items, completionItem{Label: k, Kind: completionKeyword})
+	}
+	return items
+}
@@ -0,0 +1,225 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+//////////////////////////Language Server//////////////////////////
+//A Server answers an editor over a pair of streams, normally standard
+//input and output.  Documents are synchronized whole: on every change
+//the editor sends the full text, the server analyzes it again and
+//publishes its diagnostics.  The server also goes to the declaration
+//of an identifier, finds every reference to it, shows what the
+//attribute table holds for it on hover and completes keywords.
+//Requests are answered one at a time in the order they arrive.
+
+// Server is a language server for one editor
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	docs        map[string]*document
+	initialized bool
+	shutdown    bool
+}
+
+// NewServer() - Create a server reading from in and writing to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, docs: make(map[string]*document)}
+}
+
+// errExit stops Run when the editor sends exit
+var errExit = errors.New("exit")
+
+// Run() -	Serve until the editor sends exit or closes the input.
+//			Stopping without a shutdown request first is an error.
+func (this *Server) Run() error {
+	for {
+		msg, err := readMessage(this.in)
+		if err == io.EOF {
+			break
+		}
+		if rerr, ok := err.(*rpcError); ok {
+			//The id of a message that is not JSON is unknown
+			if err := this.reply(json.RawMessage("null"), nil, rerr); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.ID == nil {
+			if err := this.notify(msg); err == errExit {
+				break
+			} else if err != nil {
+				return err
+			}
+			continue
+		}
+		result, rerr := this.request(msg)
+		if err := this.reply(*msg.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+	if !this.shutdown {
+		return errors.New("language server stopped without a shutdown request")
+	}
+	return nil
+}
+
+// reply() - Answer a request with its result or an error
+func (this *Server) reply(id json.RawMessage, result interface{}, rerr *rpcError) error {
+	resp := response{JSONRPC: "2.0", ID: id, Error: rerr}
+	if rerr == nil {
+		body, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resp.Result = body
+	}
+	return writeMessage(this.out, resp)
+}
+
+// publish() - Send a document's diagnostics to the editor
+func (this *Server) publish(d *document) error {
+	return writeMessage(this.out, notification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics",
+		Params: publishDiagnosticsParams{URI: d.uri, Version: d.version, Diagnostics: d.published()}})
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Notifications
+////////////////////////////////////////////////////////////////////
+
+// notify() -	Act on a notification.  Ones the server does not know,
+//				such as $/cancelRequest, are ignored.
+func (this *Server) notify(msg *message) error {
+	switch msg.Method {
+	case "exit":
+		return errExit
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if json.Unmarshal(msg.Params, &params) != nil {
+			return nil
+		}
+		d := analyze(params.TextDocument.URI, params.TextDocument.Version, params.TextDocument.Text)
+		this.docs[d.uri] = d
+		return this.publish(d)
+
+	case "textDocument/didChange":
+		var params didChangeParams
+		if json.Unmarshal(msg.Params, &params) != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		//With full synchronization the last change is the whole text
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		d := analyze(params.TextDocument.URI, params.TextDocument.Version, text)
+		this.docs[d.uri] = d
+		return this.publish(d)
+
+	case "textDocument/didClose":
+		var params didCloseParams
+		if json.Unmarshal(msg.Params, &params) != nil {
+			return nil
+		}
+		delete(this.docs, params.TextDocument.URI)
+		//Clear what was shown for it
+		return writeMessage(this.out, notification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics",
+			Params: publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []diagnostic{}}})
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Requests
+////////////////////////////////////////////////////////////////////
+
+// request() - Answer a request
+func (this *Server) request(msg *message) (interface{}, *rpcError) {
+	switch msg.Method {
+	case "initialize":
+		this.initialized = true
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   map[string]interface{}{"openClose": true, "change": 1},
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"hoverProvider":      true,
+				"completionProvider": map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "japc"},
+		}, nil
+	case "shutdown":
+		this.shutdown = true
+		return nil, nil
+	}
+	if !this.initialized {
+		return nil, &rpcError{codeNotInitialized, "the server has not been initialized"}
+	}
+
+	switch msg.Method {
+	case "textDocument/definition":
+		var params positionParams
+		d, rerr := this.document(msg, &params, &params)
+		if rerr != nil {
+			return nil, rerr
+		}
+		if ref, ok := d.reference(params.Position); ok {
+			if pos, ok := d.definition(ref.Index); ok {
+				return d.location(pos), nil
+			}
+		}
+		return nil, nil
+
+	case "textDocument/references":
+		var params referenceParams
+		d, rerr := this.document(msg, &params, &params.positionParams)
+		if rerr != nil {
+			return nil, rerr
+		}
+		if ref, ok := d.reference(params.Position); ok {
+			return d.references(ref.Index, params.Context.IncludeDeclaration), nil
+		}
+		return []location{}, nil
+
+	case "textDocument/hover":
+		var params positionParams
+		d, rerr := this.document(msg, &params, &params)
+		if rerr != nil {
+			return nil, rerr
+		}
+		if ref, ok := d.reference(params.Position); ok {
+			return hover{Contents: markupContent{Kind: "markdown", Value: d.describe(ref.Index)},
+				Range: d.location(ref.Pos).Range}, nil
+		}
+		return nil, nil
+
+	case "textDocument/completion":
+		var params positionParams
+		d, rerr := this.document(msg, &params, &params)
+		if rerr != nil {
+			return nil, rerr
+		}
+		return d.keywords(params.Position), nil
+	}
+	return nil, &rpcError{codeMethodNotFound, fmt.Sprintf("method %q is not supported", msg.Method)}
+}
+
+// document() -	Decode a request's parameters and find the open
+//				document they name
+func (this *Server) document(msg *message, params interface{}, at *positionParams) (*document, *rpcError) {
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return nil, &rpcError{codeInvalidParams, err.Error()}
+	}
+	d, ok := this.docs[at.TextDocument.URI]
+	if !ok {
+		return nil, &rpcError{codeInvalidParams, fmt.Sprintf("document %s is not open", at.TextDocument.URI)}
+	}
+	return d, nil
+}
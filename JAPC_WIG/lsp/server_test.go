@@ -0,0 +1,102 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// session() -	Run a server over messages, each a request when it has
+//				an id, and return what it sent back
+func session(t *testing.T, msgs ...map[string]interface{}) []map[string]json.RawMessage {
+	t.Helper()
+	var in, out bytes.Buffer
+	for _, msg := range msgs {
+		msg["jsonrpc"] = "2.0"
+		if err := writeMessage(&in, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := NewServer(&in, &out).Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	var sent []map[string]json.RawMessage
+	r := bufio.NewReader(&out)
+	for {
+		var length int
+		if _, err := fmt.Fscanf(r, "Content-Length: %d\r\n\r\n", &length); err != nil {
+			break
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			t.Fatal(err)
+		}
+		var msg map[string]json.RawMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, msg)
+	}
+	return sent
+}
+
+func TestOversizedDocument(t *testing.T) {
+	const uri = "file:///big.pas"
+	var big strings.Builder
+	big.WriteString("PROGRAM Big;\nDECLARE\n")
+	for i := 0; i < 2100; i++ {
+		fmt.Fprintf(&big, "\tINTEGER v%d;\n", i)
+	}
+	big.WriteString("BEGIN\nEND.\n")
+	small := "PROGRAM Small;\nDECLARE\n\tINTEGER count;\nBEGIN\n\tSET count = 1;\n\tWRITE count\nEND.\n"
+
+	sent := session(t,
+		map[string]interface{}{"id": 1, "method": "initialize", "params": map[string]interface{}{}},
+		map[string]interface{}{"method": "textDocument/didOpen", "params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri, "version": 1, "text": big.String()}}},
+		map[string]interface{}{"method": "textDocument/didChange", "params": map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+			"contentChanges": []map[string]string{{"text": small}}}},
+		map[string]interface{}{"id": 2, "method": "textDocument/hover", "params": map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri}, "position": map[string]int{"line": 4, "character": 6}}},
+		map[string]interface{}{"id": 3, "method": "shutdown"},
+		map[string]interface{}{"method": "exit"},
+	)
+
+	var published []publishDiagnosticsParams
+	answered := map[string]json.RawMessage{}
+	for _, msg := range sent {
+		if id, ok := msg["id"]; ok {
+			answered[string(id)] = msg["result"]
+			continue
+		}
+		var params publishDiagnosticsParams
+		if err := json.Unmarshal(msg["params"], &params); err != nil {
+			t.Fatal(err)
+		}
+		published = append(published, params)
+	}
+
+	if len(published) != 2 {
+		t.Fatalf("published diagnostics %d times, want 2", len(published))
+	}
+	if diags := published[0].Diagnostics; len(diags) != 1 || diags[0].Code != "E009" {
+		t.Errorf("oversized document has diagnostics %+v, want one E009", diags)
+	} else if diags[0].Range.Start.Line == 0 {
+		t.Errorf("table-full error is not at the name that overflowed the table: %+v", diags[0])
+	}
+	if diags := published[1].Diagnostics; len(diags) != 0 {
+		t.Errorf("document after the change has diagnostics %+v, want none", diags)
+	}
+	if hover := answered["2"]; !strings.Contains(string(hover), "count: integer") {
+		t.Errorf("hover after the oversized document answered %s", hover)
+	}
+	if _, ok := answered["3"]; !ok {
+		t.Error("shutdown was not answered")
+	}
+}
@@ -0,0 +1,193 @@
+package pascomp
+
+import (
+	"fmt"
+)
+
+//////////////////////////Definite Assignment//////////////////////////
+//Finds variables that may be read before SET or READ gives them a value.
+//For each basic block two sets are worked forward to a fixed point: the
+//variables assigned on every path reaching it (intersected at a join)
+//and those assigned on some path (their union).  A read of a variable in
+//neither set can only see garbage; one in the second set only sees it on
+//some paths through the IFs and loops.  Procedures are checked for their
+//own variables; parameters arrive with a value.  In the program a call
+//counts as assigning every program variable the procedure, or one it
+//calls, may assign.
+
+// CheckAssigned() -	Warn about every read of a variable that may not
+//						have been assigned, naming its declaration
+func CheckAssigned(ir *IrProgram) []Warning {
+	var warnings []Warning
+	callees := procAssigns(ir)
+	for _, p := range ir.Procs {
+		warnings = append(warnings, checkProcAssigned(ir, p, callees)...)
+	}
+	return warnings
+}
+
+// procAssigns() -	The program variables each procedure may assign,
+//					directly or through the procedures it calls
+func procAssigns(ir *IrProgram) map[int]map[int]bool {
+	main := ir.Procs[0].Index
+	assigns := make(map[int]map[int]bool)
+	calls := make(map[int][]int)
+	for _, p := range ir.Procs {
+		assigns[p.Index] = make(map[int]bool)
+		for _, q := range p.Code {
+			if quadDefines(q) && ir.St.Getproc(q.Result) == main && ir.St.Getsmclass(q.Result) == Stvariable {
+				assigns[p.Index][q.Result] = true
+			}
+			if q.Op == IrCall {
+				calls[p.Index] = append(calls[p.Index], q.Arg1)
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for proc, callees := range calls {
+			for _, callee := range callees {
+				for v := range assigns[callee] {
+					if !assigns[proc][v] {
+						assigns[proc][v], changed = true, true
+					}
+				}
+			}
+		}
+	}
+	return assigns
+}
+
+func checkProcAssigned(ir *IrProgram, p *IrProc, callees map[int]map[int]bool) []Warning {
+	st := ir.St
+	tracked := make(map[int]bool)
+	for _, v := range p.Vars {
+		tracked[v] = true
+	}
+	blocks := irBlocks(p)
+	if len(blocks) == 0 || len(tracked) == 0 {
+		return nil
+	}
+	preds := make([][]int, len(blocks))
+	for b, block := range blocks {
+		for _, s := range block.succs {
+			preds[s] = append(preds[s], b)
+		}
+	}
+
+	//transfer() runs a block from the sets assigned on entry, calling
+	//use for each read of a tracked variable and the column it is at
+	transfer := func(b int, must, may map[int]bool, use func(q Quad, v, column int, must, may map[int]bool)) {
+		for _, q := range p.Code[blocks[b].start:blocks[b].end] {
+			for i, v := range quadUses(q) {
+				if tracked[v] && use != nil {
+					use(q, v, q.Columns[i], must, may)
+				}
+			}
+			var set []int
+			if quadDefines(q) && tracked[q.Result] {
+				set = append(set, q.Result)
+			}
+			if q.Op == IrCall {
+				for v := range callees[q.Arg1] {
+					if tracked[v] {
+						set = append(set, v)
+					}
+				}
+			}
+			for _, v := range set {
+				must[v], may[v] = true, true
+			}
+		}
+	}
+	copySet := func(s map[int]bool) map[int]bool {
+		c := make(map[int]bool, len(s))
+		for v := range s {
+			c[v] = true
+		}
+		return c
+	}
+
+	//Every block starts out assuming everything is assigned, except
+	//the entry; blocks no path reaches keep that and are not checked
+	mustOut := make([]map[int]bool, len(blocks))
+	mayOut := make([]map[int]bool, len(blocks))
+	reached := make([]bool, len(blocks))
+	reached[0] = true
+	for changed := true; changed; {
+		changed = false
+		for b := range blocks {
+			if !reached[b] {
+				continue
+			}
+			must, may := entrySets(b, preds[b], mustOut, mayOut)
+			transfer(b, must, may, nil)
+			if mustOut[b] == nil || len(must) != len(mustOut[b]) || len(may) != len(mayOut[b]) {
+				mustOut[b], mayOut[b], changed = must, may, true
+			}
+			for _, s := range blocks[b].succs {
+				if !reached[s] {
+					reached[s], changed = true, true
+				}
+			}
+		}
+	}
+
+	var warnings []Warning
+	reported := make(map[[2]int]bool)
+	for b := range blocks {
+		if !reached[b] {
+			continue
+		}
+		must, may := entrySets(b, preds[b], mustOut, mayOut)
+		transfer(b, copySet(must), copySet(may), func(q Quad, v, column int, must, may map[int]bool) {
+			if must[v] || reported[[2]int{v, q.Line}] {
+				return
+			}
+			reported[[2]int{v, q.Line}] = true
+			what, code := "may be read before it is assigned", codeMaybeUnassigned
+			if !may[v] {
+				what, code = "is read before it is assigned", codeUnassigned
+			}
+			where := "procedure"
+			if p == ir.Procs[0] {
+				where = "program"
+			}
+			warnings = append(warnings, Warning{Line: q.Line, Column: column, Msg: fmt.Sprintf(
+				"variable %s in %s %s %s", st.Getlexeme(v), where, st.Getlexeme(p.Index), what),
+				Details: Details{Code: code, Related: declaredAt(ir.Declared, v, "declared here")}})
+		})
+	}
+	return warnings
+}
+
+// entrySets() -	The variables assigned on every path and on some path
+//					into a block, from its predecessors done so far
+func entrySets(b int, preds []int, mustOut, mayOut []map[int]bool) (must, may map[int]bool) {
+	must, may = make(map[int]bool), make(map[int]bool)
+	if b == 0 {
+		return
+	}
+	first := true
+	for _, p := range preds {
+		if mustOut[p] == nil {
+			continue
+		}
+		for v := range mayOut[p] {
+			may[v] = true
+		}
+		if first {
+			for v := range mustOut[p] {
+				must[v] = true
+			}
+			first = false
+			continue
+		}
+		for v := range must {
+			if !mustOut[p][v] {
+				delete(must, v)
+			}
+		}
+	}
+	return
+}
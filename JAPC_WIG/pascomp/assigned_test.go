@@ -0,0 +1,44 @@
+package pascomp
+
+import (
+	"testing"
+
+	"github.com/kdgwill/golang_dev/JAPC_WIG/diagnostics"
+)
+
+func TestCheckAssigned(t *testing.T) {
+	warnings := CheckAssigned(GenerateIR(parseSource(t, `PROGRAM Reads;
+	DECLARE INTEGER a, b, c;
+BEGIN
+	SET b = a;
+	IF b > 0 THEN
+		SET c = 1
+	ENDIF;
+	WRITE b, c
+END.
+`)))
+	tests := []struct {
+		code, msg string
+		line      int
+		declared  diagnostics.Span
+	}{
+		{codeUnassigned, "variable A in program READS is read before it is assigned", 4,
+			diagnostics.Span{Line: 2, Column: 18, Label: "declared here"}},
+		{codeMaybeUnassigned, "variable C in program READS may be read before it is assigned", 8,
+			diagnostics.Span{Line: 2, Column: 24, Label: "declared here"}},
+	}
+	if len(warnings) != len(tests) {
+		t.Fatalf("%d warnings, want %d: %v", len(warnings), len(tests), warnings)
+	}
+	//The declaration is a related span, not part of the message
+	for i, test := range tests {
+		w := warnings[i]
+		if w.Code != test.code || w.Msg != test.msg || w.Line != test.line {
+			t.Errorf("warning %d is %s %q on line %d, want %s %q on line %d", i, w.Code, w.Msg, w.Line,
+				test.code, test.msg, test.line)
+		}
+		if len(w.Related) != 1 || w.Related[0] != test.declared {
+			t.Errorf("warning %d is related to %v, want %v", i, w.Related, test.declared)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package pascomp
+
+//////////////////////////Abstract Syntax Tree//////////////////////////
+//The parser produces a tree of the nodes below.  Every name that appears
+//in the tree is stored as its index in the attribute table so that any
+//pass can ask the SymbolTable for its semantic type, data type and label.
+
+// Pos is the position of a node within the source file
+type Pos struct {
+	Line   int
+	Column int // counting characters from 1
+}
+
+// Position() - Returns the position of a node
+func (p Pos) Position() Pos {
+	return p
+}
+
+// Program is the root of the tree
+type Program struct {
+	Pos
+	Name     int // attribute table index of the program name
+	Block    *Block
+	St       *SymbolTable
+	Declared map[int]Pos // where each constant, variable, parameter and procedure was declared
+}
+
+// Block is the body of the program or of a procedure:
+//	the declared variables, any procedures and the statements
+type Block struct {
+	Vars  []int
+	Procs []*Procedure
+	Body  []Stmt
+}
+
+// Procedure is a procedure declaration.  Params holds the attribute
+// table indices of its parameters in the order they were declared
+type Procedure struct {
+	Pos
+	Index  int
+	Params []int
+	Block  *Block
+}
+
+//////////////////////////STATEMENTS//////////////////////////
+
+// Stmt is implemented by every statement node
+type Stmt interface {
+	Position() Pos
+	stmtNode()
+}
+
+// SetStmt	-	SET target = value
+type SetStmt struct {
+	Pos
+	Target int
+	Value  Expr
+}
+
+// ReadStmt	-	READ a, b, c
+type ReadStmt struct {
+	Pos
+	Targets []int
+}
+
+// WriteStmt	-	WRITE expr, expr
+type WriteStmt struct {
+	Pos
+	Values []Expr
+}
+
+// IfStmt	-	IF cond THEN stmts [ELSE stmts] ENDIF
+type IfStmt struct {
+	Pos
+	Cond *Cond
+	Then []Stmt
+	Else []Stmt
+}
+
+// WhileStmt	-	WHILE cond DO stmts ENDWHILE
+type WhileStmt struct {
+	Pos
+	Cond *Cond
+	Body []Stmt
+}
+
+// UntilStmt	-	UNTIL cond DO stmts ENDUNTIL
+//					The condition is tested before each pass and the
+//					loop ends as soon as it is true
+type UntilStmt struct {
+	Pos
+	Cond *Cond
+	Body []Stmt
+}
+
+// CallStmt	-	CALL proc [(args)]
+type CallStmt struct {
+	Pos
+	Proc int
+	Args []Expr
+}
+
+func (*SetStmt) stmtNode()   {}
+func (*ReadStmt) stmtNode()  {}
+func (*WriteStmt) stmtNode() {}
+func (*IfStmt) stmtNode()    {}
+func (*WhileStmt) stmtNode() {}
+func (*UntilStmt) stmtNode() {}
+func (*CallStmt) stmtNode()  {}
+
+//////////////////////////EXPRESSIONS//////////////////////////
+
+// Cond is a relational test.  Op is one of Tokequals, Tokgreater,
+// Tokless or Toknotequal
+type Cond struct {
+	Pos
+	Op          TokenType
+	Left, Right Expr
+}
+
+// Expr is implemented by every expression node
+type Expr interface {
+	Position() Pos
+	Type() DataType
+	exprNode()
+}
+
+// Ident is a use of a variable or parameter
+type Ident struct {
+	Pos
+	Index int
+	Dt    DataType
+}
+
+// Literal is an integer or real constant.  Index points to the
+// literal's entry in the attribute table
+type Literal struct {
+	Pos
+	Index int
+	Dt    DataType
+	Ival  int
+	Rval  float64
+}
+
+// Binary is an arithmetic operation.  Op is one of Tokplus,
+// Tokminus, Tokstar or Tokslash
+type Binary struct {
+	Pos
+	Op          TokenType
+	Left, Right Expr
+	Dt          DataType
+}
+
+// Negate is unary minus
+type Negate struct {
+	Pos
+	X Expr
+}
+
+// Float is the conversion of an integer expression to real which
+// the parser inserts wherever integers and reals are mixed.  It is
+// the _float routine installed in the symbol table
+type Float struct {
+	Pos
+	X Expr
+}
+
+func (e *Ident) Type() DataType   { return e.Dt }
+func (e *Literal) Type() DataType { return e.Dt }
+func (e *Binary) Type() DataType  { return e.Dt }
+func (e *Negate) Type() DataType  { return e.X.Type() }
+func (e *Float) Type() DataType   { return Dtreal }
+
+func (*Ident) exprNode()   {}
+func (*Literal) exprNode() {}
+func (*Binary) exprNode()  {}
+func (*Negate) exprNode()  {}
+func (*Float) exprNode()   {}
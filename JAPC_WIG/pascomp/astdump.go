@@ -0,0 +1,132 @@
+package pascomp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//////////////////////////Tree Dump//////////////////////////
+//Prints the tree the parser built, one node to a line and each node
+//indented under its parent by a tab.  Statements end with the line
+//they started on and expressions with their data type, so the dump
+//shows where the parser inserted conversions to real.
+
+// Dump() - Write the whole tree
+func (prog *Program) Dump(w io.Writer) error {
+	d := &treeDumper{st: prog.St, w: bufio.NewWriter(w)}
+	d.line(0, "program %s\t; line #%d", prog.St.Getlexeme(prog.Name), prog.Line)
+	d.block(1, prog.Block)
+	return d.w.Flush()
+}
+
+type treeDumper struct {
+	st *SymbolTable
+	w  *bufio.Writer
+}
+
+func (d *treeDumper) line(depth int, format string, args ...interface{}) {
+	fmt.Fprintf(d.w, "%s%s\n", strings.Repeat("\t", depth), fmt.Sprintf(format, args...))
+}
+
+// typeName() - A data type as it prints, integer or real
+func typeName(dt DataType) string {
+	return strings.TrimPrefix(dt.String(), "dt")
+}
+
+func (d *treeDumper) block(depth int, block *Block) {
+	for _, v := range block.Vars {
+		d.line(depth, "var %s %s", typeName(d.st.Getdatatype(v)), d.st.Getlexeme(v))
+	}
+	for _, proc := range block.Procs {
+		d.line(depth, "procedure %s\t; line #%d", d.st.Getlexeme(proc.Index), proc.Line)
+		for _, p := range proc.Params {
+			d.line(depth+1, "param %s %s", typeName(d.st.Getdatatype(p)), d.st.Getlexeme(p))
+		}
+		d.block(depth+1, proc.Block)
+	}
+	d.stmts(depth, block.Body)
+}
+
+func (d *treeDumper) stmts(depth int, stmts []Stmt) {
+	for _, stmt := range stmts {
+		d.stmt(depth, stmt)
+	}
+}
+
+func (d *treeDumper) stmt(depth int, stmt Stmt) {
+	at := stmt.Position().Line
+	switch s := stmt.(type) {
+	case *SetStmt:
+		d.line(depth, "set %s\t; line #%d", d.st.Getlexeme(s.Target), at)
+		d.expr(depth+1, s.Value)
+
+	case *ReadStmt:
+		names := make([]string, len(s.Targets))
+		for i, t := range s.Targets {
+			names[i] = d.st.Getlexeme(t)
+		}
+		d.line(depth, "read %s\t; line #%d", strings.Join(names, ", "), at)
+
+	case *WriteStmt:
+		d.line(depth, "write\t; line #%d", at)
+		for _, v := range s.Values {
+			d.expr(depth+1, v)
+		}
+
+	case *IfStmt:
+		d.line(depth, "if\t; line #%d", at)
+		d.cond(depth+1, s.Cond)
+		d.line(depth, "then")
+		d.stmts(depth+1, s.Then)
+		if s.Else != nil {
+			d.line(depth, "else")
+			d.stmts(depth+1, s.Else)
+		}
+
+	case *WhileStmt:
+		d.line(depth, "while\t; line #%d", at)
+		d.cond(depth+1, s.Cond)
+		d.line(depth, "do")
+		d.stmts(depth+1, s.Body)
+
+	case *UntilStmt:
+		d.line(depth, "until\t; line #%d", at)
+		d.cond(depth+1, s.Cond)
+		d.line(depth, "do")
+		d.stmts(depth+1, s.Body)
+
+	case *CallStmt:
+		d.line(depth, "call %s\t; line #%d", d.st.Getlexeme(s.Proc), at)
+		for _, a := range s.Args {
+			d.expr(depth+1, a)
+		}
+	}
+}
+
+func (d *treeDumper) cond(depth int, cond *Cond) {
+	d.line(depth, "%s", relSymbols[cond.Op])
+	d.expr(depth+1, cond.Left)
+	d.expr(depth+1, cond.Right)
+}
+
+func (d *treeDumper) expr(depth int, expr Expr) {
+	dt := typeName(expr.Type())
+	switch e := expr.(type) {
+	case *Ident:
+		d.line(depth, "%s %s", d.st.Getlexeme(e.Index), dt)
+	case *Literal:
+		d.line(depth, "%s %s", d.st.Getlexeme(e.Index), dt)
+	case *Binary:
+		d.line(depth, "%s %s", map[TokenType]string{Tokplus: "+", Tokminus: "-", Tokstar: "*", Tokslash: "/"}[e.Op], dt)
+		d.expr(depth+1, e.Left)
+		d.expr(depth+1, e.Right)
+	case *Negate:
+		d.line(depth, "neg %s", dt)
+		d.expr(depth+1, e.X)
+	case *Float:
+		d.line(depth, "_float %s", dt)
+		d.expr(depth+1, e.X)
+	}
+}
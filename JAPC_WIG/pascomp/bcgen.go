@@ -0,0 +1,264 @@
+package pascomp
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+//////////////////////////Bytecode Generator//////////////////////////
+//Translates a parsed Program into a Module for the VM.  The main program
+//is emitted first as procedure 0, followed by every declared procedure in
+//order.  Variables owned by the program become global slots; parameters,
+//locals and temporaries owned by a procedure become slots of its frame.
+
+type bcGenerator struct {
+	st      *SymbolTable
+	m       *Module
+	globals map[int]int // attribute table index -> global slot
+	locals  map[int]int // attribute table index -> slot in the current frame
+	procnum map[int]int // attribute table index -> procedure number
+}
+
+// CompileBytecode() - Generate the bytecode module for prog
+func CompileBytecode(prog *Program) *Module {
+	st := prog.St
+	this := &bcGenerator{
+		st:      st,
+		m:       &Module{Name: st.Getlexeme(prog.Name)},
+		procnum: make(map[int]int),
+	}
+
+	this.globals, this.m.Globals = st.frameSlots(prog.Name, nil)
+	this.m.Procs = append(this.m.Procs, BcProc{Name: this.m.Name})
+	for _, proc := range prog.Block.Procs {
+		this.procnum[proc.Index] = len(this.m.Procs)
+		this.m.Procs = append(this.m.Procs, BcProc{
+			Name:   st.Getlexeme(proc.Index),
+			Params: len(proc.Params),
+		})
+	}
+
+	//The main program
+	this.locals = map[int]int{}
+	this.stmts(prog.Block.Body)
+	this.emit(OpHalt)
+
+	for _, proc := range prog.Block.Procs {
+		p := &this.m.Procs[this.procnum[proc.Index]]
+		p.Entry = len(this.m.Code)
+		this.locals, p.SlotNames = st.frameSlots(proc.Index, proc.Params)
+		this.mark(proc.Pos)
+		this.stmts(proc.Block.Body)
+		this.emit(OpRet)
+	}
+	return this.m
+}
+
+// frameSlots() -	Number the variables, parameters and temporaries
+//					owned by a procedure (or the program).  The
+//					parameters come first in the order they are passed,
+//					then everything else in attribute table order.
+func (this *SymbolTable) frameSlots(owner int, params []int) (slots map[int]int, names []string) {
+	slots = make(map[int]int)
+	add := func(tabindex int) {
+		slots[tabindex] = len(names)
+		names = append(names, this.Getlexeme(tabindex))
+	}
+
+	for _, p := range params {
+		add(p)
+	}
+	for i := 0; i < this.attribTabLen; i++ {
+		if this.Getproc(i) != owner {
+			continue
+		}
+		switch this.Getsmclass(i) {
+		case Stvariable, Sttempvar:
+			add(i)
+		case Stparameter:
+			if _, ok := slots[i]; !ok {
+				add(i)
+			}
+		}
+	}
+	return
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Statements and Expressions
+////////////////////////////////////////////////////////////////////
+
+func (this *bcGenerator) stmts(stmts []Stmt) {
+	for _, stmt := range stmts {
+		this.stmt(stmt)
+	}
+}
+
+func (this *bcGenerator) stmt(stmt Stmt) {
+	this.mark(stmt.Position())
+
+	switch s := stmt.(type) {
+	case *SetStmt:
+		this.expr(s.Value)
+		this.store(s.Target)
+
+	case *ReadStmt:
+		for _, target := range s.Targets {
+			if this.st.Getdatatype(target) == Dtinteger {
+				this.emit(OpReadi)
+			} else {
+				this.emit(OpReadr)
+			}
+			this.store(target)
+		}
+
+	case *WriteStmt:
+		for i, value := range s.Values {
+			if i > 0 {
+				this.emit(OpWritesp)
+			}
+			this.expr(value)
+			if value.Type() == Dtinteger {
+				this.emit(OpWritei)
+			} else {
+				this.emit(OpWriter)
+			}
+		}
+		this.emit(OpWriteln)
+
+	case *IfStmt:
+		this.cond(s.Cond)
+		toElse := this.jump(OpJmpf)
+		this.stmts(s.Then)
+		if s.Else == nil {
+			this.patch(toElse)
+			break
+		}
+		toEnd := this.jump(OpJmp)
+		this.patch(toElse)
+		this.stmts(s.Else)
+		this.patch(toEnd)
+
+	case *WhileStmt:
+		top := len(this.m.Code)
+		this.cond(s.Cond)
+		exit := this.jump(OpJmpf)
+		this.stmts(s.Body)
+		this.emitArg(OpJmp, top)
+		this.patch(exit)
+
+	case *UntilStmt:
+		top := len(this.m.Code)
+		this.cond(s.Cond)
+		exit := this.jump(OpJmpt)
+		this.stmts(s.Body)
+		this.emitArg(OpJmp, top)
+		this.patch(exit)
+
+	case *CallStmt:
+		for _, arg := range s.Args {
+			this.expr(arg)
+		}
+		this.emitArg(OpCall, this.procnum[s.Proc])
+	}
+}
+
+func (this *bcGenerator) cond(cond *Cond) {
+	this.expr(cond.Left)
+	this.expr(cond.Right)
+
+	ops := map[TokenType]Opcode{Tokequals: OpEqi, Tokgreater: OpGti, Tokless: OpLti, Toknotequal: OpNei}
+	if cond.Left.Type() == Dtreal {
+		ops = map[TokenType]Opcode{Tokequals: OpEqr, Tokgreater: OpGtr, Tokless: OpLtr, Toknotequal: OpNer}
+	}
+	this.emit(ops[cond.Op])
+}
+
+func (this *bcGenerator) expr(expr Expr) {
+	switch e := expr.(type) {
+	case *Ident:
+		this.mark(e.Pos)
+		if slot, ok := this.locals[e.Index]; ok {
+			this.emitArg(OpLoadl, slot)
+		} else {
+			this.emitArg(OpLoadg, this.globals[e.Index])
+		}
+
+	case *Literal:
+		var buf [8]byte
+		if e.Dt == Dtinteger {
+			binary.LittleEndian.PutUint64(buf[:], uint64(int64(e.Ival)))
+			this.m.Code = append(append(this.m.Code, byte(OpPushi)), buf[:]...)
+		} else {
+			binary.LittleEndian.PutUint64(buf[:], math.Float64bits(e.Rval))
+			this.m.Code = append(append(this.m.Code, byte(OpPushr)), buf[:]...)
+		}
+
+	case *Negate:
+		this.expr(e.X)
+		if e.Type() == Dtinteger {
+			this.emit(OpNegi)
+		} else {
+			this.emit(OpNegr)
+		}
+
+	case *Float:
+		this.expr(e.X)
+		this.emit(OpItor)
+
+	case *Binary:
+		this.expr(e.Left)
+		this.expr(e.Right)
+		ops := map[TokenType]Opcode{Tokplus: OpAddi, Tokminus: OpSubi, Tokstar: OpMuli, Tokslash: OpDivi}
+		if e.Dt == Dtreal {
+			ops = map[TokenType]Opcode{Tokplus: OpAddr, Tokminus: OpSubr, Tokstar: OpMulr, Tokslash: OpDivr}
+		}
+		//Division can fail so make sure it reports its own line
+		this.mark(e.Pos)
+		this.emit(ops[e.Op])
+	}
+}
+
+func (this *bcGenerator) store(tabindex int) {
+	if slot, ok := this.locals[tabindex]; ok {
+		this.emitArg(OpStorel, slot)
+	} else {
+		this.emitArg(OpStoreg, this.globals[tabindex])
+	}
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Emitting Code
+////////////////////////////////////////////////////////////////////
+
+// mark() -	Record that the code emitted next belongs to pos's line
+func (this *bcGenerator) mark(pos Pos) {
+	lines := this.m.Lines
+	if n := len(lines); n > 0 && lines[n-1].Line == pos.Line {
+		return
+	}
+	this.m.Lines = append(lines, BcLine{Pc: len(this.m.Code), Line: pos.Line})
+}
+
+func (this *bcGenerator) emit(op Opcode) {
+	this.m.Code = append(this.m.Code, byte(op))
+}
+
+func (this *bcGenerator) emitArg(op Opcode, arg int) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], uint32(int32(arg)))
+	this.m.Code = append(append(this.m.Code, byte(op)), buf[:]...)
+}
+
+// jump() -	Emit a jump whose target is not known yet and
+//			return its address so it can be patched
+func (this *bcGenerator) jump(op Opcode) int {
+	at := len(this.m.Code)
+	this.emitArg(op, 0)
+	return at
+}
+
+// patch() - Point the jump at address at to the next instruction
+func (this *bcGenerator) patch(at int) {
+	binary.LittleEndian.PutUint32(this.m.Code[at+1:], uint32(len(this.m.Code)))
+}
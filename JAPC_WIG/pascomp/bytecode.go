@@ -0,0 +1,463 @@
+package pascomp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+//////////////////////////Bytecode Format//////////////////////////
+//A compiled program is a Module: one flat code array shared by the main
+//program and every procedure, a table describing each procedure's frame
+//and a line table used to report runtime errors.  Each instruction is a
+//one byte opcode followed by its operand, if any:
+//	PUSHI			8 byte integer
+//	PUSHR			8 byte IEEE real
+//	everything else	4 byte slot, procedure number or code address
+
+type Opcode byte
+
+const (
+	OpHalt Opcode = iota
+	OpPushi
+	OpPushr
+	OpLoadg  // push a global slot
+	OpStoreg // pop into a global slot
+	OpLoadl  // push a slot of the current frame
+	OpStorel // pop into a slot of the current frame
+	OpAddi
+	OpSubi
+	OpMuli
+	OpDivi
+	OpNegi
+	OpAddr
+	OpSubr
+	OpMulr
+	OpDivr
+	OpNegr
+	OpItor // convert the integer on top of the stack to real
+	OpEqi
+	OpGti
+	OpLti
+	OpNei
+	OpEqr
+	OpGtr
+	OpLtr
+	OpNer
+	OpJmp
+	OpJmpf // pop and jump if false
+	OpJmpt // pop and jump if true
+	OpCall // call a procedure by number
+	OpRet
+	OpReadi // read an integer from input and push it
+	OpReadr
+	OpWritei // pop and print
+	OpWriter
+	OpWritesp // print the space between values
+	OpWriteln
+)
+
+var opcodeNames = [...]string{"HALT",
+	"PUSHI", "PUSHR", "LOADG", "STOREG", "LOADL", "STOREL",
+	"ADDI", "SUBI", "MULI", "DIVI", "NEGI",
+	"ADDR", "SUBR", "MULR", "DIVR", "NEGR", "ITOR",
+	"EQI", "GTI", "LTI", "NEI", "EQR", "GTR", "LTR", "NER",
+	"JMP", "JMPF", "JMPT", "CALL", "RET",
+	"READI", "READR", "WRITEI", "WRITER", "WRITESP", "WRITELN"}
+
+func (op Opcode) String() string {
+	if int(op) < len(opcodeNames) {
+		return opcodeNames[op]
+	}
+	return fmt.Sprintf("OP%d", byte(op))
+}
+
+// operandSize() - The number of operand bytes following an opcode
+func (op Opcode) operandSize() int {
+	switch op {
+	case OpPushi, OpPushr:
+		return 8
+	case OpLoadg, OpStoreg, OpLoadl, OpStorel, OpJmp, OpJmpf, OpJmpt, OpCall:
+		return 4
+	}
+	return 0
+}
+
+// BcProc describes the frame of one procedure.  Procedure 0 is the main
+// program whose variables live in the global slots instead.
+type BcProc struct {
+	Name      string
+	Entry     int
+	Params    int
+	SlotNames []string // one per frame slot, parameters first
+}
+
+// BcLine maps the first instruction generated for a line to that line
+type BcLine struct {
+	Pc, Line int
+}
+
+type Module struct {
+	Name    string
+	Globals []string
+	Procs   []BcProc
+	Code    []byte
+	Lines   []BcLine
+}
+
+// bcMagic starts every bytecode file, followed by the format version
+var bcMagic = [4]byte{'J', 'P', 'B', 'C'}
+
+const bcVersion = 1
+
+// LineAt() -	The source line of the instruction at pc, or 0
+//				if there is none
+func (this *Module) LineAt(pc int) int {
+	line := 0
+	for _, l := range this.Lines {
+		if l.Pc > pc {
+			break
+		}
+		line = l.Line
+	}
+	return line
+}
+
+// operand() - Decode the 4 byte operand of the instruction at pc
+func (this *Module) operand(pc int) int {
+	return int(int32(binary.LittleEndian.Uint32(this.Code[pc+1:])))
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Reading and Writing Modules
+////////////////////////////////////////////////////////////////////
+
+// WriteTo() - Write the module in the bytecode file format
+func (this *Module) WriteTo(w io.Writer) (int64, error) {
+	bw := &bcWriter{w: bufio.NewWriter(w)}
+	bw.bytes(bcMagic[:])
+	bw.uint(bcVersion)
+	bw.string(this.Name)
+	bw.strings(this.Globals)
+	bw.uint(len(this.Procs))
+	for _, p := range this.Procs {
+		bw.string(p.Name)
+		bw.uint(p.Entry)
+		bw.uint(p.Params)
+		bw.strings(p.SlotNames)
+	}
+	bw.uint(len(this.Lines))
+	for _, l := range this.Lines {
+		bw.uint(l.Pc)
+		bw.uint(l.Line)
+	}
+	bw.uint(len(this.Code))
+	bw.bytes(this.Code)
+	if bw.err == nil {
+		bw.err = bw.w.Flush()
+	}
+	return bw.n, bw.err
+}
+
+// ReadModule() - Read a module written by WriteTo
+func ReadModule(r io.Reader) (*Module, error) {
+	br := &bcReader{r: bufio.NewReader(r)}
+	var magic [4]byte
+	br.bytes(magic[:])
+	if br.err == nil && magic != bcMagic {
+		return nil, errors.New("not a bytecode file")
+	}
+	if v := br.uint(); br.err == nil && v != bcVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d", v)
+	}
+
+	m := new(Module)
+	m.Name = br.string()
+	m.Globals = br.strings()
+	m.Procs = make([]BcProc, br.count())
+	for i := range m.Procs {
+		m.Procs[i].Name = br.string()
+		m.Procs[i].Entry = br.uint()
+		m.Procs[i].Params = br.uint()
+		m.Procs[i].SlotNames = br.strings()
+	}
+	m.Lines = make([]BcLine, br.count())
+	for i := range m.Lines {
+		m.Lines[i].Pc = br.uint()
+		m.Lines[i].Line = br.uint()
+	}
+	m.Code = make([]byte, br.count())
+	br.bytes(m.Code)
+	if br.err == nil {
+		br.err = m.verify()
+	}
+	if br.err != nil {
+		return nil, fmt.Errorf("corrupt bytecode file: %v", br.err)
+	}
+	return m, nil
+}
+
+// verify() -	Check that every instruction decodes, that its operand
+//				names a real slot, procedure or instruction of its own
+//				procedure, and that the stack is never popped below
+//				what the procedure pushed, so that the VM never has to
+func (this *Module) verify() error {
+	if len(this.Procs) == 0 {
+		return errors.New("no main program")
+	}
+	starts := make(map[int]bool)
+	for i, p := range this.Procs {
+		end := this.procEnd(i)
+		if p.Entry < 0 || p.Entry >= end || p.Params > len(p.SlotNames) {
+			return fmt.Errorf("bad procedure %s", p.Name)
+		}
+		var op Opcode
+		for pc := p.Entry; pc < end; pc += 1 + op.operandSize() {
+			starts[pc] = true
+			op = Opcode(this.Code[pc])
+			if int(op) >= len(opcodeNames) || pc+op.operandSize() >= end {
+				return fmt.Errorf("bad instruction at %04d", pc)
+			}
+			var limit int
+			switch op {
+			case OpLoadg, OpStoreg:
+				limit = len(this.Globals)
+			case OpLoadl, OpStorel:
+				limit = len(p.SlotNames)
+			case OpCall:
+				limit = len(this.Procs)
+			case OpJmp, OpJmpf, OpJmpt:
+				limit = len(this.Code)
+			case OpRet:
+				//The main program has no caller to return to
+				if i == 0 {
+					return fmt.Errorf("return from the main program at %04d", pc)
+				}
+				continue
+			default:
+				continue
+			}
+			if n := this.operand(pc); n < 0 || n >= limit {
+				return fmt.Errorf("operand out of range at %04d", pc)
+			}
+		}
+		//Execution must never run off the end of a procedure
+		if op != OpHalt && op != OpRet && op != OpJmp {
+			return fmt.Errorf("procedure %s does not end in a return", p.Name)
+		}
+	}
+	for i := range this.Procs {
+		if err := this.verifyStack(i, starts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// procEnd() - Where procedure i's code ends and the next one's begins
+func (this *Module) procEnd(i int) int {
+	if i+1 < len(this.Procs) {
+		return this.Procs[i+1].Entry
+	}
+	return len(this.Code)
+}
+
+// verifyStack() -	Follow every path through procedure i from its entry
+//					counting the values on the stack, checking that each
+//					jump lands on an instruction of the procedure, that
+//					no instruction pops more than the procedure pushed,
+//					and that every way to an instruction leaves the
+//					stack as deep
+func (this *Module) verifyStack(i int, starts map[int]bool) error {
+	p := this.Procs[i]
+	end := this.procEnd(i)
+	depths := map[int]int{p.Entry: 0}
+	work := []int{p.Entry}
+	for len(work) > 0 {
+		pc := work[len(work)-1]
+		work = work[:len(work)-1]
+		op := Opcode(this.Code[pc])
+		pops, pushes := this.stackEffect(pc)
+		depth := depths[pc]
+		if depth < pops {
+			return fmt.Errorf("stack underflow at %04d", pc)
+		}
+		depth += pushes - pops
+
+		var next []int
+		switch op {
+		case OpHalt, OpRet:
+		case OpJmp:
+			next = []int{this.operand(pc)}
+		case OpJmpf, OpJmpt:
+			next = []int{pc + 1 + op.operandSize(), this.operand(pc)}
+		default:
+			next = []int{pc + 1 + op.operandSize()}
+		}
+		for _, to := range next {
+			if to < p.Entry || to >= end || !starts[to] {
+				return fmt.Errorf("jump outside the instructions of %s at %04d", p.Name, pc)
+			}
+			if seen, ok := depths[to]; !ok {
+				depths[to] = depth
+				work = append(work, to)
+			} else if seen != depth {
+				return fmt.Errorf("stack depths %d and %d meet at %04d", seen, depth, to)
+			}
+		}
+	}
+	return nil
+}
+
+// stackEffect() -	How many values the instruction at pc pops and then
+//					pushes
+func (this *Module) stackEffect(pc int) (pops, pushes int) {
+	switch Opcode(this.Code[pc]) {
+	case OpHalt, OpJmp, OpRet, OpWritesp, OpWriteln:
+		return 0, 0
+	case OpPushi, OpPushr, OpLoadg, OpLoadl, OpReadi, OpReadr:
+		return 0, 1
+	case OpStoreg, OpStorel, OpJmpf, OpJmpt, OpWritei, OpWriter:
+		return 1, 0
+	case OpNegi, OpNegr, OpItor:
+		return 1, 1
+	case OpCall:
+		return this.Procs[this.operand(pc)].Params, 0
+	}
+	//The arithmetic and relational operators
+	return 2, 1
+}
+
+type bcWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (this *bcWriter) bytes(b []byte) {
+	if this.err == nil {
+		var n int
+		n, this.err = this.w.Write(b)
+		this.n += int64(n)
+	}
+}
+
+func (this *bcWriter) uint(v int) {
+	var buf [binary.MaxVarintLen64]byte
+	this.bytes(buf[:binary.PutUvarint(buf[:], uint64(v))])
+}
+
+func (this *bcWriter) string(s string) {
+	this.uint(len(s))
+	this.bytes([]byte(s))
+}
+
+func (this *bcWriter) strings(list []string) {
+	this.uint(len(list))
+	for _, s := range list {
+		this.string(s)
+	}
+}
+
+type bcReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (this *bcReader) bytes(b []byte) {
+	if this.err == nil {
+		_, this.err = io.ReadFull(this.r, b)
+	}
+}
+
+func (this *bcReader) uint() int {
+	if this.err != nil {
+		return 0
+	}
+	var v uint64
+	v, this.err = binary.ReadUvarint(this.r)
+	return int(v)
+}
+
+// count() - Read a length, refusing ones larger than any sane file
+func (this *bcReader) count() int {
+	n := this.uint()
+	if n > 1<<24 {
+		this.err = errors.New("length out of range")
+		return 0
+	}
+	return n
+}
+
+func (this *bcReader) string() string {
+	b := make([]byte, this.count())
+	this.bytes(b)
+	return string(b)
+}
+
+func (this *bcReader) strings() []string {
+	list := make([]string, this.count())
+	for i := range list {
+		list[i] = this.string()
+	}
+	return list
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Disassembler
+////////////////////////////////////////////////////////////////////
+
+// Disassemble() -	Write a listing of the module with one instruction
+//					per line, naming the slot each load and store uses
+func (this *Module) Disassemble(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "; program %s, %d globals, %d bytes of code\n", this.Name, len(this.Globals), len(this.Code))
+	for i, name := range this.Globals {
+		fmt.Fprintf(bw, ";   global %d = %s\n", i, name)
+	}
+
+	//Each procedure runs from its entry to the next one's
+	for i, p := range this.Procs {
+		end := this.procEnd(i)
+		fmt.Fprintf(bw, "\n%s:\t\t\t; proc %d, %d params, %d slots\n", p.Name, i, p.Params, len(p.SlotNames))
+
+		line := 0
+		for pc := p.Entry; pc < end; pc += 1 + Opcode(this.Code[pc]).operandSize() {
+			op := Opcode(this.Code[pc])
+
+			var operand, comment string
+			switch op {
+			case OpPushi:
+				operand = fmt.Sprint(int64(binary.LittleEndian.Uint64(this.Code[pc+1:])))
+			case OpPushr:
+				operand = fmt.Sprint(math.Float64frombits(binary.LittleEndian.Uint64(this.Code[pc+1:])))
+			case OpLoadg, OpStoreg:
+				operand, comment = fmt.Sprint(this.operand(pc)), this.Globals[this.operand(pc)]
+			case OpLoadl, OpStorel:
+				operand, comment = fmt.Sprint(this.operand(pc)), p.SlotNames[this.operand(pc)]
+			case OpJmp, OpJmpf, OpJmpt:
+				operand = fmt.Sprintf("%04d", this.operand(pc))
+			case OpCall:
+				operand, comment = fmt.Sprint(this.operand(pc)), this.Procs[this.operand(pc)].Name
+			}
+			if l := this.LineAt(pc); l != line {
+				line = l
+				if comment != "" {
+					comment += ", "
+				}
+				comment += fmt.Sprintf("line %d", l)
+			}
+
+			text := fmt.Sprintf("  %04d  %-8s%s", pc, op, operand)
+			if comment != "" {
+				text = fmt.Sprintf("%-24s; %s", text, comment)
+			}
+			fmt.Fprintln(bw, strings.TrimRight(text, " "))
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,91 @@
+package pascomp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// bcCode() -	Assemble instructions given as opcodes each followed by
+//				its 4 byte operand, if it has one
+func bcCode(words ...int) []byte {
+	var code []byte
+	for i := 0; i < len(words); i++ {
+		op := Opcode(words[i])
+		code = append(code, byte(op))
+		if op.operandSize() == 4 {
+			i++
+			code = binary.LittleEndian.AppendUint32(code, uint32(int32(words[i])))
+		}
+	}
+	return code
+}
+
+// roundTrip() - Write a module and read it back
+func roundTrip(t *testing.T, m *Module) (*Module, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return ReadModule(&buf)
+}
+
+func TestReadModule(t *testing.T) {
+	m, err := roundTrip(t, CompileBytecode(parseSource(t, factProgram)))
+	if err != nil {
+		t.Fatalf("the compiled sample does not verify: %v", err)
+	}
+	var out bytes.Buffer
+	if err := NewVM(m, strings.NewReader("5"), &out).Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "5 15\n3\n120\n" {
+		t.Errorf("the sample wrote %q", got)
+	}
+}
+
+func TestVerifyStack(t *testing.T) {
+	const x = 0 // the one global
+	proc := BcProc{Name: "P", Params: 1, SlotNames: []string{"K"}}
+	tests := []struct {
+		name string
+		main []int
+		proc []int // the code of P, if the module has it
+		err  string
+	}{
+		{"valid", []int{int(OpPushi), 0, int(OpStoreg), x, int(OpLoadg), x, int(OpWritei), int(OpHalt)}, nil, ""},
+		{"pop an empty stack", []int{int(OpWriteln), int(OpWritei), int(OpHalt)}, nil, "underflow at 0001"},
+		{"add one value", []int{int(OpLoadg), x, int(OpAddi), int(OpHalt)}, nil, "underflow at 0005"},
+		{"branch on nothing", []int{int(OpJmpf), 0, int(OpHalt)}, nil, "underflow at 0000"},
+		{"return from main", []int{int(OpRet)}, nil, "return from the main program"},
+		{"call without arguments", []int{int(OpCall), 1, int(OpHalt)}, []int{int(OpRet)}, "underflow at 0000"},
+		{"pop the caller's values", []int{int(OpLoadg), x, int(OpLoadg), x, int(OpCall), 1, int(OpHalt)},
+			[]int{int(OpStorel), 0, int(OpStorel), 0, int(OpRet)}, "underflow at 0016"},
+		{"jump out of a procedure", []int{int(OpLoadg), x, int(OpCall), 1, int(OpHalt)},
+			[]int{int(OpJmp), 10, int(OpRet)}, "outside the instructions of P"},
+		{"jump into a procedure", []int{int(OpJmp), 6, int(OpHalt)}, []int{int(OpRet)}, "outside the instructions of MAIN"},
+		//A loop that pushes each time round would grow the stack
+		{"push in a loop", []int{int(OpLoadg), x, int(OpJmp), 0}, nil, "stack depths 0 and 1 meet at 0000"},
+		{"valid loop", []int{int(OpLoadg), x, int(OpJmpt), 0, int(OpHalt)}, nil, ""},
+	}
+	for _, test := range tests {
+		m := &Module{Name: "T", Globals: []string{"X"}, Procs: []BcProc{{Name: "MAIN"}}, Code: bcCode(test.main...)}
+		if test.proc != nil {
+			p := proc
+			p.Entry = len(m.Code)
+			m.Procs = append(m.Procs, p)
+			m.Code = append(m.Code, bcCode(test.proc...)...)
+		}
+		_, err := roundTrip(t, m)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		case test.err != "" && err == nil:
+			t.Errorf("%s: the module verified, want an error about %q", test.name, test.err)
+		case err != nil && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%s: error %q, want one about %q", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package pascomp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//////////////////////////Control Flow Graph//////////////////////////
+//The basic blocks of a procedure and the jumps between them.  Each block
+//is named by a Stlabel entry: the label it starts with, or a new _loopN
+//label from Installtemp for a block the code falls into.  Dominators are
+//found with the iterative algorithm of Cooper, Harvey and Kennedy over
+//the blocks in reverse postorder, and dominance frontiers from them;
+//ssa.go uses both to place phi nodes.  Blocks no path from the entry
+//reaches have no immediate dominator.
+
+// CFG is the control flow graph of one procedure
+type CFG struct {
+	ir     *IrProgram
+	Proc   *IrProc
+	Blocks []*BasicBlock // in code order; Blocks[0] is the entry
+	order  []*BasicBlock // the reachable blocks in reverse postorder
+	ssa    bool          // whether ToSSA has run
+}
+
+// BasicBlock is straight line code entered only at the top
+type BasicBlock struct {
+	Index        int
+	Label        int    // the Stlabel entry naming the block
+	Code         []Quad // the block's quadruples without its label
+	Succs, Preds []*BasicBlock
+	Idom         *BasicBlock   // the immediate dominator
+	Children     []*BasicBlock // the blocks it immediately dominates
+	Frontier     []*BasicBlock // the dominance frontier
+	Phis         []*Phi        // set by ToSSA
+	SSA          []SSAQuad     // the code in SSA form, set by ToSSA
+	rpo          int           // the position in reverse postorder, -1 if unreachable
+}
+
+// BuildCFG() -	Split a procedure into basic blocks, link them and
+//				compute their dominators and dominance frontiers
+func BuildCFG(ir *IrProgram, p *IrProc) *CFG {
+	this := &CFG{ir: ir, Proc: p}
+	spans := irBlocks(p)
+	for i, span := range spans {
+		b := &BasicBlock{Index: i, Label: -1, rpo: -1}
+		code := p.Code[span.start:span.end]
+		if code[0].Op == IrLabel {
+			b.Label, code = code[0].Result, code[1:]
+		} else {
+			b.Label = ir.St.Installtemp(p.Index, Stlabel, Dtnone)
+		}
+		b.Code = code
+		this.Blocks = append(this.Blocks, b)
+	}
+	for i, span := range spans {
+		for _, s := range span.succs {
+			this.Blocks[i].Succs = append(this.Blocks[i].Succs, this.Blocks[s])
+			this.Blocks[s].Preds = append(this.Blocks[s].Preds, this.Blocks[i])
+		}
+	}
+	if len(this.Blocks) > 0 {
+		this.dominators()
+	}
+	return this
+}
+
+// Name() - The _loopN label a block prints with
+func (this *CFG) Name(b *BasicBlock) string {
+	return this.ir.Operand(b.Label)
+}
+
+// Dominates() - Whether every path from the entry to b passes through a
+func (this *CFG) Dominates(a, b *BasicBlock) bool {
+	if b.rpo < 0 {
+		return false
+	}
+	for ; b != nil; b = b.Idom {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Dominators
+////////////////////////////////////////////////////////////////////
+
+func (this *CFG) dominators() {
+	//Number the reachable blocks in reverse postorder
+	visited := make([]bool, len(this.Blocks))
+	var post []*BasicBlock
+	var visit func(b *BasicBlock)
+	visit = func(b *BasicBlock) {
+		visited[b.Index] = true
+		for _, s := range b.Succs {
+			if !visited[s.Index] {
+				visit(s)
+			}
+		}
+		post = append(post, b)
+	}
+	visit(this.Blocks[0])
+	for i := len(post) - 1; i >= 0; i-- {
+		post[i].rpo = len(this.order)
+		this.order = append(this.order, post[i])
+	}
+
+	entry := this.order[0]
+	entry.Idom = entry
+	intersect := func(a, b *BasicBlock) *BasicBlock {
+		for a != b {
+			for a.rpo > b.rpo {
+				a = a.Idom
+			}
+			for b.rpo > a.rpo {
+				b = b.Idom
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, b := range this.order[1:] {
+			var idom *BasicBlock
+			for _, p := range b.Preds {
+				if p.Idom == nil {
+					continue
+				}
+				if idom == nil {
+					idom = p
+				} else {
+					idom = intersect(p, idom)
+				}
+			}
+			if b.Idom != idom {
+				b.Idom, changed = idom, true
+			}
+		}
+	}
+	entry.Idom = nil
+
+	for _, b := range this.order[1:] {
+		b.Idom.Children = append(b.Idom.Children, b)
+	}
+
+	//A join is in the frontier of every block on the way up from
+	//each predecessor to the join's immediate dominator
+	for _, b := range this.order {
+		var preds []*BasicBlock
+		for _, p := range b.Preds {
+			if p.rpo >= 0 {
+				preds = append(preds, p)
+			}
+		}
+		if len(preds) < 2 {
+			continue
+		}
+		for _, p := range preds {
+			for runner := p; runner != nil && runner != b.Idom; runner = runner.Idom {
+				if !containsBlock(runner.Frontier, b) {
+					runner.Frontier = append(runner.Frontier, b)
+				}
+			}
+		}
+	}
+}
+
+func containsBlock(blocks []*BasicBlock, b *BasicBlock) bool {
+	for _, x := range blocks {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Graphviz Output
+////////////////////////////////////////////////////////////////////
+
+// WriteDot() -	Write the graphs of every procedure as one Graphviz
+//				digraph with a cluster for each procedure.  A jump
+//				taken on a condition is labelled with whether the
+//				condition held.
+func WriteDot(w io.Writer, graphs []*CFG) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph japc {")
+	fmt.Fprintln(bw, "\tnode [shape=box, fontname=\"monospace\"];")
+	for i, g := range graphs {
+		fmt.Fprintf(bw, "\tsubgraph cluster_%d {\n", i)
+		fmt.Fprintf(bw, "\t\tlabel=%s;\n", dotQuote(g.ir.St.Getlexeme(g.Proc.Index)))
+		for _, b := range g.Blocks {
+			lines := []string{g.Name(b) + ":"}
+			lines = append(lines, g.blockLines(b)...)
+			style := ""
+			if b.rpo < 0 {
+				style = ", style=dashed"
+			}
+			fmt.Fprintf(bw, "\t\t%s [label=%s%s];\n", dotQuote(g.Name(b)),
+				dotQuote(strings.Join(lines, "\\l")+"\\l"), style)
+		}
+		for _, b := range g.Blocks {
+			for j, s := range b.Succs {
+				label := ""
+				if last := b.Code; len(last) > 0 {
+					switch q := last[len(last)-1]; q.Op {
+					case IrIf, IrIffalse:
+						taken := j == 0
+						label = fmt.Sprintf(" [label=\"%t\"]", taken == (q.Op == IrIf))
+					}
+				}
+				fmt.Fprintf(bw, "\t\t%s -> %s%s;\n", dotQuote(g.Name(b)), dotQuote(g.Name(s)), label)
+			}
+		}
+		fmt.Fprintln(bw, "\t}")
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// blockLines() -	A block's phi nodes and quadruples as they print,
+//					in SSA form once ToSSA has run
+func (this *CFG) blockLines(b *BasicBlock) (lines []string) {
+	if !this.ssa || b.rpo < 0 {
+		for _, q := range b.Code {
+			lines = append(lines, "  "+this.ir.Format(q))
+		}
+		return
+	}
+	for _, phi := range b.Phis {
+		lines = append(lines, "  "+this.formatPhi(phi))
+	}
+	for _, q := range b.SSA {
+		lines = append(lines, "  "+this.formatSSA(q))
+	}
+	return
+}
+
+// dotQuote() - A Graphviz string; \l line breaks are left alone
+func dotQuote(s string) string {
+	return "\"" + strings.NewReplacer("\"", "\\\"").Replace(s) + "\""
+}
@@ -0,0 +1,150 @@
+package pascomp
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// An IF joining before a WHILE loop
+const flowProgram = `PROGRAM Flow;
+	DECLARE INTEGER i, n, total;
+BEGIN
+	READ n;
+	SET total = 0;
+	IF n > 10 THEN
+		SET total = 1
+	ELSE
+		SET n = 10
+	ENDIF;
+	SET i = 0;
+	WHILE i < n DO
+		SET total = total + i;
+		SET i = i + 1
+	ENDWHILE;
+	WRITE total
+END.
+`
+
+// flowGraph() - The control flow graph of flowProgram's main program
+func flowGraph(t *testing.T) *CFG {
+	t.Helper()
+	ir := GenerateIR(parseSource(t, flowProgram))
+	return BuildCFG(ir, ir.Procs[0])
+}
+
+func TestDominators(t *testing.T) {
+	g := flowGraph(t)
+	//The blocks in code order: the entry, THEN, ELSE, the join, the
+	//loop's test, its body and the exit
+	tests := []struct {
+		idom     int // -1 for the entry
+		frontier string
+	}{
+		{-1, "[]"}, {0, "[3]"}, {0, "[3]"}, {0, "[]"}, {3, "[4]"}, {4, "[4]"}, {4, "[]"},
+	}
+	if len(g.Blocks) != len(tests) {
+		t.Fatalf("%d blocks, want %d", len(g.Blocks), len(tests))
+	}
+	for i, test := range tests {
+		b := g.Blocks[i]
+		idom := -1
+		if b.Idom != nil {
+			idom = b.Idom.Index
+		}
+		var frontier []int
+		for _, f := range b.Frontier {
+			frontier = append(frontier, f.Index)
+		}
+		if idom != test.idom || fmt.Sprint(frontier) != test.frontier {
+			t.Errorf("block %d has idom %d and frontier %v, want %d and %s", i, idom, frontier,
+				test.idom, test.frontier)
+		}
+	}
+
+	dominates := []struct {
+		a, b int
+		want bool
+	}{
+		{0, 6, true}, {3, 5, true}, {4, 4, true}, {4, 6, true},
+		{1, 3, false}, {2, 3, false}, {5, 4, false}, {5, 6, false}, {6, 0, false},
+	}
+	for _, test := range dominates {
+		if got := g.Dominates(g.Blocks[test.a], g.Blocks[test.b]); got != test.want {
+			t.Errorf("Dominates(%d, %d) = %t, want %t", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestToSSA(t *testing.T) {
+	//The IF's join merges both names it assigns and the loop's test the
+	//two its body does
+	const want = `program FLOW
+_loop47:	; preds -; idom -; frontier -
+	read N.1
+	TOTAL.1 := 0
+	iffalse N.1 > 10 goto _loop43
+_loop48:	; preds _loop47; idom _loop47; frontier _loop44
+	TOTAL.2 := 1
+	goto _loop44
+_loop43:	; preds _loop47; idom _loop47; frontier _loop44
+	N.2 := 10
+_loop44:	; preds _loop48 _loop43; idom _loop47; frontier -
+	N.3 := phi(N.1, N.2)
+	TOTAL.3 := phi(TOTAL.2, TOTAL.1)
+	I.1 := 0
+_loop45:	; preds _loop44 _loop49; idom _loop44; frontier _loop45
+	TOTAL.4 := phi(TOTAL.3, TOTAL.5)
+	I.2 := phi(I.1, I.3)
+	iffalse I.2 < N.3 goto _loop46
+_loop49:	; preds _loop45; idom _loop45; frontier _loop45
+	TOTAL.5 := TOTAL.4 + I.2
+	I.3 := I.2 + 1
+	goto _loop45
+_loop46:	; preds _loop45; idom _loop45; frontier -
+	write TOTAL.4
+	writeln
+	return
+`
+	g := flowGraph(t)
+	g.ToSSA()
+	var out bytes.Buffer
+	if err := g.Dump(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Errorf("the SSA form is\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestWriteDot(t *testing.T) {
+	const want = `digraph japc {
+	node [shape=box, fontname="monospace"];
+	subgraph cluster_0 {
+		label="FLOW";
+		"_loop47" [label="_loop47:\l  read N\l  TOTAL := 0\l  iffalse N > 10 goto _loop43\l"];
+		"_loop48" [label="_loop48:\l  TOTAL := 1\l  goto _loop44\l"];
+		"_loop43" [label="_loop43:\l  N := 10\l"];
+		"_loop44" [label="_loop44:\l  I := 0\l"];
+		"_loop45" [label="_loop45:\l  iffalse I < N goto _loop46\l"];
+		"_loop49" [label="_loop49:\l  TOTAL := TOTAL + I\l  I := I + 1\l  goto _loop45\l"];
+		"_loop46" [label="_loop46:\l  write TOTAL\l  writeln\l  return\l"];
+		"_loop47" -> "_loop43" [label="false"];
+		"_loop47" -> "_loop48" [label="true"];
+		"_loop48" -> "_loop44";
+		"_loop43" -> "_loop44";
+		"_loop44" -> "_loop45";
+		"_loop45" -> "_loop46" [label="false"];
+		"_loop45" -> "_loop49" [label="true"];
+		"_loop49" -> "_loop45";
+	}
+}
+`
+	var out bytes.Buffer
+	if err := WriteDot(&out, []*CFG{flowGraph(t)}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Errorf("the graph is\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,398 @@
+package pascomp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+//////////////////////////C Code Generator//////////////////////////
+//Translates a parsed Program into a single portable C99 file.  The tree
+//is used rather than the quadruples so that loops and conditionals stay
+//loops and conditionals.  Names keep the spelling they were first written
+//with and every one gets an underscore appended, so that none can clash
+//with a C keyword or anything the headers declare; the helpers cannot
+//clash either since Pascal names never contain one.  Integers are int32_t
+//and reals double.  C leaves signed overflow undefined, so integer arithmetic
+//goes through small japc_ helpers that wrap around at 32 bits like the
+//interpreter; division, reading and their runtime errors do too.  The
+//helpers are written at the top of the file.
+
+type cGenerator struct {
+	st     *SymbolTable
+	w      *bytes.Buffer
+	indent int
+	used   map[string]bool // the helpers the program calls
+}
+
+// The headers and types every translated program starts with
+const cPrologue = `#include <errno.h>
+#include <inttypes.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+typedef int32_t integer;
+typedef double real;
+`
+
+// The runtime helpers in the order they are written.  Only the ones a
+// program uses are included, along with the ones they depend on.
+var cHelpers = []struct{ name, code string }{
+	{"japc_error", `
+static void japc_error(int line, const char *msg, const char *word)
+{
+	fflush(stdout);
+	if (word != NULL)
+		fprintf(stderr, "runtime error: \"%s\" is not a valid number on line #%d\n", word, line);
+	else
+		fprintf(stderr, "runtime error: %s on line #%d\n", msg, line);
+	exit(1);
+}
+`},
+	{"japc_word", `
+static const char *japc_word(int line)
+{
+	static char word[256];
+	if (scanf("%255s", word) != 1)
+		japc_error(line, "no input left to read", NULL);
+	return word;
+}
+`},
+	{"japc_read_integer", `
+static integer japc_read_integer(int line)
+{
+	const char *word = japc_word(line);
+	char *end;
+	long long v;
+
+	errno = 0;
+	v = strtoll(word, &end, 10);
+	if (*end != '\0' || errno != 0 || v < INT32_MIN || v > INT32_MAX)
+		japc_error(line, NULL, word);
+	return (integer)v;
+}
+`},
+	{"japc_read_real", `
+static real japc_read_real(int line)
+{
+	const char *word = japc_word(line);
+	char *end;
+	real v = strtod(word, &end);
+
+	if (*end != '\0')
+		japc_error(line, NULL, word);
+	return v;
+}
+`},
+	{"japc_add", `
+static integer japc_add(integer x, integer y)
+{
+	return (integer)((uint32_t)x + (uint32_t)y);
+}
+`},
+	{"japc_sub", `
+static integer japc_sub(integer x, integer y)
+{
+	return (integer)((uint32_t)x - (uint32_t)y);
+}
+`},
+	{"japc_mul", `
+static integer japc_mul(integer x, integer y)
+{
+	return (integer)((uint32_t)x * (uint32_t)y);
+}
+`},
+	{"japc_neg", `
+static integer japc_neg(integer x)
+{
+	return (integer)(0u - (uint32_t)x);
+}
+`},
+	{"japc_divide", `
+static integer japc_divide(integer x, integer y, int line)
+{
+	if (y == 0)
+		japc_error(line, "division by zero", NULL);
+	/* The one quotient too big to fit wraps around */
+	if (y == -1)
+		return japc_neg(x);
+	return x / y;
+}
+`},
+	{"japc_rdivide", `
+static real japc_rdivide(real x, real y, int line)
+{
+	if (y == 0)
+		japc_error(line, "division by zero", NULL);
+	return x / y;
+}
+`},
+}
+
+// GenerateC() - Write the program as a C99 source file to w
+func GenerateC(prog *Program, w io.Writer) error {
+	this := &cGenerator{st: prog.St, w: new(bytes.Buffer), used: make(map[string]bool)}
+
+	if len(prog.Block.Vars) > 0 {
+		fmt.Fprintln(this.w)
+		this.vars(prog.Block.Vars, "static ")
+	}
+
+	for _, proc := range prog.Block.Procs {
+		params := make([]string, len(proc.Params))
+		for i, p := range proc.Params {
+			params[i] = this.ctype(p) + " " + this.name(p)
+		}
+		if len(params) == 0 {
+			params = []string{"void"}
+		}
+		fmt.Fprintf(this.w, "\nstatic void %s(%s)\n{\n", this.name(proc.Index), strings.Join(params, ", "))
+		this.indent = 1
+		this.vars(proc.Block.Vars, "")
+		if len(proc.Block.Vars) > 0 && len(proc.Block.Body) > 0 {
+			fmt.Fprintln(this.w)
+		}
+		this.stmts(proc.Block.Body)
+		fmt.Fprintln(this.w, "}")
+	}
+
+	fmt.Fprintf(this.w, "\nint main(void)\n{\n")
+	this.indent = 1
+	this.stmts(prog.Block.Body)
+	this.line("return 0;")
+	fmt.Fprintln(this.w, "}")
+
+	//The helpers are known once the program has been translated
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "/* %s - generated by JAPC */\n", this.st.Getspelling(prog.Name))
+	out.WriteString(cPrologue)
+	for _, helper := range cHelpers {
+		if this.used[helper.name] {
+			out.WriteString(helper.code)
+		}
+	}
+	this.w.WriteTo(out)
+	return out.Flush()
+}
+
+// vars() -	Declare variables one data type per line.  Locals are
+//			zeroed so that programs behave the same every run.
+func (this *cGenerator) vars(vars []int, storage string) {
+	for _, dt := range []DataType{Dtinteger, Dtreal} {
+		var names []string
+		for _, v := range vars {
+			if this.st.Getdatatype(v) == dt {
+				names = append(names, this.name(v)+" = 0")
+			}
+		}
+		if len(names) > 0 {
+			this.line("%s%s %s;", storage, cTypes[dt], strings.Join(names, ", "))
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Statements
+////////////////////////////////////////////////////////////////////
+
+func (this *cGenerator) stmts(stmts []Stmt) {
+	for _, stmt := range stmts {
+		this.stmt(stmt)
+	}
+}
+
+func (this *cGenerator) stmt(stmt Stmt) {
+	line := stmt.Position().Line
+
+	switch s := stmt.(type) {
+	case *SetStmt:
+		this.line("%s = %s;", this.name(s.Target), this.expr(s.Value, 0))
+
+	case *ReadStmt:
+		for _, target := range s.Targets {
+			read := "japc_read_integer"
+			if this.st.Getdatatype(target) == Dtreal {
+				read = "japc_read_real"
+			}
+			this.use(read, "japc_word")
+			this.line("%s = %s(%d);", this.name(target), read, line)
+		}
+
+	case *WriteStmt:
+		formats := make([]string, len(s.Values))
+		args := make([]string, len(s.Values))
+		for i, value := range s.Values {
+			formats[i] = "%\" PRId32 \""
+			if value.Type() == Dtreal {
+				formats[i] = "%g"
+			}
+			args[i] = this.expr(value, 0)
+			//A C constant such as -2147483648 may be wider than an integer
+			if value.Type() == Dtinteger && constant(value) {
+				args[i] = "(integer)" + args[i]
+			}
+		}
+		this.line("printf(\"%s\\n\", %s);", strings.Join(formats, " "), strings.Join(args, ", "))
+
+	case *IfStmt:
+		this.line("if (%s) {", this.cond(s.Cond, false))
+		this.block(s.Then)
+		if s.Else != nil {
+			this.line("} else {")
+			this.block(s.Else)
+		}
+		this.line("}")
+
+	case *WhileStmt:
+		this.line("while (%s) {", this.cond(s.Cond, false))
+		this.block(s.Body)
+		this.line("}")
+
+	case *UntilStmt:
+		this.line("while (%s) {", this.cond(s.Cond, true))
+		this.block(s.Body)
+		this.line("}")
+
+	case *CallStmt:
+		args := make([]string, len(s.Args))
+		for i, arg := range s.Args {
+			args[i] = this.expr(arg, 0)
+		}
+		this.line("%s(%s);", this.name(s.Proc), strings.Join(args, ", "))
+	}
+}
+
+func (this *cGenerator) block(stmts []Stmt) {
+	this.indent++
+	this.stmts(stmts)
+	this.indent--
+}
+
+// cond() - A relational test in C, negated for UNTIL loops
+func (this *cGenerator) cond(cond *Cond, negate bool) string {
+	ops := map[TokenType]string{Tokequals: "==", Tokgreater: ">", Tokless: "<", Toknotequal: "!="}
+	if negate {
+		ops = map[TokenType]string{Tokequals: "!=", Tokgreater: "<=", Tokless: ">=", Toknotequal: "=="}
+	}
+	return fmt.Sprintf("%s %s %s", this.expr(cond.Left, 0), ops[cond.Op], this.expr(cond.Right, 0))
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Expressions
+////////////////////////////////////////////////////////////////////
+
+// The binding strength of each operator; unary minus binds tightest
+var cPrecedence = map[TokenType]int{Tokplus: 1, Tokminus: 1, Tokstar: 2, Tokslash: 2}
+
+const cUnary = 3
+
+var cOperators = map[TokenType]string{Tokplus: "+", Tokminus: "-", Tokstar: "*", Tokslash: "/"}
+
+// The helpers that wrap integer arithmetic around at 32 bits
+var cWrapping = map[TokenType]string{Tokplus: "japc_add", Tokminus: "japc_sub", Tokstar: "japc_mul"}
+
+// expr() -	An expression in C, parenthesized if it binds less
+//			tightly than the context it appears in
+func (this *cGenerator) expr(expr Expr, context int) string {
+	switch e := expr.(type) {
+	case *Ident:
+		return this.name(e.Index)
+
+	case *Literal:
+		if e.Dt == Dtinteger {
+			return fmt.Sprint(e.Ival)
+		}
+		return strings.ToLower(this.st.Getlexeme(e.Index))
+
+	case *Negate:
+		//Only a literal other than the smallest integer is safe to negate
+		if lit, ok := e.X.(*Literal); e.Type() == Dtinteger && (!ok || lit.Ival == math.MinInt32) {
+			this.used["japc_neg"] = true
+			return fmt.Sprintf("japc_neg(%s)", this.expr(e.X, 0))
+		}
+		x := this.expr(e.X, cUnary)
+		if strings.HasPrefix(x, "-") {
+			x = "(" + x + ")"
+		}
+		return this.paren("-"+x, cUnary, context)
+
+	case *Float:
+		return this.paren("(real)"+this.expr(e.X, cUnary), cUnary, context)
+
+	case *Binary:
+		if e.Op == Tokslash {
+			divide := "japc_rdivide"
+			if e.Dt == Dtinteger {
+				divide = "japc_divide"
+				this.use("japc_neg")
+			}
+			this.use(divide)
+			return fmt.Sprintf("%s(%s, %s, %d)", divide, this.expr(e.Left, 0), this.expr(e.Right, 0), e.Line)
+		}
+		if e.Dt == Dtinteger {
+			//These cannot fail, so do not need japc_error
+			this.used[cWrapping[e.Op]] = true
+			return fmt.Sprintf("%s(%s, %s)", cWrapping[e.Op], this.expr(e.Left, 0), this.expr(e.Right, 0))
+		}
+		prec := cPrecedence[e.Op]
+		//The right operand of - needs its own parentheses at equal strength
+		right := prec
+		if e.Op == Tokminus {
+			right++
+		}
+		text := fmt.Sprintf("%s %s %s", this.expr(e.Left, prec), cOperators[e.Op], this.expr(e.Right, right))
+		return this.paren(text, prec, context)
+	}
+	panic(fmt.Sprintf("c: unknown expression %T", expr))
+}
+
+// use() - Note that the program calls helpers
+func (this *cGenerator) use(helpers ...string) {
+	this.used["japc_error"] = true
+	for _, h := range helpers {
+		this.used[h] = true
+	}
+}
+
+// constant() - Whether an expression is made only of literals
+func constant(expr Expr) bool {
+	switch e := expr.(type) {
+	case *Literal:
+		return true
+	case *Negate:
+		return constant(e.X)
+	case *Binary:
+		return constant(e.Left) && constant(e.Right)
+	}
+	return false
+}
+
+// line() - Write one line of code at the current indentation
+func (this *cGenerator) line(format string, args ...interface{}) {
+	fmt.Fprintf(this.w, strings.Repeat("\t", this.indent)+format+"\n", args...)
+}
+
+func (this *cGenerator) paren(text string, prec, context int) string {
+	if prec < context {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Names and Types
+////////////////////////////////////////////////////////////////////
+
+// name() - The C name of a symbol: its original spelling and an underscore
+func (this *cGenerator) name(tabindex int) string {
+	return this.st.Getspelling(tabindex) + "_"
+}
+
+var cTypes = map[DataType]string{Dtinteger: "integer", Dtreal: "real"}
+
+func (this *cGenerator) ctype(tabindex int) string {
+	return cTypes[this.st.Getdatatype(tabindex)]
+}
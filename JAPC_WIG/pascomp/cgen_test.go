@@ -0,0 +1,95 @@
+package pascomp
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// interpret() - What the interpreter writes running a program on input
+func interpret(t *testing.T, source, input string) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := NewInterpreter(parseSource(t, source), strings.NewReader(input), &out).Run(); err != nil {
+		t.Fatalf("interpret: %v", err)
+	}
+	return out.String()
+}
+
+func TestGenerateCCompiles(t *testing.T) {
+	gcc, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Skip("gcc is not installed")
+	}
+	tests := []struct {
+		name, source, input string
+	}{
+		{"sample", factProgram, "5"},
+		//Names the C headers, keywords and the generated code use
+		{"library names", `PROGRAM Main;
+	DECLARE
+		INTEGER EOF, FILE, div, abs, BUFSIZ, ERANGE, bool, errno, long, stdin;
+		REAL double, printf, NULL;
+
+	PROCEDURE exit PARAMETERS INTEGER main;
+	BEGIN
+		WRITE main
+	END;
+
+	PROCEDURE scanf;
+	BEGIN
+		READ abs;
+		WRITE abs * 2
+	END;
+
+	BEGIN
+		SET EOF = 1;
+		SET FILE = EOF + 1;
+		SET div = FILE * 3;
+		SET BUFSIZ = div / FILE;
+		SET ERANGE = -BUFSIZ;
+		SET bool = ERANGE - EOF;
+		SET errno = bool * bool;
+		SET long = errno + div;
+		SET stdin = long;
+		SET double = stdin / 2;
+		SET printf = double * 1.5;
+		SET NULL = printf - double;
+		WRITE EOF, FILE, div, BUFSIZ, ERANGE, bool, errno, long, stdin;
+		WRITE double, printf, NULL;
+		CALL exit(stdin);
+		CALL scanf
+	END.
+`, "21"},
+	}
+
+	dir := t.TempDir()
+	for _, test := range tests {
+		var c bytes.Buffer
+		if err := GenerateC(parseSource(t, test.source), &c); err != nil {
+			t.Fatal(err)
+		}
+		src, exe := filepath.Join(dir, "prog.c"), filepath.Join(dir, "prog")
+		if err := os.WriteFile(src, c.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := exec.Command(gcc, "-std=c99", "-pedantic-errors", "-Wall", "-Werror",
+			"-o", exe, src).CombinedOutput(); err != nil {
+			t.Errorf("%s: gcc: %v\n%s\n%s", test.name, err, out, c.String())
+			continue
+		}
+		cmd := exec.Command(exe)
+		cmd.Stdin = strings.NewReader(test.input)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Errorf("%s: running the C program: %v", test.name, err)
+			continue
+		}
+		if want := interpret(t, test.source, test.input); string(out) != want {
+			t.Errorf("%s: the C program wrote %q, the interpreter %q", test.name, out, want)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package pascomp
+
+import (
+	"fmt"
+	"sort"
+)
+
+//////////////////////////Dead Code//////////////////////////
+//Live variable analysis over each procedure's basic blocks.  A block's
+//live set is worked backwards from the blocks that can follow it until
+//nothing changes; an assignment whose result is not live afterwards is
+//removed, as is every block no path from the procedure's entry reaches.
+//The program's variables are live wherever a procedure is called and
+//when a procedure returns, since the caller may read them.  Divisions
+//that could fail and reads, which consume input, are always kept.
+//
+//Unused reports the names a program declares but never uses, scoped by
+//their owning procedure in the attribute table.
+
+// Warning is a problem worth reporting that does not stop compilation
+type Warning struct {
+	Line   int
+	Column int // of the name it is about, or 0 if not known
+	Msg    string
+	Details
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("warning: %s on line #%d", w.Msg, w.Line)
+}
+
+// irBlock is a basic block: the quadruples Code[start:end] of a procedure
+type irBlock struct {
+	start, end int
+	succs      []int
+}
+
+// irBlocks() -	Split a procedure's code into basic blocks.  A block
+//				starts at a label or after a jump or return.
+func irBlocks(p *IrProc) []irBlock {
+	var blocks []irBlock
+	labels := make(map[int]int) // label -> the block it starts
+	start := 0
+	for i, q := range p.Code {
+		if q.Op == IrLabel && i > start {
+			blocks = append(blocks, irBlock{start: start, end: i})
+			start = i
+		}
+		if q.Op == IrLabel {
+			labels[q.Result] = len(blocks)
+		}
+		switch q.Op {
+		case IrGoto, IrIf, IrIffalse, IrReturn:
+			blocks = append(blocks, irBlock{start: start, end: i + 1})
+			start = i + 1
+		}
+	}
+	if start < len(p.Code) {
+		blocks = append(blocks, irBlock{start: start, end: len(p.Code)})
+	}
+
+	for b := range blocks {
+		last := p.Code[blocks[b].end-1]
+		switch last.Op {
+		case IrGoto:
+			blocks[b].succs = []int{labels[last.Result]}
+		case IrIf, IrIffalse:
+			blocks[b].succs = []int{labels[last.Result]}
+			if b+1 < len(blocks) {
+				blocks[b].succs = append(blocks[b].succs, b+1)
+			}
+		case IrReturn:
+		default:
+			if b+1 < len(blocks) {
+				blocks[b].succs = []int{b + 1}
+			}
+		}
+	}
+	return blocks
+}
+
+// quadUses() - The operands whose values a quadruple reads
+func quadUses(q Quad) []int {
+	switch q.Op {
+	case IrAssign, IrNeg, IrFloat, IrWrite, IrParam:
+		return []int{q.Arg1}
+	case IrAdd, IrSub, IrMul, IrDiv, IrIf, IrIffalse:
+		return []int{q.Arg1, q.Arg2}
+	}
+	return nil
+}
+
+// quadDefines() - Whether a quadruple stores a value in its result
+func quadDefines(q Quad) bool {
+	switch q.Op {
+	case IrAssign, IrAdd, IrSub, IrMul, IrDiv, IrNeg, IrFloat, IrRead:
+		return true
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Elimination
+////////////////////////////////////////////////////////////////////
+
+// eliminate() -	Remove unreachable blocks and assignments nothing
+//					reads, then temporaries that are no longer used;
+//					reports any change
+func (this *optimizer) eliminate(p *IrProc, globals []int) bool {
+	blocks := irBlocks(p)
+	if len(blocks) == 0 {
+		return false
+	}
+
+	//Reachability from the entry block
+	reached := make([]bool, len(blocks))
+	work := []int{0}
+	reached[0] = true
+	for len(work) > 0 {
+		b := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, s := range blocks[b].succs {
+			if !reached[s] {
+				reached[s] = true
+				work = append(work, s)
+			}
+		}
+	}
+
+	//Live variables on leaving each block, iterated to a fixed point
+	atExit := make(map[int]bool)
+	if p.Index != this.main {
+		for _, g := range globals {
+			atExit[g] = true
+		}
+	}
+	liveOut := make([]map[int]bool, len(blocks))
+	liveIn := make([]map[int]bool, len(blocks))
+	for b := range blocks {
+		liveIn[b] = make(map[int]bool)
+	}
+	for changed := true; changed; {
+		changed = false
+		for b := len(blocks) - 1; b >= 0; b-- {
+			out := make(map[int]bool)
+			if p.Code[blocks[b].end-1].Op == IrReturn {
+				for v := range atExit {
+					out[v] = true
+				}
+			}
+			for _, s := range blocks[b].succs {
+				for v := range liveIn[s] {
+					out[v] = true
+				}
+			}
+			liveOut[b] = out
+			in := this.live(p.Code[blocks[b].start:blocks[b].end], out, globals, nil)
+			if len(in) != len(liveIn[b]) {
+				liveIn[b], changed = in, true
+			}
+		}
+	}
+
+	changed := false
+	dead := make([]bool, len(p.Code))
+	for b, block := range blocks {
+		if !reached[b] {
+			for i := block.start; i < block.end; i++ {
+				//The closing return stays so every procedure has one
+				dead[i] = p.Code[i].Op != IrReturn
+			}
+			continue
+		}
+		this.live(p.Code[block.start:block.end], liveOut[b], globals, dead[block.start:block.end])
+	}
+
+	code := p.Code[:0]
+	for i, q := range p.Code {
+		if dead[i] {
+			changed = true
+			continue
+		}
+		code = append(code, q)
+	}
+	p.Code = code
+
+	//Temporaries whose every assignment has gone
+	used := make(map[int]bool)
+	for _, q := range p.Code {
+		used[q.Arg1], used[q.Arg2], used[q.Result] = true, true, true
+	}
+	temps := p.Temps[:0]
+	for _, t := range p.Temps {
+		if used[t] {
+			temps = append(temps, t)
+		}
+	}
+	p.Temps = temps
+	return changed
+}
+
+// live() -	Work backwards through a block from the variables live
+//			after it, returning those live before it.  If dead is
+//			given the assignments nothing reads are marked in it.
+func (this *optimizer) live(code []Quad, out map[int]bool, globals []int, dead []bool) map[int]bool {
+	live := make(map[int]bool)
+	for v := range out {
+		live[v] = true
+	}
+
+	for i := len(code) - 1; i >= 0; i-- {
+		q := code[i]
+		if quadDefines(q) {
+			if !live[q.Result] && this.removable(q) {
+				if dead != nil {
+					dead[i] = true
+				}
+				continue
+			}
+			delete(live, q.Result)
+		}
+		if q.Op == IrCall {
+			for _, g := range globals {
+				live[g] = true
+			}
+		}
+		for _, v := range quadUses(q) {
+			if v >= 0 && !this.literal(v) {
+				live[v] = true
+			}
+		}
+	}
+	return live
+}
+
+// removable() -	Whether an unused assignment can go: reads consume
+//					input and a division may report a zero divisor
+func (this *optimizer) removable(q Quad) bool {
+	switch q.Op {
+	case IrRead:
+		return false
+	case IrDiv:
+		if !this.literal(q.Arg2) {
+			return false
+		}
+		if this.st.Getdatatype(q.Arg2) == Dtinteger {
+			return this.st.Getivalue(q.Arg2) != 0
+		}
+		return this.realValue(q.Arg2) != 0
+	}
+	return true
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Unused Names
+////////////////////////////////////////////////////////////////////
+
+// Unused() -	Warn about variables and parameters a procedure never
+//				uses or only assigns and procedures nothing calls, in
+//				the order they were declared.  Run it before Optimize,
+//				which removes the assignments that are never read.
+func Unused(ir *IrProgram) []Warning {
+	read := make(map[int]bool)
+	set := make(map[int]bool)
+	for _, p := range ir.Procs {
+		for _, q := range p.Code {
+			for _, v := range quadUses(q) {
+				read[v] = true
+			}
+			if q.Op == IrCall {
+				read[q.Arg1] = true
+			}
+			if quadDefines(q) {
+				set[q.Result] = true
+			}
+		}
+	}
+
+	var names []int
+	for _, p := range ir.Procs {
+		if p != ir.Procs[0] {
+			names = append(names, p.Index)
+		}
+		names = append(names, p.Params...)
+		names = append(names, p.Vars...)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return ir.Declared[names[i]].Line < ir.Declared[names[j]].Line
+	})
+
+	var warnings []Warning
+	for _, n := range names {
+		if read[n] {
+			continue
+		}
+		kind := map[SemanticType]string{Stvariable: "variable", Stparameter: "parameter",
+			Stprocedure: "procedure"}[ir.St.Getsmclass(n)]
+		msg, code := "is declared but never used", codeUnused
+		switch {
+		case kind == "procedure":
+			msg = "is declared but never called"
+		case set[n]:
+			msg, code = "is assigned but never read", codeUnread
+		}
+		owner := ir.St.Getproc(n)
+		where := "procedure"
+		if owner == ir.Procs[0].Index {
+			where = "program"
+		}
+		warnings = append(warnings, Warning{Line: ir.Declared[n].Line, Column: ir.Declared[n].Column,
+			Msg:     fmt.Sprintf("%s %s in %s %s %s", kind, ir.St.Getlexeme(n), where, ir.St.Getlexeme(owner), msg),
+			Details: Details{Code: code}})
+	}
+	return warnings
+}
@@ -0,0 +1,153 @@
+package pascomp
+
+import (
+	"sort"
+
+	"github.com/kdgwill/golang_dev/JAPC_WIG/diagnostics"
+)
+
+//////////////////////////Diagnostic Codes//////////////////////////
+//Every error the scanner and parser stop at and every warning the
+//checks on the intermediate code give has a code, E for errors, W for
+//warnings and L for what only lint reports, so that tools and people
+//can tell the kinds apart without matching message text.  Rules
+//describes each code for SARIF logs.  Besides its message a diagnostic
+//may point at the declaration it is about, explain itself in a note or
+//suggest a fix.
+
+// The diagnostic codes
+const (
+	codeSyntax          = "E001"
+	codeIllegalOperator = "E002"
+	codeRedeclared      = "E003"
+	codeUndeclared      = "E004"
+	codeNotProcedure    = "E005"
+	codeNotVariable     = "E006"
+	codeRealToInteger   = "E007"
+	codeArguments       = "E008"
+	codeTableFull       = "E009"
+	codeUnused          = "W001"
+	codeUnread          = "W002"
+	codeUnassigned      = "W003"
+	codeMaybeUnassigned = "W004"
+	codeShadowed        = "L001"
+	codeLongName        = "L002"
+	codeEmptyProcedure  = "L003"
+	codeConstantCond    = "L004"
+	codeMagicNumber     = "L005"
+)
+
+// Rules describes every diagnostic code
+var Rules = []diagnostics.Rule{
+	{ID: codeSyntax, Name: "syntax", Severity: diagnostics.Error,
+		Summary: "The program does not follow the grammar."},
+	{ID: codeIllegalOperator, Name: "illegal-operator", Severity: diagnostics.Error,
+		Summary: "A character is not part of any token."},
+	{ID: codeRedeclared, Name: "redeclared-name", Severity: diagnostics.Error,
+		Summary: "A name is declared twice in the same procedure."},
+	{ID: codeUndeclared, Name: "undeclared-name", Severity: diagnostics.Error,
+		Summary: "A name is used but never declared."},
+	{ID: codeNotProcedure, Name: "not-a-procedure", Severity: diagnostics.Error,
+		Summary: "CALL names something other than a procedure."},
+	{ID: codeNotVariable, Name: "not-a-variable", Severity: diagnostics.Error,
+		Summary: "A name that is not a variable or parameter is used as one."},
+	{ID: codeRealToInteger, Name: "real-to-integer", Severity: diagnostics.Error,
+		Summary: "A real value is assigned or passed to an integer."},
+	{ID: codeArguments, Name: "argument-count", Severity: diagnostics.Error,
+		Summary: "A call has too many or too few arguments."},
+	{ID: codeTableFull, Name: "table-full", Severity: diagnostics.Error,
+		Summary: "The program has more names than the symbol table holds."},
+	{ID: codeUnused, Name: "unused-name", Severity: diagnostics.Warning,
+		Summary: "A variable or parameter is never used or a procedure never called."},
+	{ID: codeUnread, Name: "unread-variable", Severity: diagnostics.Warning,
+		Summary: "A variable or parameter is assigned but never read."},
+	{ID: codeUnassigned, Name: "read-before-assigned", Severity: diagnostics.Warning,
+		Summary: "A variable is read before it is assigned."},
+	{ID: codeMaybeUnassigned, Name: "maybe-read-before-assigned", Severity: diagnostics.Warning,
+		Summary: "A variable may be read before it is assigned."},
+	{ID: codeShadowed, Name: "shadowed-name", Severity: diagnostics.Warning,
+		Summary: "A procedure declares a name that hides one declared outside it."},
+	{ID: codeLongName, Name: "long-name", Severity: diagnostics.Warning,
+		Summary: "A name is longer than the configured limit."},
+	{ID: codeEmptyProcedure, Name: "empty-procedure", Severity: diagnostics.Warning,
+		Summary: "A procedure has no statements."},
+	{ID: codeConstantCond, Name: "constant-condition", Severity: diagnostics.Warning,
+		Summary: "A condition does not depend on any variable, so it is always true or always false."},
+	{ID: codeMagicNumber, Name: "magic-number", Severity: diagnostics.Warning,
+		Summary: "A number other than an allowed one is written in a statement instead of being named in CONST."},
+}
+
+// Details are what a diagnostic shows besides its message
+type Details struct {
+	Code    string             // one of the codes in Rules
+	Related []diagnostics.Span // other places it is about, such as a declaration
+	Notes   []string
+	Help    []diagnostics.Suggestion
+}
+
+func (d Details) diagnostic(severity diagnostics.Severity, msg string, line, column int) diagnostics.Diagnostic {
+	return diagnostics.Diagnostic{Severity: severity, Code: d.Code, Message: msg,
+		Primary: diagnostics.Span{Line: line, Column: column}, Secondary: d.Related,
+		Notes: d.Notes, Suggestions: d.Help}
+}
+
+// Diagnostic() - The error as a diagnostic
+func (e *SyntaxError) Diagnostic() diagnostics.Diagnostic {
+	return e.diagnostic(diagnostics.Error, e.Msg, e.Line, e.Column)
+}
+
+// Diagnostic() - The warning as a diagnostic
+func (w Warning) Diagnostic() diagnostics.Diagnostic {
+	return w.diagnostic(diagnostics.Warning, w.Msg, w.Line, w.Column)
+}
+
+// declaredAt() - A span for where a name was declared, if that is known
+func declaredAt(declared map[int]Pos, index int, label string) []diagnostics.Span {
+	pos, ok := declared[index]
+	if !ok {
+		return nil
+	}
+	return []diagnostics.Span{{Line: pos.Line, Column: pos.Column, Label: label}}
+}
+
+// closest() -	The candidate spelled most like name, if any is close
+//				enough to be a likely typing mistake
+func closest(st *SymbolTable, name string, candidates []int) (int, bool) {
+	sort.Ints(candidates)
+	best, bestDistance := -1, len(name)/3+1
+	for _, c := range candidates {
+		if d := editDistance(name, st.Getlexeme(c)); d <= bestDistance && (best < 0 || d < bestDistance) {
+			best, bestDistance = c, d
+		}
+	}
+	return best, best >= 0
+}
+
+// editDistance() -	The fewest characters inserted, deleted or replaced
+//					to turn a into b
+func editDistance(a, b string) int {
+	x, y := []rune(a), []rune(b)
+	row := make([]int, len(y)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(x); i++ {
+		diagonal := row[0]
+		row[0] = i
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+			next := diagonal + cost
+			if row[j]+1 < next {
+				next = row[j] + 1
+			}
+			if row[j-1]+1 < next {
+				next = row[j-1] + 1
+			}
+			diagonal, row[j] = row[j], next
+		}
+	}
+	return row[len(y)]
+}
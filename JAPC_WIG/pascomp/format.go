@@ -0,0 +1,242 @@
+package pascomp
+
+import (
+	"bytes"
+	"strings"
+)
+
+//////////////////////////Source Formatting//////////////////////////
+//Format lays a program out one canonical way.  The program's tokens
+//are written again in the order the scanner found them with only the
+//space between them changed, and keywords in one case, so a formatted
+//program scans to the same tokens and means the same thing.
+//Identifiers and literals keep the spelling they were written with.
+//
+//Every section, declaration, statement and closing keyword starts a
+//line.  The program's sections start at the margin; a procedure's
+//sections are indented one tab under its heading, and the statements
+//of a BEGIN, THEN, ELSE or DO one tab more than the line that opens
+//them.  Operators have a space on each side except unary minus, and
+//commas and semicolons follow what is before them.
+//
+//Comments stay where they were among the tokens.  One that starts its
+//own line is indented like the line after it, or like the statements
+//inside when that line closes a block; one that follows a token stays
+//on that token's line.  A line break after a comment is kept, as is a
+//single blank line wherever the program had one or more.  A program
+//must parse before it is formatted, so the layout can trust the
+//grammar; formatting a formatted program changes nothing.
+
+// FormatOptions are the choices Format leaves to the programmer
+type FormatOptions struct {
+	LowerKeywords bool // write keywords in lower case instead of upper
+}
+
+// Format() -	Lay a program out canonically.  A program with an error
+//				is not formatted and the *SyntaxError is returned.
+func Format(source []byte, opts FormatOptions) ([]byte, error) {
+	var parsing Scanner
+	parsing.NewScannerReader(bytes.NewReader(source))
+	if _, err := NewParser(&parsing).Parse(); err != nil {
+		return nil, err
+	}
+
+	var scanner Scanner
+	scanner.NewScannerReader(bytes.NewReader(source))
+	tokens, err := scanner.ScanAll()
+	if err != nil {
+		return nil, err
+	}
+
+	this := &formatter{sourceText: newSourceText(source), opts: opts, st: scanner.St, prev: Tokeof}
+	at := 0
+	for i, t := range tokens {
+		start, end := this.extent(tokens, i, len(this.text))
+		comments, breaks := this.gap(at, start)
+		this.token(t, comments, breaks, string(this.text[start:end]))
+		at = end
+	}
+	comments, breaks := this.gap(at, len(this.text))
+	this.comments(comments, breaks, 0)
+	return append(bytes.TrimRight(this.out.Bytes(), " \t\r\n"), '\n'), nil
+}
+
+// comment is a comment between two tokens and the line breaks before it
+type comment struct {
+	text   string
+	breaks int
+}
+
+// formatter writes a program's tokens out again
+type formatter struct {
+	sourceText
+	opts FormatOptions
+	st   *SymbolTable
+	out  bytes.Buffer
+
+	level   int       // the indent of the block's sections: 0, or 1 in a procedure
+	depth   int       // the indent of the statements being written
+	section TokenType // Tokconst, Tokdeclare or Tokprocedure while in one
+	prev    TokenType // the token written last
+	unary   bool      // whether it was a unary minus
+	indent  int       // the indent of the line being written
+	fresh   bool      // whether nothing is on the line yet
+	broken  bool      // whether a comment ended with a line break
+}
+
+// gap() -	The comments between two tokens and the line breaks after
+//			the last of them
+func (this *formatter) gap(from, to int) (comments []comment, breaks int) {
+	for at := from; at < to; at++ {
+		switch this.text[at] {
+		case '\n':
+			breaks++
+		case '{':
+			//Comments do not nest and one left open runs to the end
+			end := at
+			for end < to && this.text[end] != '}' {
+				end++
+			}
+			if end < to {
+				end++
+			}
+			comments = append(comments, comment{string(this.text[at:end]), breaks})
+			breaks, at = 0, end-1
+		}
+	}
+	return
+}
+
+// token() -	Write a token after the comments before it, on a line of
+//				its own if the layout or a comment asks for one
+func (this *formatter) token(t Token, comments []comment, breaks int, text string) {
+	starts, indent := this.place(t)
+	if this.st.Getsmclass(t.Index) == Stkeyword {
+		if this.opts.LowerKeywords {
+			text = strings.ToLower(text)
+		} else {
+			text = strings.ToUpper(text)
+		}
+	}
+
+	//A comment on a line of its own inside a block that this token
+	//closes is indented with the block's statements
+	inside := indent
+	switch t.Type {
+	case Tokend, Tokelse, Tokendif, Tokendwhile, Tokenduntil:
+		inside++
+	}
+	if !starts {
+		inside = this.indent + 1
+	}
+	this.comments(comments, breaks, inside)
+
+	switch {
+	case starts || this.broken:
+		if !starts {
+			indent = this.indent + 1
+		}
+		this.newline(indent, breaks > 1)
+	case this.space(t):
+		this.out.WriteByte(' ')
+	}
+	this.out.WriteString(text)
+	this.fresh, this.broken = false, false
+	this.unary = t.Type == Tokminus && !this.operand()
+	this.prev = t.Type
+}
+
+// comments() -	Write comments, each that started a line on a line of
+//				its own at an indent, noting whether the last was
+//				followed by a line break
+func (this *formatter) comments(comments []comment, breaks int, indent int) {
+	for _, c := range comments {
+		if c.breaks > 0 || this.out.Len() == 0 {
+			this.newline(indent, c.breaks > 1)
+		} else {
+			this.out.WriteByte(' ')
+		}
+		this.out.WriteString(c.text)
+		this.fresh = false
+	}
+	//The line break is kept so that what follows does not move onto
+	//the comment's line
+	this.broken = len(comments) > 0 && breaks > 0
+}
+
+// newline() -	Start a line at an indent, after a blank line if asked
+//				and something has been written
+func (this *formatter) newline(indent int, blank bool) {
+	if this.out.Len() > 0 && !this.fresh {
+		trimmed := bytes.TrimRight(this.out.Bytes(), " \t")
+		this.out.Truncate(len(trimmed))
+		this.out.WriteByte('\n')
+		if blank {
+			this.out.WriteByte('\n')
+		}
+	} else if this.fresh {
+		//Only the indent is on the line so far
+		this.out.Truncate(len(bytes.TrimRight(this.out.Bytes(), "\t")))
+	}
+	this.out.WriteString(strings.Repeat("\t", indent))
+	this.indent, this.fresh = indent, true
+}
+
+// place() -	Whether a token starts a line and at what indent, keeping
+//				track of the block and statement the token is in
+func (this *formatter) place(t Token) (bool, int) {
+	switch t.Type {
+	case Tokprogram:
+		return true, 0
+	case Tokconst, Tokdeclare:
+		this.section = t.Type
+		return true, this.level
+	case Tokprocedure:
+		this.section, this.level = Tokprocedure, 1
+		return true, 0
+	case Tokbegin:
+		this.section, this.depth = Tokeof, this.level+1
+		return true, this.level
+	case Tokend:
+		level := this.level
+		this.level, this.depth = 0, 0
+		return true, level
+	case Tokset, Tokread, Tokwrite, Tokif, Tokwhile, Tokuntil, Tokcall:
+		return true, this.depth
+	case Tokthen, Tokdo:
+		this.depth++
+	case Tokelse:
+		return true, this.depth - 1
+	case Tokendif, Tokendwhile, Tokenduntil:
+		this.depth--
+		return true, this.depth
+	case Tokidentifier:
+		if this.section == Tokconst && (this.prev == Tokconst || this.prev == Toksemicolon) {
+			return true, this.level + 1
+		}
+	case Tokinteger, Tokreal:
+		if this.section == Tokdeclare && (this.prev == Tokdeclare || this.prev == Toksemicolon) {
+			return true, this.level + 1
+		}
+	}
+	return false, this.indent
+}
+
+// space() -	Whether a token that continues a line is written after a
+//				space
+func (this *formatter) space(t Token) bool {
+	switch t.Type {
+	case Toksemicolon, Tokcomma, Tokperiod, Tokcloseparen:
+		return false
+	case Tokopenparen:
+		//The arguments of a call follow the procedure's name
+		return this.prev != Tokidentifier && !this.unary
+	}
+	return this.prev != Tokopenparen && !this.unary
+}
+
+// operand() -	Whether the token written last ends an operand, which
+//				makes a minus after it binary
+func (this *formatter) operand() bool {
+	return this.prev == Tokidentifier || this.prev == Tokconstant || this.prev == Tokcloseparen
+}
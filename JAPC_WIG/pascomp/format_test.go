@@ -0,0 +1,135 @@
+package pascomp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// formatSource() - Format a program, failing the test on an error
+func formatSource(t *testing.T, name string, source []byte, opts FormatOptions) []byte {
+	t.Helper()
+	out, err := Format(source, opts)
+	if err != nil {
+		t.Fatalf("%s: format: %v", name, err)
+	}
+	return out
+}
+
+// formatSamples() -	The programs formatting is checked on: the samples
+//						that parse and the ones the other tests use
+func formatSamples(t *testing.T) map[string][]byte {
+	t.Helper()
+	samples := map[string][]byte{"factProgram": []byte(factProgram), "constProgram": []byte(constProgram),
+		"commented": []byte(commentedProgram)}
+	files, err := filepath.Glob("../*.pas")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no samples: %v", err)
+	}
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		//A sample the parser rejects is left as it is
+		if _, err := Format(source, FormatOptions{}); err != nil {
+			if _, ok := err.(*SyntaxError); !ok {
+				t.Errorf("%s: format: %v", file, err)
+			}
+			continue
+		}
+		samples[file] = source
+	}
+	return samples
+}
+
+const commentedProgram = `{A program of comments}
+PROGRAM   Notes ;
+DECLARE INTEGER a,b;   {two of them}
+{a procedure
+ over two lines}
+PROCEDURE Show PARAMETERS INTEGER x; BEGIN WRITE x {the value} END;
+
+
+BEGIN
+  READ a; {first}
+SET b=a*-2 ;
+	{before the IF}
+IF b>a THEN CALL Show(b) ELSE {nothing} CALL Show(a) ENDIF
+END. {done}
+`
+
+func TestFormatRoundTrip(t *testing.T) {
+	for name, source := range formatSamples(t) {
+		for _, opts := range []FormatOptions{{}, {LowerKeywords: true}} {
+			once := formatSource(t, name, source, opts)
+			if twice := formatSource(t, name, once, opts); string(twice) != string(once) {
+				t.Errorf("%s with %+v: formatting again changed\n%s\nto\n%s", name, opts, once, twice)
+			}
+			//The formatted program means the same thing
+			if got, want := dumpIR(t, GenerateIR(parseSource(t, string(once)))),
+				dumpIR(t, GenerateIR(parseSource(t, string(source)))); got != want {
+				t.Errorf("%s with %+v: the formatted program lowers to\n%s\nnot\n%s", name, opts, got, want)
+			}
+		}
+	}
+}
+
+//Every comment stays among the same tokens and the two blank lines
+//before the program's BEGIN become one
+func TestFormatLayout(t *testing.T) {
+	for _, test := range []struct {
+		opts FormatOptions
+		want string
+	}{
+		{FormatOptions{}, `{A program of comments}
+PROGRAM Notes;
+DECLARE
+	INTEGER a, b; {two of them}
+{a procedure
+ over two lines}
+PROCEDURE Show PARAMETERS INTEGER x;
+	BEGIN
+		WRITE x {the value}
+	END;
+
+BEGIN
+	READ a; {first}
+	SET b = a * -2;
+	{before the IF}
+	IF b > a THEN
+		CALL Show(b)
+	ELSE {nothing}
+		CALL Show(a)
+	ENDIF
+END. {done}
+`},
+		//Comments and names keep their case
+		{FormatOptions{LowerKeywords: true}, `{A program of comments}
+program Notes;
+declare
+	integer a, b; {two of them}
+{a procedure
+ over two lines}
+procedure Show parameters integer x;
+	begin
+		write x {the value}
+	end;
+
+begin
+	read a; {first}
+	set b = a * -2;
+	{before the IF}
+	if b > a then
+		call Show(b)
+	else {nothing}
+		call Show(a)
+	endif
+end. {done}
+`},
+	} {
+		if got := string(formatSource(t, "commented", []byte(commentedProgram), test.opts)); got != test.want {
+			t.Errorf("with %+v formatted as\n%s\nwant\n%s", test.opts, got, test.want)
+		}
+	}
+}
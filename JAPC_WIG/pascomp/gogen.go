@@ -0,0 +1,426 @@
+package pascomp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//////////////////////////Go Code Generator//////////////////////////
+//Translates a parsed Program into a Go main package.  Like the C backend
+//it works from the tree and keeps names' original spelling, appending an
+//underscore to any that Go or the generated helpers reserve.  Integers
+//are int32 and reals float64, so the program computes exactly what the
+//interpreter does; input and runtime errors are reported with the same
+//messages, which makes its output a reference for the other backends.
+//Go rejects constants that overflow where the language wraps them
+//around, so constant integer arithmetic is done here instead.
+
+type goGenerator struct {
+	st      *SymbolTable
+	w       *bytes.Buffer
+	indent  int
+	imports map[string]bool
+	helpers map[string]bool
+}
+
+// Go's keywords and predeclared names and the generated helpers' names
+var goReserved = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true,
+	"default": true, "defer": true, "else": true, "fallthrough": true, "for": true,
+	"func": true, "go": true, "goto": true, "if": true, "import": true,
+	"interface": true, "map": true, "package": true, "range": true, "return": true,
+	"select": true, "struct": true, "switch": true, "type": true, "var": true,
+	"bool": true, "byte": true, "complex64": true, "complex128": true, "error": true,
+	"float32": true, "float64": true, "int": true, "int8": true, "int16": true,
+	"int32": true, "int64": true, "rune": true, "string": true, "uint": true,
+	"uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"true": true, "false": true, "iota": true, "nil": true, "append": true,
+	"cap": true, "close": true, "complex": true, "copy": true, "delete": true,
+	"imag": true, "len": true, "make": true, "new": true, "panic": true,
+	"print": true, "println": true, "real": true, "recover": true, "main": true,
+	"init": true, "bufio": true, "fmt": true, "os": true, "strconv": true,
+	"input": true, "fail": true, "readWord": true, "readInt": true,
+	"readReal": true, "divide": true, "rdivide": true,
+}
+
+// The helpers in the order they are written and the packages they need
+var goHelpers = []struct {
+	name, code string
+	imports    []string
+}{
+	{"fail", `
+func fail(line int, format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "runtime error: "+format+" on line #%d\n", append(args, line)...)
+	os.Exit(1)
+}
+`, []string{"fmt", "os"}},
+	{"readWord", `
+var input = bufio.NewReader(os.Stdin)
+
+func readWord(name string, line int) string {
+	var word string
+	if _, err := fmt.Fscan(input, &word); err != nil {
+		fail(line, "no input left to read %s", name)
+	}
+	return word
+}
+`, []string{"bufio", "fmt", "os"}},
+	{"readInt", `
+func readInt(name string, line int) int32 {
+	word := readWord(name, line)
+	v, err := strconv.ParseInt(word, 10, 32)
+	if err != nil {
+		fail(line, "%q is not a valid integer for %s", word, name)
+	}
+	return int32(v)
+}
+`, []string{"strconv"}},
+	{"readReal", `
+func readReal(name string, line int) float64 {
+	word := readWord(name, line)
+	v, err := strconv.ParseFloat(word, 64)
+	if err != nil {
+		fail(line, "%q is not a valid real for %s", word, name)
+	}
+	return v
+}
+`, []string{"strconv"}},
+	{"divide", `
+func divide(x, y int32, line int) int32 {
+	if y == 0 {
+		fail(line, "division by zero")
+	}
+	return x / y
+}
+`, nil},
+	{"rdivide", `
+func rdivide(x, y float64, line int) float64 {
+	if y == 0 {
+		fail(line, "division by zero")
+	}
+	return x / y
+}
+`, nil},
+}
+
+var goTypes = map[DataType]string{Dtinteger: "int32", Dtreal: "float64"}
+
+// GenerateGo() - Write the program as a gofmt'd Go main package to w
+func GenerateGo(prog *Program, w io.Writer) error {
+	this := &goGenerator{
+		st:      prog.St,
+		w:       new(bytes.Buffer),
+		imports: make(map[string]bool),
+		helpers: make(map[string]bool),
+	}
+
+	if len(prog.Block.Vars) > 0 {
+		fmt.Fprintln(this.w, "\nvar (")
+		this.indent = 1
+		this.vars(prog.Block.Vars)
+		fmt.Fprintln(this.w, ")")
+	}
+
+	for _, proc := range prog.Block.Procs {
+		params := make([]string, len(proc.Params))
+		for i, p := range proc.Params {
+			params[i] = this.name(p) + " " + goTypes[this.st.Getdatatype(p)]
+		}
+		fmt.Fprintf(this.w, "\nfunc %s(%s) {\n", this.name(proc.Index), strings.Join(params, ", "))
+		this.indent = 1
+		if len(proc.Block.Vars) > 0 {
+			this.line("var (")
+			this.block(func() { this.vars(proc.Block.Vars) })
+			this.line(")")
+			//Go rejects locals that are never read
+			read := make(map[int]bool)
+			readVars(proc.Block.Body, read)
+			for _, v := range proc.Block.Vars {
+				if !read[v] {
+					this.line("_ = %s", this.name(v))
+				}
+			}
+		}
+		this.stmts(proc.Block.Body)
+		fmt.Fprintln(this.w, "}")
+	}
+
+	fmt.Fprintf(this.w, "\nfunc main() {\n")
+	this.indent = 1
+	this.stmts(prog.Block.Body)
+	fmt.Fprintln(this.w, "}")
+
+	//The imports and helpers are known once the program is translated
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// %s - generated by JAPC\n\npackage main\n", this.st.Getspelling(prog.Name))
+	var helpers bytes.Buffer
+	for _, h := range goHelpers {
+		if this.helpers[h.name] {
+			helpers.WriteString(h.code)
+			for _, pkg := range h.imports {
+				this.imports[pkg] = true
+			}
+		}
+	}
+	if len(this.imports) > 0 {
+		var pkgs []string
+		for pkg := range this.imports {
+			pkgs = append(pkgs, strconv.Quote(pkg))
+		}
+		sort.Strings(pkgs)
+		fmt.Fprintf(&src, "\nimport (\n\t%s\n)\n", strings.Join(pkgs, "\n\t"))
+	}
+	helpers.WriteTo(&src)
+	this.w.WriteTo(&src)
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("generated invalid Go: %v", err)
+	}
+	out := bufio.NewWriter(w)
+	out.Write(formatted)
+	return out.Flush()
+}
+
+func (this *goGenerator) vars(vars []int) {
+	for _, v := range vars {
+		this.line("%s %s", this.name(v), goTypes[this.st.Getdatatype(v)])
+	}
+}
+
+// readVars() -	Collect the variables whose values statements read
+func readVars(stmts []Stmt, read map[int]bool) {
+	var expr func(Expr)
+	expr = func(e Expr) {
+		switch e := e.(type) {
+		case *Ident:
+			read[e.Index] = true
+		case *Binary:
+			expr(e.Left)
+			expr(e.Right)
+		case *Negate:
+			expr(e.X)
+		case *Float:
+			expr(e.X)
+		}
+	}
+	cond := func(c *Cond) {
+		expr(c.Left)
+		expr(c.Right)
+	}
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *SetStmt:
+			expr(s.Value)
+		case *WriteStmt:
+			for _, v := range s.Values {
+				expr(v)
+			}
+		case *IfStmt:
+			cond(s.Cond)
+			readVars(s.Then, read)
+			readVars(s.Else, read)
+		case *WhileStmt:
+			cond(s.Cond)
+			readVars(s.Body, read)
+		case *UntilStmt:
+			cond(s.Cond)
+			readVars(s.Body, read)
+		case *CallStmt:
+			for _, a := range s.Args {
+				expr(a)
+			}
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Statements
+////////////////////////////////////////////////////////////////////
+
+func (this *goGenerator) stmts(stmts []Stmt) {
+	for _, stmt := range stmts {
+		this.stmt(stmt)
+	}
+}
+
+func (this *goGenerator) stmt(stmt Stmt) {
+	line := stmt.Position().Line
+
+	switch s := stmt.(type) {
+	case *SetStmt:
+		this.line("%s = %s", this.name(s.Target), this.expr(s.Value, 0))
+
+	case *ReadStmt:
+		for _, target := range s.Targets {
+			read := "readInt"
+			if this.st.Getdatatype(target) == Dtreal {
+				read = "readReal"
+			}
+			this.use(read, "readWord")
+			this.line("%s = %s(%q, %d)", this.name(target), read, this.st.Getlexeme(target), line)
+		}
+
+	case *WriteStmt:
+		formats := make([]string, len(s.Values))
+		args := make([]string, len(s.Values))
+		for i, value := range s.Values {
+			formats[i] = "%d"
+			if value.Type() == Dtreal {
+				//The interpreter's six significant digits
+				formats[i] = "%.6g"
+			}
+			args[i] = this.expr(value, 0)
+		}
+		this.imports["fmt"] = true
+		this.line("fmt.Printf(\"%s\\n\", %s)", strings.Join(formats, " "), strings.Join(args, ", "))
+
+	case *IfStmt:
+		this.line("if %s {", this.cond(s.Cond, false))
+		this.block(func() { this.stmts(s.Then) })
+		if s.Else != nil {
+			this.line("} else {")
+			this.block(func() { this.stmts(s.Else) })
+		}
+		this.line("}")
+
+	case *WhileStmt:
+		this.line("for %s {", this.cond(s.Cond, false))
+		this.block(func() { this.stmts(s.Body) })
+		this.line("}")
+
+	case *UntilStmt:
+		this.line("for %s {", this.cond(s.Cond, true))
+		this.block(func() { this.stmts(s.Body) })
+		this.line("}")
+
+	case *CallStmt:
+		args := make([]string, len(s.Args))
+		for i, arg := range s.Args {
+			args[i] = this.expr(arg, 0)
+		}
+		this.line("%s(%s)", this.name(s.Proc), strings.Join(args, ", "))
+	}
+}
+
+func (this *goGenerator) block(body func()) {
+	this.indent++
+	body()
+	this.indent--
+}
+
+// cond() - A relational test in Go, negated for UNTIL loops
+func (this *goGenerator) cond(cond *Cond, negate bool) string {
+	ops := map[TokenType]string{Tokequals: "==", Tokgreater: ">", Tokless: "<", Toknotequal: "!="}
+	if negate {
+		ops = map[TokenType]string{Tokequals: "!=", Tokgreater: "<=", Tokless: ">=", Toknotequal: "=="}
+	}
+	return fmt.Sprintf("%s %s %s", this.expr(cond.Left, 0), ops[cond.Op], this.expr(cond.Right, 0))
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Expressions
+////////////////////////////////////////////////////////////////////
+
+// expr() -	An expression in Go, parenthesized if it binds less
+//			tightly than the context it appears in.  Go and C agree
+//			on the strength of these operators.
+func (this *goGenerator) expr(expr Expr, context int) string {
+	if v, ok := this.fold(expr); ok {
+		return this.paren(strconv.Itoa(v), cUnary, context)
+	}
+	switch e := expr.(type) {
+	case *Ident:
+		return this.name(e.Index)
+
+	case *Literal:
+		if e.Dt == Dtinteger {
+			return strconv.Itoa(e.Ival)
+		}
+		return strings.ToLower(this.st.Getlexeme(e.Index))
+
+	case *Negate:
+		x := this.expr(e.X, cUnary)
+		if strings.HasPrefix(x, "-") {
+			x = "(" + x + ")"
+		}
+		return this.paren("-"+x, cUnary, context)
+
+	case *Float:
+		return "float64(" + this.expr(e.X, 0) + ")"
+
+	case *Binary:
+		if e.Op == Tokslash {
+			divide := "divide"
+			if e.Dt == Dtreal {
+				divide = "rdivide"
+			}
+			this.use(divide)
+			return fmt.Sprintf("%s(%s, %s, %d)", divide, this.expr(e.Left, 0), this.expr(e.Right, 0), e.Line)
+		}
+		prec := cPrecedence[e.Op]
+		right := prec
+		if e.Op == Tokminus {
+			right++
+		}
+		text := fmt.Sprintf("%s %s %s", this.expr(e.Left, prec), cOperators[e.Op], this.expr(e.Right, right))
+		return this.paren(text, prec, context)
+	}
+	panic(fmt.Sprintf("go: unknown expression %T", expr))
+}
+
+// fold() -	The value of an integer expression of literals, wrapped
+//			around like the interpreter's; one that divides is left
+//			for divide to report division by zero at run time
+func (this *goGenerator) fold(expr Expr) (int, bool) {
+	switch e := expr.(type) {
+	case *Literal:
+		return e.Ival, e.Dt == Dtinteger
+	case *Negate:
+		x, ok := this.fold(e.X)
+		return wrapInteger(-x), ok
+	case *Binary:
+		if e.Dt != Dtinteger || e.Op == Tokslash {
+			return 0, false
+		}
+		x, okx := this.fold(e.Left)
+		y, oky := this.fold(e.Right)
+		return arith(e.Op, x, y), okx && oky
+	}
+	return 0, false
+}
+
+func (this *goGenerator) paren(text string, prec, context int) string {
+	if prec < context {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+// use() - Note that the program calls helpers
+func (this *goGenerator) use(helpers ...string) {
+	this.helpers["fail"] = true
+	for _, h := range helpers {
+		this.helpers[h] = true
+	}
+}
+
+// name() - The Go name of a symbol: its original spelling
+func (this *goGenerator) name(tabindex int) string {
+	name := this.st.Getspelling(tabindex)
+	if goReserved[name] {
+		name += "_"
+	}
+	return name
+}
+
+// line() - Write one line of code at the current indentation
+func (this *goGenerator) line(format string, args ...interface{}) {
+	fmt.Fprintf(this.w, strings.Repeat("\t", this.indent)+format+"\n", args...)
+}
@@ -0,0 +1,233 @@
+package pascomp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+//////////////////////////Syntax Highlighting//////////////////////////
+//A program is highlighted by cutting its text into fragments, each a
+//token, a comment, or the spaces between them, and giving every token
+//a class from the semantic type of its attribute table entry.  The
+//scanner's own table knows keywords, operators and literals.  What an
+//identifier names depends on its scope, so the program is also parsed
+//and each identifier takes the semantic type of the entry the parser
+//resolved it to.  Identifiers after a syntax error keep the plain
+//identifier class, and an illegal character ends the tokens; the rest
+//of the text is left as it is.  Each newline is a fragment of its own
+//so that none spans two lines.  The fragments can be written as HTML
+//with a CSS class on each token or with ANSI colors for a terminal.
+
+// HighlightClass is how a fragment of a program is highlighted
+type HighlightClass string
+
+const (
+	HlNone       HighlightClass = "" // spaces, and text after an illegal character
+	HlKeyword    HighlightClass = "keyword"
+	HlOperator   HighlightClass = "operator"
+	HlProgram    HighlightClass = "program"
+	HlProcedure  HighlightClass = "procedure"
+	HlParameter  HighlightClass = "parameter"
+	HlVariable   HighlightClass = "variable"
+	HlConstant   HighlightClass = "constant"
+	HlLiteral    HighlightClass = "literal"
+	HlIdentifier HighlightClass = "identifier" // a name that was not resolved
+	HlComment    HighlightClass = "comment"
+	HlError      HighlightClass = "error"
+)
+
+// Fragment is a piece of a program's text and how to highlight it
+type Fragment struct {
+	Text   string
+	Class  HighlightClass
+	Line   int
+	Column int // counting characters from 1
+}
+
+// Highlight() - Cut a program into highlighted fragments
+func Highlight(source []byte) []Fragment {
+	//Resolve the names; an error only stops the resolving
+	var parsing Scanner
+	parsing.NewScannerReader(bytes.NewReader(source))
+	parser := NewParser(&parsing)
+	parser.Parse()
+	names := make(map[Pos]int)
+	for _, ref := range parser.References() {
+		names[ref.Pos] = ref.Index
+	}
+
+	var scanner Scanner
+	scanner.NewScannerReader(bytes.NewReader(source))
+	tokens, err := scanner.ScanAll()
+
+	this := &highlighter{sourceText: newSourceText(source), line: 1}
+	serr, _ := err.(*SyntaxError)
+	limit := len(this.text)
+	if serr != nil {
+		limit = this.offset(serr.Line, serr.Column)
+	}
+	for i, t := range tokens {
+		start, end := this.extent(tokens, i, limit)
+		this.between(start)
+		this.add(end, classify(t, scanner.St, parsing.St, names))
+	}
+	if serr != nil {
+		this.between(this.offset(serr.Line, serr.Column))
+		this.add(this.at+1, HlError)
+		this.add(len(this.text), HlNone)
+	}
+	this.between(len(this.text))
+	return this.fragments
+}
+
+// classify() -	A token's class from the semantic type of its entry in
+//				the scanner's table or, for an identifier, the parser's
+func classify(t Token, scanned, parsed *SymbolTable, names map[Pos]int) HighlightClass {
+	if t.Type == Tokidentifier {
+		index, ok := names[Pos{t.Line, t.Column}]
+		if !ok {
+			return HlIdentifier
+		}
+		switch parsed.Getsmclass(index) {
+		case Stprogram:
+			return HlProgram
+		case Stprocedure:
+			return HlProcedure
+		case Stparameter:
+			return HlParameter
+		case Stvariable:
+			return HlVariable
+		case Stconstant:
+			return HlConstant
+		}
+		return HlIdentifier
+	}
+	switch scanned.Getsmclass(t.Index) {
+	case Stkeyword:
+		return HlKeyword
+	case Stoperator:
+		return HlOperator
+	}
+	return HlLiteral
+}
+
+// highlighter cuts a program's text into fragments from the start on
+type highlighter struct {
+	sourceText
+	at, line  int // where the next fragment starts
+	fragments []Fragment
+}
+
+// between() -	Add the spaces and comments from the last fragment up
+//				to a token
+func (this *highlighter) between(to int) {
+	for this.at < to {
+		if this.text[this.at] != '{' {
+			end := this.at
+			for end < to && this.text[end] != '{' {
+				end++
+			}
+			this.add(end, HlNone)
+			continue
+		}
+		end := this.at
+		for end < to && this.text[end] != '}' {
+			end++
+		}
+		if end < to {
+			end++
+		}
+		this.add(end, HlComment)
+	}
+}
+
+// add() -	Add the text up to end as fragments of a class, each
+//			newline a fragment of its own
+func (this *highlighter) add(end int, class HighlightClass) {
+	for this.at < end {
+		stop := this.at
+		for stop < end && this.text[stop] != '\n' {
+			stop++
+		}
+		f := Fragment{string(this.text[this.at:stop]), class, this.line, this.at - this.lines[this.line-1] + 1}
+		if stop == this.at {
+			stop++
+			f.Text, f.Class = "\n", HlNone
+			this.line++
+		}
+		this.fragments = append(this.fragments, f)
+		this.at = stop
+	}
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Output
+////////////////////////////////////////////////////////////////////
+
+// HighlightFormats are the formats WriteHighlight knows
+var HighlightFormats = []string{"ansi", "html"}
+
+// HighlightCSS styles the classes WriteHighlight gives HTML
+const HighlightCSS = `pre.japc { background: #fdf6e3; color: #3b3b3b; padding: 1em; }
+.japc .keyword { color: #8959a8; font-weight: bold; }
+.japc .operator { color: #3e999f; }
+.japc .program { color: #c82829; font-weight: bold; }
+.japc .procedure { color: #4271ae; font-weight: bold; }
+.japc .parameter { color: #f5871f; }
+.japc .variable { color: #3b3b3b; }
+.japc .constant { color: #c82829; }
+.japc .literal { color: #718c00; }
+.japc .identifier { color: #3b3b3b; text-decoration: underline dotted; }
+.japc .comment { color: #8e908c; font-style: italic; }
+.japc .error { color: #fff; background: #c82829; }
+`
+
+// The ANSI colors of the classes
+var highlightANSI = map[HighlightClass]string{
+	HlKeyword:    "\x1b[1;35m",
+	HlOperator:   "\x1b[36m",
+	HlProgram:    "\x1b[1;31m",
+	HlProcedure:  "\x1b[1;34m",
+	HlParameter:  "\x1b[33m",
+	HlConstant:   "\x1b[31m",
+	HlLiteral:    "\x1b[32m",
+	HlIdentifier: "\x1b[4m",
+	HlComment:    "\x1b[2;3m",
+	HlError:      "\x1b[1;37;41m",
+}
+
+// WriteHighlight() -	Write fragments in one of the HighlightFormats:
+//						ANSI colors, or an HTML pre element with each
+//						token in a span of its class for HighlightCSS
+func WriteHighlight(w io.Writer, fragments []Fragment, format string) error {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case "ansi":
+		for _, f := range fragments {
+			if color, ok := highlightANSI[f.Class]; ok {
+				fmt.Fprintf(bw, "%s%s\x1b[0m", color, f.Text)
+			} else {
+				bw.WriteString(f.Text)
+			}
+		}
+
+	case "html":
+		bw.WriteString(`<pre class="japc"><code>`)
+		for _, f := range fragments {
+			if f.Class == HlNone {
+				bw.WriteString(html.EscapeString(f.Text))
+			} else {
+				fmt.Fprintf(bw, `<span class="%s">%s</span>`, f.Class, html.EscapeString(f.Text))
+			}
+		}
+		bw.WriteString("</code></pre>\n")
+
+	default:
+		return fmt.Errorf("unknown highlight format %q; use one of %s", format, strings.Join(HighlightFormats, ", "))
+	}
+	return bw.Flush()
+}
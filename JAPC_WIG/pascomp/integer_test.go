@@ -0,0 +1,153 @@
+package pascomp
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Arithmetic that overflows 32 bits, both at run time and in constants
+const wrapProgram = `PROGRAM Wrap;
+	DECLARE INTEGER x, big;
+	BEGIN
+		SET x = 100000;
+		SET x = x * x;
+		WRITE x;
+		SET big = 2147483647;
+		SET big = big + 1;
+		WRITE big, -big, big / -1, big - 1;
+		WRITE 100000 * 100000, 65536 * 65536, -2147483648, - -2147483648, 2147483647 + 1;
+		READ x;
+		WRITE x, x * 2
+	END.
+`
+
+const wrapOutput = `1410065408
+-2147483648 -2147483648 -2147483648 2147483647
+1410065408 0 -2147483648 -2147483648 -2147483648
+2147483647 -2
+`
+
+func TestIntegerWidth(t *testing.T) {
+	targets := []struct {
+		name string
+		//Builds the program in a directory and gives the executable,
+		//or "" if the tools it needs are missing
+		build func(t *testing.T, prog *Program, dir string) string
+	}{
+		{"c", buildC},
+		{"go", buildGo},
+		{"llvm", buildLLVM},
+	}
+
+	prog := parseSource(t, wrapProgram)
+	if got := interpret(t, wrapProgram, "2147483647"); got != wrapOutput {
+		t.Errorf("the interpreter wrote\n%s\nwant\n%s", got, wrapOutput)
+	}
+	var out bytes.Buffer
+	if err := NewVM(CompileBytecode(prog), strings.NewReader("2147483647"), &out).Run(); err != nil {
+		t.Errorf("vm: %v", err)
+	} else if out.String() != wrapOutput {
+		t.Errorf("the vm wrote\n%s\nwant\n%s", out.String(), wrapOutput)
+	}
+
+	//A number read must fit as well
+	err := NewInterpreter(prog, strings.NewReader("2147483648"), new(bytes.Buffer)).Run()
+	if err == nil {
+		t.Errorf("the interpreter read 2147483648")
+	}
+	if err := NewVM(CompileBytecode(prog), strings.NewReader("2147483648"), new(bytes.Buffer)).Run(); err == nil {
+		t.Errorf("the vm read 2147483648")
+	}
+
+	for _, target := range targets {
+		exe := target.build(t, prog, t.TempDir())
+		if exe == "" {
+			continue
+		}
+		cmd := exec.Command(exe)
+		cmd.Stdin = strings.NewReader("2147483647")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Errorf("%s: running the program: %v", target.name, err)
+		} else if string(out) != wrapOutput {
+			t.Errorf("%s wrote\n%s\nwant\n%s", target.name, out, wrapOutput)
+		}
+		cmd = exec.Command(exe)
+		cmd.Stdin = strings.NewReader("2147483648")
+		if err := cmd.Run(); err == nil {
+			t.Errorf("%s read 2147483648", target.name)
+		}
+	}
+}
+
+// writeSource() - Write generated source into dir
+func writeSource(t *testing.T, dir, name string, generate func(*bytes.Buffer) error) string {
+	t.Helper()
+	var src bytes.Buffer
+	if err := generate(&src); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, src.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// run() - Run a build step, failing the test if it fails
+func run(t *testing.T, name string, args ...string) bool {
+	t.Helper()
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		t.Errorf("%s: %v\n%s", name, err, out)
+		return false
+	}
+	return true
+}
+
+func buildC(t *testing.T, prog *Program, dir string) string {
+	gcc, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Log("gcc is not installed")
+		return ""
+	}
+	src := writeSource(t, dir, "prog.c", func(w *bytes.Buffer) error { return GenerateC(prog, w) })
+	exe := filepath.Join(dir, "prog")
+	if !run(t, gcc, "-std=c99", "-pedantic-errors", "-Wall", "-Werror", "-o", exe, src) {
+		return ""
+	}
+	return exe
+}
+
+func buildGo(t *testing.T, prog *Program, dir string) string {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Log("go is not installed")
+		return ""
+	}
+	src := writeSource(t, dir, "prog.go", func(w *bytes.Buffer) error { return GenerateGo(prog, w) })
+	exe := filepath.Join(dir, "prog")
+	if !run(t, goTool, "build", "-o", exe, src) {
+		return ""
+	}
+	return exe
+}
+
+func buildLLVM(t *testing.T, prog *Program, dir string) string {
+	llc, err := exec.LookPath("llc")
+	gcc, err2 := exec.LookPath("gcc")
+	if err != nil || err2 != nil {
+		t.Log("llc or gcc is not installed")
+		return ""
+	}
+	src := writeSource(t, dir, "prog.ll", func(w *bytes.Buffer) error { return GenerateLLVM(GenerateIR(prog), w) })
+	obj, exe := filepath.Join(dir, "prog.o"), filepath.Join(dir, "prog")
+	if !run(t, llc, "-filetype=obj", "-relocation-model=pic", "-o", obj, src) ||
+		!run(t, gcc, "-o", exe, obj, filepath.Join("..", "runtime", "japcrt.c")) {
+		return ""
+	}
+	return exe
+}
@@ -0,0 +1,285 @@
+package pascomp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+//////////////////////////Interpreter Implementation//////////////////////////
+//Executes a parsed Program by walking its tree.  Every variable lives in a
+//frame keyed by its attribute table index; the program's variables are in
+//the global frame and each call gets a fresh frame for the procedure's
+//parameters and locals.  Integers wrap around at 32 bits as they do in
+//the compiled targets.
+
+// RuntimeError is returned by Run when the program cannot continue
+type RuntimeError struct {
+	Line int
+	Msg  string
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("runtime error: %s on line #%d", e.Msg, e.Line)
+}
+
+// A value of either data type and whether it has been assigned yet
+type cell struct {
+	set  bool
+	ival int
+	rval float64
+}
+
+type frame map[int]*cell
+
+type Interpreter struct {
+	prog    *Program
+	st      *SymbolTable
+	in      *bufio.Reader
+	out     *bufio.Writer
+	globals frame
+	procs   map[int]*Procedure
+}
+
+// NewInterpreter() -	Create an interpreter for prog which reads
+//						from in and writes to out
+func NewInterpreter(prog *Program, in io.Reader, out io.Writer) *Interpreter {
+	interp := &Interpreter{
+		prog:    prog,
+		st:      prog.St,
+		in:      bufio.NewReader(in),
+		out:     bufio.NewWriter(out),
+		globals: make(frame),
+		procs:   make(map[int]*Procedure),
+	}
+	for _, proc := range prog.Block.Procs {
+		interp.procs[proc.Index] = proc
+	}
+	return interp
+}
+
+// Run() -	Execute the program.  Output written before a runtime
+//			error is flushed before the error is returned
+func (this *Interpreter) Run() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rerr, ok := r.(*RuntimeError)
+			if !ok {
+				panic(r)
+			}
+			err = rerr
+		}
+		if ferr := this.out.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+
+	for _, v := range this.prog.Block.Vars {
+		this.globals[v] = new(cell)
+	}
+	this.execStmts(this.prog.Block.Body, nil)
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Private Interpreter Functions
+////////////////////////////////////////////////////////////////////
+
+func (this *Interpreter) execStmts(stmts []Stmt, locals frame) {
+	for _, stmt := range stmts {
+		this.exec(stmt, locals)
+	}
+}
+
+func (this *Interpreter) exec(stmt Stmt, locals frame) {
+	switch s := stmt.(type) {
+	case *SetStmt:
+		*this.lookup(s.Target, locals) = this.eval(s.Value, locals)
+
+	case *ReadStmt:
+		for _, target := range s.Targets {
+			this.read(s.Pos, target, this.lookup(target, locals))
+		}
+
+	case *WriteStmt:
+		for i, value := range s.Values {
+			if i > 0 {
+				this.out.WriteByte(' ')
+			}
+			this.out.WriteString(formatValue(value.Type(), this.eval(value, locals)))
+		}
+		this.out.WriteByte('\n')
+
+	case *IfStmt:
+		if this.test(s.Cond, locals) {
+			this.execStmts(s.Then, locals)
+		} else {
+			this.execStmts(s.Else, locals)
+		}
+
+	case *WhileStmt:
+		for this.test(s.Cond, locals) {
+			this.execStmts(s.Body, locals)
+		}
+
+	case *UntilStmt:
+		for !this.test(s.Cond, locals) {
+			this.execStmts(s.Body, locals)
+		}
+
+	case *CallStmt:
+		this.call(s, locals)
+	}
+}
+
+func (this *Interpreter) call(s *CallStmt, locals frame) {
+	proc := this.procs[s.Proc]
+	callee := make(frame)
+
+	//Arguments are evaluated in the caller's frame and passed by value
+	for i, arg := range s.Args {
+		value := this.eval(arg, locals)
+		callee[proc.Params[i]] = &value
+	}
+	for _, v := range proc.Block.Vars {
+		callee[v] = new(cell)
+	}
+	this.execStmts(proc.Block.Body, callee)
+}
+
+// lookup() -	Find a variable's storage, first among the
+//				procedure's locals then among the globals
+func (this *Interpreter) lookup(tabindex int, locals frame) *cell {
+	if c, ok := locals[tabindex]; ok {
+		return c
+	}
+	return this.globals[tabindex]
+}
+
+func (this *Interpreter) read(pos Pos, target int, c *cell) {
+	var word string
+	if _, err := fmt.Fscan(this.in, &word); err != nil {
+		this.errorAt(pos, "no input left to read %s", this.st.Getlexeme(target))
+	}
+
+	var err error
+	if this.st.Getdatatype(target) == Dtinteger {
+		var n int64
+		n, err = strconv.ParseInt(word, 10, 32)
+		c.ival, c.rval = int(n), float64(n)
+	} else {
+		c.rval, err = strconv.ParseFloat(word, 64)
+	}
+	if err != nil {
+		this.errorAt(pos, "%q is not a valid %s for %s", word,
+			this.st.Getdatatype(target).String()[2:], this.st.Getlexeme(target))
+	}
+	c.set = true
+}
+
+func (this *Interpreter) test(cond *Cond, locals frame) bool {
+	x, y := this.eval(cond.Left, locals), this.eval(cond.Right, locals)
+	if cond.Left.Type() == Dtinteger {
+		return compare(cond.Op, x.ival, y.ival)
+	}
+	return rcompare(cond.Op, x.rval, y.rval)
+}
+
+func (this *Interpreter) eval(expr Expr, locals frame) cell {
+	switch e := expr.(type) {
+	case *Ident:
+		c := this.lookup(e.Index, locals)
+		if !c.set {
+			this.errorAt(e.Pos, "%s is used before it is assigned a value", this.st.Getlexeme(e.Index))
+		}
+		return *c
+
+	case *Literal:
+		return cell{set: true, ival: e.Ival, rval: e.Rval}
+
+	case *Negate:
+		x := this.eval(e.X, locals)
+		return cell{set: true, ival: wrapInteger(-x.ival), rval: -x.rval}
+
+	case *Float:
+		x := this.eval(e.X, locals)
+		return cell{set: true, rval: float64(x.ival)}
+
+	case *Binary:
+		x, y := this.eval(e.Left, locals), this.eval(e.Right, locals)
+		if e.Dt == Dtinteger {
+			if e.Op == Tokslash && y.ival == 0 {
+				this.errorAt(e.Pos, "division by zero")
+			}
+			v := arith(e.Op, x.ival, y.ival)
+			return cell{set: true, ival: v, rval: float64(v)}
+		}
+		if e.Op == Tokslash && y.rval == 0 {
+			this.errorAt(e.Pos, "division by zero")
+		}
+		return cell{set: true, rval: rarith(e.Op, x.rval, y.rval)}
+	}
+	panic(fmt.Sprintf("interpreter: unexpected expression %T", expr))
+}
+
+func (this *Interpreter) errorAt(pos Pos, format string, args ...interface{}) {
+	panic(&RuntimeError{Line: pos.Line, Msg: fmt.Sprintf(format, args...)})
+}
+
+// formatValue() -	The text WRITE produces for a value; reals use
+//					six significant digits like C's %g
+func formatValue(dt DataType, c cell) string {
+	if dt == Dtinteger {
+		return strconv.Itoa(c.ival)
+	}
+	return strconv.FormatFloat(c.rval, 'g', 6, 64)
+}
+
+func arith(op TokenType, x, y int) int {
+	switch op {
+	case Tokplus:
+		return wrapInteger(x + y)
+	case Tokminus:
+		return wrapInteger(x - y)
+	case Tokstar:
+		return wrapInteger(x * y)
+	}
+	return wrapInteger(x / y)
+}
+
+func rarith(op TokenType, x, y float64) float64 {
+	switch op {
+	case Tokplus:
+		return x + y
+	case Tokminus:
+		return x - y
+	case Tokstar:
+		return x * y
+	}
+	return x / y
+}
+
+func compare(op TokenType, x, y int) bool {
+	switch op {
+	case Tokequals:
+		return x == y
+	case Tokgreater:
+		return x > y
+	case Tokless:
+		return x < y
+	}
+	return x != y
+}
+
+func rcompare(op TokenType, x, y float64) bool {
+	switch op {
+	case Tokequals:
+		return x == y
+	case Tokgreater:
+		return x > y
+	case Tokless:
+		return x < y
+	}
+	return x != y
+}
@@ -0,0 +1,342 @@
+package pascomp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//////////////////////////Intermediate Code//////////////////////////
+//Lowers the tree into three-address quadruples.  Every operand is an
+//attribute table index: variables, parameters and literals name their
+//own entries, intermediate results are temporaries installed as Sttempvar
+//entries (labelled _tN) and jump targets are Stlabel entries (_loopN).
+//Temporaries and labels belong to the procedure they are used in.
+
+type IrOp int
+
+const (
+	IrAssign  IrOp = iota // Result := Arg1
+	IrAdd                 // Result := Arg1 + Arg2
+	IrSub                 // Result := Arg1 - Arg2
+	IrMul                 // Result := Arg1 * Arg2
+	IrDiv                 // Result := Arg1 / Arg2
+	IrNeg                 // Result := -Arg1
+	IrFloat               // Result := _float Arg1
+	IrLabel               // Result:
+	IrGoto                // goto Result
+	IrIf                  // if Arg1 Rel Arg2 goto Result
+	IrIffalse             // iffalse Arg1 Rel Arg2 goto Result
+	IrRead                // read Result
+	IrWrite               // write Arg1
+	IrWritesp             // write the space between values
+	IrWriteln             // end the line of output
+	IrParam               // param Arg1
+	IrCall                // call Arg1, Arg2 is the number of params
+	IrReturn              // return
+)
+
+var irOpNames = [...]string{"assign", "add", "sub", "mul", "div", "neg",
+	"float", "label", "goto", "if", "iffalse", "read", "write",
+	"writesp", "writeln", "param", "call", "return"}
+
+func (op IrOp) String() string {
+	return irOpNames[op]
+}
+
+// The arithmetic operator each arithmetic quadruple prints with
+var irOpSymbols = map[IrOp]string{IrAdd: "+", IrSub: "-", IrMul: "*", IrDiv: "/"}
+
+// The relational operators as they print in the dump
+var relSymbols = map[TokenType]string{Tokequals: "=", Tokgreater: ">", Tokless: "<", Toknotequal: "!"}
+
+// Quad is a single three-address instruction.  Unused operands are -1.
+type Quad struct {
+	Op         IrOp
+	Rel        TokenType
+	Arg1, Arg2 int
+	Result     int
+	Line       int
+	Columns    [2]int // where Arg1 and Arg2 were written, for diagnostics
+}
+
+// IrProc is the code for the main program or one procedure
+type IrProc struct {
+	Index  int   // the program's or procedure's attribute table index
+	Params []int // parameters in the order they are passed
+	Vars   []int // declared variables
+	Temps  []int // temporaries created while lowering
+	Code   []Quad
+}
+
+type IrProgram struct {
+	St       *SymbolTable
+	Procs    []*IrProc   // Procs[0] is the main program
+	Declared map[int]Pos // where the program's names were declared
+}
+
+type irGenerator struct {
+	st   *SymbolTable
+	proc *IrProc
+}
+
+// GenerateIR() - Lower a parsed program into quadruples
+func GenerateIR(prog *Program) *IrProgram {
+	this := &irGenerator{st: prog.St}
+	ir := &IrProgram{St: prog.St, Declared: prog.Declared}
+
+	ir.Procs = append(ir.Procs, this.lowerProc(prog.Name, nil, prog.Block))
+	for _, proc := range prog.Block.Procs {
+		ir.Procs = append(ir.Procs, this.lowerProc(proc.Index, proc.Params, proc.Block))
+	}
+	return ir
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Lowering
+////////////////////////////////////////////////////////////////////
+
+func (this *irGenerator) lowerProc(index int, params []int, block *Block) *IrProc {
+	this.proc = &IrProc{Index: index, Params: params, Vars: block.Vars}
+	this.stmts(block.Body)
+	this.emit(Quad{Op: IrReturn})
+	return this.proc
+}
+
+func (this *irGenerator) stmts(stmts []Stmt) {
+	for _, stmt := range stmts {
+		this.stmt(stmt)
+	}
+}
+
+func (this *irGenerator) stmt(stmt Stmt) {
+	line := stmt.Position().Line
+
+	switch s := stmt.(type) {
+	case *SetStmt:
+		this.into(s.Value, s.Target)
+
+	case *ReadStmt:
+		for _, target := range s.Targets {
+			this.emit(Quad{Op: IrRead, Result: target, Line: line})
+		}
+
+	case *WriteStmt:
+		for i, value := range s.Values {
+			if i > 0 {
+				this.emit(Quad{Op: IrWritesp, Line: line})
+			}
+			this.emit(Quad{Op: IrWrite, Arg1: this.expr(value), Line: line, Columns: columns(value)})
+		}
+		this.emit(Quad{Op: IrWriteln, Line: line})
+
+	case *IfStmt:
+		elseLabel := this.label()
+		this.branch(IrIffalse, s.Cond, elseLabel)
+		this.stmts(s.Then)
+		if s.Else == nil {
+			this.place(elseLabel)
+			break
+		}
+		endLabel := this.label()
+		this.emit(Quad{Op: IrGoto, Result: endLabel, Line: line})
+		this.place(elseLabel)
+		this.stmts(s.Else)
+		this.place(endLabel)
+
+	case *WhileStmt:
+		top, exit := this.label(), this.label()
+		this.place(top)
+		this.branch(IrIffalse, s.Cond, exit)
+		this.stmts(s.Body)
+		this.emit(Quad{Op: IrGoto, Result: top, Line: line})
+		this.place(exit)
+
+	case *UntilStmt:
+		top, exit := this.label(), this.label()
+		this.place(top)
+		this.branch(IrIf, s.Cond, exit)
+		this.stmts(s.Body)
+		this.emit(Quad{Op: IrGoto, Result: top, Line: line})
+		this.place(exit)
+
+	case *CallStmt:
+		//Evaluate every argument before passing any of them
+		args := make([]int, len(s.Args))
+		for i, arg := range s.Args {
+			args[i] = this.expr(arg)
+		}
+		for i, arg := range args {
+			this.emit(Quad{Op: IrParam, Arg1: arg, Line: line, Columns: columns(s.Args[i])})
+		}
+		this.emit(Quad{Op: IrCall, Arg1: s.Proc, Arg2: len(args), Line: line})
+	}
+}
+
+// branch() - Jump to label when cond is true (IrIf) or false (IrIffalse)
+func (this *irGenerator) branch(op IrOp, cond *Cond, label int) {
+	x, y := this.expr(cond.Left), this.expr(cond.Right)
+	this.emit(Quad{Op: op, Rel: cond.Op, Arg1: x, Arg2: y, Result: label, Line: cond.Line,
+		Columns: columns(cond.Left, cond.Right)})
+}
+
+// columns() - Where the operands of a quadruple were written
+func columns(exprs ...Expr) (cols [2]int) {
+	for i, e := range exprs {
+		cols[i] = e.Position().Column
+	}
+	return
+}
+
+// expr() -	Lower an expression and return the operand holding its
+//			value, creating a temporary if it needs computing
+func (this *irGenerator) expr(expr Expr) int {
+	switch e := expr.(type) {
+	case *Ident:
+		return e.Index
+	case *Literal:
+		return e.Index
+	}
+	temp := this.st.Installtemp(this.proc.Index, Sttempvar, expr.Type())
+	this.proc.Temps = append(this.proc.Temps, temp)
+	this.into(expr, temp)
+	return temp
+}
+
+// into() - Lower an expression storing its value in result
+func (this *irGenerator) into(expr Expr, result int) {
+	q := Quad{Result: result, Arg2: -1, Line: expr.Position().Line}
+
+	switch e := expr.(type) {
+	case *Binary:
+		ops := map[TokenType]IrOp{Tokplus: IrAdd, Tokminus: IrSub, Tokstar: IrMul, Tokslash: IrDiv}
+		q.Op, q.Arg1 = ops[e.Op], this.expr(e.Left)
+		q.Arg2 = this.expr(e.Right)
+		q.Columns = columns(e.Left, e.Right)
+	case *Negate:
+		q.Op, q.Arg1 = IrNeg, this.expr(e.X)
+		q.Columns = columns(e.X)
+	case *Float:
+		q.Op, q.Arg1 = IrFloat, this.expr(e.X)
+		q.Columns = columns(e.X)
+	default:
+		q.Op, q.Arg1 = IrAssign, this.expr(expr)
+		q.Columns = columns(expr)
+	}
+	this.emit(q)
+}
+
+func (this *irGenerator) label() int {
+	return this.st.Installtemp(this.proc.Index, Stlabel, Dtnone)
+}
+
+func (this *irGenerator) place(label int) {
+	this.emit(Quad{Op: IrLabel, Result: label})
+}
+
+// emit() -	Append a quadruple; operands the caller did not
+//			set are marked unused
+func (this *irGenerator) emit(q Quad) {
+	switch q.Op {
+	case IrLabel, IrGoto, IrRead:
+		q.Arg1, q.Arg2 = -1, -1
+	case IrWrite, IrParam:
+		q.Arg2, q.Result = -1, -1
+	case IrCall:
+		q.Result = -1
+	case IrWritesp, IrWriteln, IrReturn:
+		q.Arg1, q.Arg2, q.Result = -1, -1, -1
+	}
+	this.proc.Code = append(this.proc.Code, q)
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Textual Dump
+////////////////////////////////////////////////////////////////////
+
+// Operand() -	The name an operand prints with.  Temporaries and
+//				labels are named _tN and _loopN like makelabel does
+//				even after a code generator has relabelled them.
+func (this *IrProgram) Operand(tabindex int) string {
+	switch this.St.Getsmclass(tabindex) {
+	case Sttempvar, Stlabel:
+		return strings.ToLower(this.St.Getlexeme(tabindex))
+	}
+	return this.St.Getlexeme(tabindex)
+}
+
+// Format() - One quadruple as it appears in the dump
+func (this *IrProgram) Format(q Quad) string {
+	return formatQuad(q, this.operandOrBlank(q.Arg1), this.operandOrBlank(q.Arg2), this.operandOrBlank(q.Result))
+}
+
+// formatQuad() -	A quadruple printed with the names given for its
+//					operands
+func formatQuad(q Quad, a, b, r string) string {
+	switch q.Op {
+	case IrAssign:
+		return fmt.Sprintf("%s := %s", r, a)
+	case IrAdd, IrSub, IrMul, IrDiv:
+		return fmt.Sprintf("%s := %s %s %s", r, a, irOpSymbols[q.Op], b)
+	case IrNeg:
+		return fmt.Sprintf("%s := - %s", r, a)
+	case IrFloat:
+		return fmt.Sprintf("%s := _float %s", r, a)
+	case IrLabel:
+		return r + ":"
+	case IrGoto:
+		return "goto " + r
+	case IrIf, IrIffalse:
+		return fmt.Sprintf("%s %s %s %s goto %s", q.Op, a, relSymbols[q.Rel], b, r)
+	case IrRead:
+		return "read " + r
+	case IrWrite, IrParam:
+		return fmt.Sprintf("%s %s", q.Op, a)
+	case IrCall:
+		return fmt.Sprintf("call %s, %d", a, q.Arg2)
+	}
+	return q.Op.String()
+}
+
+func (this *IrProgram) operandOrBlank(tabindex int) string {
+	if tabindex < 0 {
+		return ""
+	}
+	return this.Operand(tabindex)
+}
+
+// Dump() -	Write the quadruples for every procedure.  Labels start
+//			in the first column and instructions are indented so
+//			that dumps can be compared line by line.
+func (this *IrProgram) Dump(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for i, p := range this.Procs {
+		if i > 0 {
+			fmt.Fprintln(bw)
+		}
+		kind := "procedure"
+		if i == 0 {
+			kind = "program"
+		}
+		fmt.Fprintf(bw, "%s %s\n", kind, this.St.Getlexeme(p.Index))
+		this.declare(bw, "param", p.Params)
+		this.declare(bw, "var", p.Vars)
+		this.declare(bw, "temp", p.Temps)
+
+		for _, q := range p.Code {
+			if q.Op == IrLabel {
+				fmt.Fprintln(bw, this.Format(q))
+			} else {
+				fmt.Fprintf(bw, "\t%s\n", this.Format(q))
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func (this *IrProgram) declare(w io.Writer, kind string, names []int) {
+	for _, n := range names {
+		fmt.Fprintf(w, "\t%-5s %s %s\n", kind, strings.TrimPrefix(this.St.Getdatatype(n).String(), "dt"), this.Operand(n))
+	}
+}
@@ -0,0 +1,366 @@
+package pascomp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+//////////////////////////Lint//////////////////////////
+//Lint checks a program that compiles for things that are legal but
+//likely mistakes or hard to read: names declared and never used, a
+//procedure's name hiding one from outside it, over long names, empty
+//procedures, conditions that cannot change and numbers written in
+//statements instead of named in CONST.  A name hides another when
+//the parser had to open a scope for it, so the attribute table's
+//outer scope link leads to what it hides.  A literal that stands for
+//a named constant sits where the constant's name was read and is not
+//a magic number.
+//
+//Each check is a rule named as in Rules and any can be turned off in
+//a configuration file.  A comment holding lint:ignore silences every
+//rule, or only the rules named after it, on its own line or, when the
+//comment is all there is on its line, on the line after it:
+//
+//	SET area = side * side * 4 {lint:ignore magic-number}
+
+// The rules Lint checks
+var lintCodes = []string{codeUnused, codeUnread, codeShadowed, codeLongName,
+	codeEmptyProcedure, codeConstantCond, codeMagicNumber}
+
+// LintConfig is which rules Lint checks and how
+type LintConfig struct {
+	Rules          map[string]bool `json:"rules"` // each rule turned on or off by name; every rule is on otherwise
+	MaxNameLength  int             `json:"max-name-length"`
+	AllowedNumbers []float64       `json:"allowed-numbers"` // the numbers that are never magic
+}
+
+// DefaultLintConfig() - Every rule on with the usual limits
+func DefaultLintConfig() LintConfig {
+	return LintConfig{Rules: map[string]bool{}, MaxNameLength: 16, AllowedNumbers: []float64{0, 1}}
+}
+
+// ReadLintConfig() -	Read a configuration as JSON, such as
+//						{"rules": {"magic-number": false}, "max-name-length": 12}
+//						over the defaults; unknown fields and rules are errors
+func ReadLintConfig(r io.Reader) (LintConfig, error) {
+	config := DefaultLintConfig()
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return config, fmt.Errorf("lint configuration: %v", err)
+	}
+	for name := range config.Rules {
+		if lintCode(name) == "" {
+			return config, fmt.Errorf("lint configuration: unknown rule %q; use one of %s",
+				name, strings.Join(LintRuleNames(), ", "))
+		}
+	}
+	if config.MaxNameLength < 1 {
+		return config, fmt.Errorf("lint configuration: max-name-length must be at least 1")
+	}
+	return config, nil
+}
+
+// LintRuleNames() - The names of the rules Lint checks
+func LintRuleNames() []string {
+	var names []string
+	for _, code := range lintCodes {
+		names = append(names, ruleName(code))
+	}
+	return names
+}
+
+// ruleName() - The name Rules gives a code
+func ruleName(code string) string {
+	for _, r := range Rules {
+		if r.ID == code {
+			return r.Name
+		}
+	}
+	return ""
+}
+
+// lintCode() - The code of the lint rule with a name, or "" if none has it
+func lintCode(name string) string {
+	for _, code := range lintCodes {
+		if ruleName(code) == name {
+			return code
+		}
+	}
+	return ""
+}
+
+// Lint() -	Check a program against the rules a configuration turns
+//			on, in the order of the lines they are about.  A program
+//			with an error is not checked and the *SyntaxError is
+//			returned.
+func Lint(source []byte, config LintConfig) ([]Warning, error) {
+	var scanner Scanner
+	scanner.NewScannerReader(bytes.NewReader(source))
+	parser := NewParser(&scanner)
+	prog, err := parser.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	this := &linter{config: config, st: prog.St, declared: make(map[int]Pos), named: make(map[Pos]bool)}
+	for index, pos := range prog.Declared {
+		this.declared[index] = pos
+	}
+	for _, ref := range parser.References() {
+		this.named[ref.Pos] = true
+		//The program's name is declared where it is first read
+		if _, ok := this.declared[ref.Index]; !ok && ref.Index == prog.Name {
+			this.declared[ref.Index] = ref.Pos
+		}
+	}
+	if this.on(codeUnused) || this.on(codeUnread) {
+		for _, w := range Unused(GenerateIR(prog)) {
+			this.report(w)
+		}
+	}
+	this.names()
+	for _, proc := range prog.Block.Procs {
+		if len(proc.Block.Body) == 0 && this.on(codeEmptyProcedure) {
+			pos := prog.Declared[proc.Index]
+			this.report(Warning{Line: pos.Line, Column: pos.Column,
+				Msg:     fmt.Sprintf("procedure %s has no statements", this.st.Getlexeme(proc.Index)),
+				Details: Details{Code: codeEmptyProcedure}})
+		}
+		this.stmts(proc.Block.Body)
+	}
+	this.stmts(prog.Block.Body)
+
+	ignored := lintIgnores(source)
+	var warnings []Warning
+	for _, w := range this.warnings {
+		if rules, ok := ignored[w.Line]; ok && (rules == nil || rules[ruleName(w.Code)]) {
+			continue
+		}
+		warnings = append(warnings, w)
+	}
+	sort.SliceStable(warnings, func(i, j int) bool {
+		if warnings[i].Line != warnings[j].Line {
+			return warnings[i].Line < warnings[j].Line
+		}
+		return warnings[i].Column < warnings[j].Column
+	})
+	return warnings, nil
+}
+
+// linter gathers what the rules find in one program
+type linter struct {
+	config   LintConfig
+	st       *SymbolTable
+	declared map[int]Pos
+	named    map[Pos]bool // where names were read, so a literal there is a named constant
+	warnings []Warning
+}
+
+// on() - Whether the configuration turns a rule on
+func (this *linter) on(code string) bool {
+	on, ok := this.config.Rules[ruleName(code)]
+	return on || !ok
+}
+
+// report() - Keep a warning if its rule is on
+func (this *linter) report(w Warning) {
+	if this.on(w.Code) {
+		this.warnings = append(this.warnings, w)
+	}
+}
+
+// The words for the semantic types of what can be declared
+var lintKinds = map[SemanticType]string{Stprogram: "program", Stprocedure: "procedure",
+	Stparameter: "parameter", Stvariable: "variable", Stconstant: "constant"}
+
+// names() -	Check every declared name for hiding another and for its
+//				length
+func (this *linter) names() {
+	var entries []int
+	for index := range this.declared {
+		entries = append(entries, index)
+	}
+	sort.Ints(entries)
+
+	for _, index := range entries {
+		pos := this.declared[index]
+		kind, name := lintKinds[this.st.Getsmclass(index)], this.st.Getlexeme(index)
+
+		if outer := this.st.Getouterscope(index); outer >= 0 {
+			owner := this.st.Getproc(index)
+			this.report(Warning{Line: pos.Line, Column: pos.Column,
+				Msg: fmt.Sprintf("%s %s in %s %s hides the %s of the same name",
+					kind, name, lintKinds[this.st.Getsmclass(owner)], this.st.Getlexeme(owner),
+					lintKinds[this.st.Getsmclass(outer)]),
+				Details: Details{Code: codeShadowed, Related: declaredAt(this.declared, outer, "hidden name declared here")}})
+		}
+
+		if length := utf8.RuneCountInString(name); length > this.config.MaxNameLength {
+			this.report(Warning{Line: pos.Line, Column: pos.Column,
+				Msg: fmt.Sprintf("%s %s is %d characters long; the limit is %d",
+					kind, name, length, this.config.MaxNameLength),
+				Details: Details{Code: codeLongName}})
+		}
+	}
+}
+
+// stmts() - Check the conditions and numbers in statements
+func (this *linter) stmts(stmts []Stmt) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *SetStmt:
+			this.expr(s.Value)
+		case *WriteStmt:
+			for _, v := range s.Values {
+				this.expr(v)
+			}
+		case *CallStmt:
+			for _, a := range s.Args {
+				this.expr(a)
+			}
+		case *IfStmt:
+			this.cond(s.Cond)
+			this.stmts(s.Then)
+			this.stmts(s.Else)
+		case *WhileStmt:
+			this.cond(s.Cond)
+			this.stmts(s.Body)
+		case *UntilStmt:
+			this.cond(s.Cond)
+			this.stmts(s.Body)
+		}
+	}
+}
+
+// cond() -	Check a condition for not depending on any variable and
+//			the numbers in it
+func (this *linter) cond(cond *Cond) {
+	this.expr(cond.Left)
+	this.expr(cond.Right)
+	if readsVariable(cond.Left) || readsVariable(cond.Right) {
+		return
+	}
+	msg := "condition does not depend on any variable"
+	if value, ok := evalCondition(this.st, cond); ok {
+		msg = fmt.Sprintf("condition is always %t", value)
+	}
+	this.report(Warning{Line: cond.Line, Column: cond.Column, Msg: msg,
+		Details: Details{Code: codeConstantCond}})
+}
+
+// expr() - Check an expression for magic numbers
+func (this *linter) expr(expr Expr) {
+	switch e := expr.(type) {
+	case *Literal:
+		if this.named[e.Pos] {
+			return
+		}
+		for _, n := range this.config.AllowedNumbers {
+			if e.Rval == n {
+				return
+			}
+		}
+		this.report(Warning{Line: e.Line, Column: e.Column,
+			Msg:     fmt.Sprintf("magic number %s", this.st.Getlexeme(e.Index)),
+			Details: Details{Code: codeMagicNumber, Notes: []string{"name it in CONST to say what it means"}}})
+	case *Binary:
+		this.expr(e.Left)
+		this.expr(e.Right)
+	case *Negate:
+		this.expr(e.X)
+	case *Float:
+		this.expr(e.X)
+	}
+}
+
+// readsVariable() - Whether an expression reads a variable or parameter
+func readsVariable(expr Expr) bool {
+	switch e := expr.(type) {
+	case *Ident:
+		return true
+	case *Binary:
+		return readsVariable(e.Left) || readsVariable(e.Right)
+	case *Negate:
+		return readsVariable(e.X)
+	case *Float:
+		return readsVariable(e.X)
+	}
+	return false
+}
+
+// evalCondition() -	The value of a condition that reads no variable,
+//						as the interpreter finds it; not ok if it
+//						divides by zero
+func evalCondition(st *SymbolTable, cond *Cond) (value, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isRuntime := r.(*RuntimeError); !isRuntime {
+				panic(r)
+			}
+			ok = false
+		}
+	}()
+	interp := &Interpreter{st: st}
+	return interp.test(cond, nil), true
+}
+
+// lintIgnores() -	The lines lint:ignore comments silence, each with the
+//					rules named or nil for every rule
+func lintIgnores(source []byte) map[int]map[string]bool {
+	ignored := make(map[int]map[string]bool)
+	line, alone := 1, true
+	for at := 0; at < len(source); at++ {
+		switch c := source[at]; {
+		case c == '\n':
+			line, alone = line+1, true
+		case c == '{':
+			end := bytes.IndexByte(source[at:], '}')
+			if end < 0 {
+				//An unclosed comment runs to the end of the program
+				end = len(source) - at
+			}
+			text := string(source[at+1 : at+end])
+			start := line
+			line += strings.Count(text, "\n")
+			at += end
+
+			fields := strings.Fields(text)
+			if len(fields) == 0 || fields[0] != "lint:ignore" {
+				alone = false
+				continue
+			}
+			rest := bytes.TrimPrefix(source[at:], []byte("}"))
+			if eol := bytes.IndexByte(rest, '\n'); eol >= 0 {
+				rest = rest[:eol]
+			}
+			if alone && len(bytes.TrimSpace(rest)) == 0 {
+				start = line + 1
+			}
+			var rules map[string]bool
+			if len(fields) > 1 {
+				rules = make(map[string]bool)
+				for _, name := range fields[1:] {
+					rules[name] = true
+				}
+			}
+			if previous, ok := ignored[start]; ok && (previous == nil || rules == nil) {
+				rules = nil
+			} else if ok {
+				for name := range previous {
+					rules[name] = true
+				}
+			}
+			ignored[start] = rules
+			alone = false
+		case c != ' ' && c != '\t' && c != '\r':
+			alone = false
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,197 @@
+package pascomp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// lintFound() -	The warnings Lint gives a program as code@line, or
+//					fails the test if the program has an error
+func lintFound(t *testing.T, source string, config LintConfig) []string {
+	t.Helper()
+	warnings, err := Lint([]byte(source), config)
+	if err != nil {
+		t.Fatalf("lint: %v", err)
+	}
+	var found []string
+	for _, w := range warnings {
+		found = append(found, fmt.Sprintf("%s@%d", w.Code, w.Line))
+	}
+	return found
+}
+
+func TestLintUnclosedIgnore(t *testing.T) {
+	//The parser takes an unclosed comment at the end as the end of the
+	//program, so lint must too
+	for _, tail := range []string{"{lint:ignore", "{lint:ignore magic-number", "{lint:ignore\n", "{"} {
+		source := "PROGRAM T;\nDECLARE INTEGER a;\nBEGIN\n\tSET a = 7;\n\tWRITE a\nEND. " + tail
+		if found := lintFound(t, source, DefaultLintConfig()); fmt.Sprint(found) != "[L005@4]" {
+			t.Errorf("ending in %q found %v, want [L005@4]", tail, found)
+		}
+	}
+}
+
+func TestLintRules(t *testing.T) {
+	tests := []struct {
+		rule   string
+		source string
+		want   string // the rule's warnings as code@line
+	}{
+		{"unused-name", `PROGRAM T;
+	DECLARE INTEGER used, spare;
+	BEGIN
+		READ used;
+		WRITE used
+	END.
+`, "[W001@2]"},
+		{"unread-variable", `PROGRAM T;
+	DECLARE INTEGER a, kept;
+	BEGIN
+		READ a;
+		SET kept = a;
+		WRITE a
+	END.
+`, "[W002@2]"},
+		{"shadowed-name", `PROGRAM T;
+	DECLARE INTEGER count;
+	PROCEDURE Show PARAMETERS INTEGER count;
+	BEGIN
+		WRITE count
+	END;
+	BEGIN
+		READ count;
+		CALL Show(count)
+	END.
+`, "[L001@3]"},
+		{"long-name", `PROGRAM T;
+	DECLARE INTEGER short, averyveryverylongname;
+	BEGIN
+		READ short, averyveryverylongname;
+		WRITE short, averyveryverylongname
+	END.
+`, "[L002@2]"},
+		{"empty-procedure", `PROGRAM T;
+	PROCEDURE Nothing;
+	BEGIN
+	END;
+	BEGIN
+		CALL Nothing
+	END.
+`, "[L003@2]"},
+		{"constant-condition", `PROGRAM T;
+	DECLARE INTEGER a;
+	BEGIN
+		READ a;
+		IF 1 > 0 THEN
+			WRITE a
+		ENDIF;
+		WHILE a > 0 DO
+			SET a = a - 1
+		ENDWHILE
+	END.
+`, "[L004@5]"},
+		{"magic-number", `PROGRAM T;
+	CONST
+		limit = 10;
+	DECLARE INTEGER a;
+	BEGIN
+		READ a;
+		SET a = a * limit + 1;
+		WRITE a * 60
+	END.
+`, "[L005@8]"},
+	}
+	for _, test := range tests {
+		code := lintCode(test.rule)
+		var got []string
+		for _, found := range lintFound(t, test.source, DefaultLintConfig()) {
+			if strings.HasPrefix(found, code+"@") {
+				got = append(got, found)
+			}
+		}
+		if fmt.Sprint(got) != test.want {
+			t.Errorf("%s found %v, want %s", test.rule, got, test.want)
+		}
+
+		//Turning the rule off silences it and only it
+		config := DefaultLintConfig()
+		config.Rules[test.rule] = false
+		for _, found := range lintFound(t, test.source, config) {
+			if strings.HasPrefix(found, code+"@") {
+				t.Errorf("%s turned off still found %s", test.rule, found)
+			}
+		}
+	}
+}
+
+func TestLintLimits(t *testing.T) {
+	const source = `PROGRAM T;
+	DECLARE INTEGER counter;
+	BEGIN
+		READ counter;
+		WRITE counter * 60, counter * 2
+	END.
+`
+	config := DefaultLintConfig()
+	config.MaxNameLength = 6
+	config.AllowedNumbers = []float64{0, 1, 60}
+	if found := fmt.Sprint(lintFound(t, source, config)); found != "[L002@2 L005@5]" {
+		t.Errorf("found %s, want the long name and only the 2 as magic", found)
+	}
+}
+
+func TestLintIgnore(t *testing.T) {
+	tests := []struct {
+		name, body, want string
+	}{
+		{"same line", "\t\tWRITE a * 60 {lint:ignore}\n", "[]"},
+		{"named rule", "\t\tWRITE a * 60 {lint:ignore magic-number}\n", "[]"},
+		{"other rule", "\t\tWRITE a * 60 {lint:ignore long-name}\n", "[L005@5]"},
+		{"line before", "\t\t{lint:ignore magic-number}\n\t\tWRITE a * 60\n", "[]"},
+		//A comment after a statement covers only its own line
+		{"not the next line", "\t\tWRITE a {lint:ignore}\n\t\t; WRITE a * 60\n", "[L005@6]"},
+		{"not two lines on", "\t\t{lint:ignore}\n\n\t\tWRITE a * 60\n", "[L005@7]"},
+		{"two comments", "\t\tWRITE a * 60, 7 {lint:ignore long-name} {lint:ignore magic-number}\n", "[]"},
+		{"other comment", "\t\tWRITE a * 60 {ignore this}\n", "[L005@5]"},
+		{"multiline comment", "\t\t{lint:ignore\n\t\tmagic-number}\n\t\tWRITE a * 60\n", "[]"},
+	}
+	for _, test := range tests {
+		source := "PROGRAM T;\n\tDECLARE INTEGER a;\n\tBEGIN\n\t\tREAD a;\n" + test.body + "\tEND.\n"
+		if found := fmt.Sprint(lintFound(t, source, DefaultLintConfig())); found != test.want {
+			t.Errorf("%s found %s, want %s in\n%s", test.name, found, test.want, source)
+		}
+	}
+}
+
+func TestReadLintConfig(t *testing.T) {
+	tests := []struct {
+		json, err string
+	}{
+		{`{}`, ""},
+		{`{"rules": {"magic-number": false}, "max-name-length": 12, "allowed-numbers": [0, 1, 2]}`, ""},
+		{`{"rules": {"magic-numbers": false}}`, `unknown rule "magic-numbers"`},
+		{`{"max-length": 12}`, `unknown field "max-length"`},
+		{`{"max-name-length": 0}`, "max-name-length must be at least 1"},
+		{`{"rules": `, "unexpected EOF"},
+	}
+	for _, test := range tests {
+		_, err := ReadLintConfig(strings.NewReader(test.json))
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", test.json, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: error %v, want one about %s", test.json, err, test.err)
+		}
+	}
+
+	config, err := ReadLintConfig(strings.NewReader(`{"rules": {"magic-number": false}, "max-name-length": 12}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := &linter{config: config}
+	if read.on(codeMagicNumber) || !read.on(codeLongName) || config.MaxNameLength != 12 ||
+		fmt.Sprint(config.AllowedNumbers) != "[0 1]" {
+		t.Errorf("read %+v, want magic-number off over the defaults", config)
+	}
+}
@@ -0,0 +1,75 @@
+package pascomp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/kdgwill/golang_dev/JAPC_WIG/diagnostics"
+)
+
+//////////////////////////Source Listing//////////////////////////
+//A listing is the program as it was read with every line numbered and
+//its tabs expanded to tabStop columns.  Each error or warning follows
+//the line it is about with carets under the name or token it points
+//at, and the symbol table dump ends the listing.
+
+// Note is an error or warning as a listing shows it
+type Note struct {
+	Line   int
+	Column int    // counting characters from 1, or 0 if only the line is known
+	Text   string // such as "warning[W001]: variable X ... is declared but never used"
+}
+
+// WriteListing() -	Write the listing of a program read from source.
+//					The symbol table dump is left out if st is nil.
+func WriteListing(w io.Writer, title string, source []byte, notes []Note, st *SymbolTable) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "JAPC listing of %s\n\n", title)
+
+	notes = append([]Note(nil), notes...)
+	sort.SliceStable(notes, func(i, j int) bool {
+		if notes[i].Line != notes[j].Line {
+			return notes[i].Line < notes[j].Line
+		}
+		return notes[i].Column < notes[j].Column
+	})
+
+	text := strings.TrimSuffix(string(source), "\n")
+	lines := strings.Split(text, "\n")
+	if text == "" {
+		lines = nil
+	}
+	next := 0
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		fmt.Fprintf(bw, "%5d  %s\n", i+1, diagnostics.ExpandTabs(line, tabStop))
+		for ; next < len(notes) && notes[next].Line <= i+1; next++ {
+			listNote(bw, line, notes[next])
+		}
+	}
+	//Errors past the last line, such as an unexpected end of file
+	for ; next < len(notes); next++ {
+		listNote(bw, "", notes[next])
+	}
+
+	if st != nil {
+		fmt.Fprintln(bw)
+		WriteSymbolTable(bw, st)
+	}
+	return bw.Flush()
+}
+
+// listNote() -	Underline the token a note points at in its line and
+//				write the note beneath, both lined up with the source
+func listNote(w io.Writer, line string, note Note) {
+	const margin = "       "
+	runes := []rune(line)
+	if at := note.Column - 1; at >= 0 && at < len(runes) {
+		start := len([]rune(diagnostics.ExpandTabs(string(runes[:at]), tabStop)))
+		fmt.Fprintf(w, "%s%s%s\n", margin, strings.Repeat(" ", start), strings.Repeat("^", diagnostics.TokenWidth(runes[at:])))
+	}
+	fmt.Fprintf(w, "%s%s\n", margin, note.Text)
+}
@@ -0,0 +1,44 @@
+package pascomp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteListing(t *testing.T) {
+	prog := parseSource(t, constProgram)
+	var count int
+	prog.St.Installname("count", &count)
+	label := prog.St.Getlabelname(count)
+	if label == "" {
+		t.Fatal("COUNT has no label")
+	}
+
+	var out bytes.Buffer
+	notes := []Note{{Line: 5, Column: 11, Text: "warning: a note"}}
+	if err := WriteListing(&out, "sample.pas", []byte(constProgram), notes, prog.St); err != nil {
+		t.Fatal(err)
+	}
+	listing := out.String()
+
+	for _, want := range []string{
+		"JAPC listing of sample.pas\n",
+		"    5                  INTEGER count;\n" +
+			"                               ^^^^^\n",
+		"       warning: a note\n",
+		"SYMBOL TABLE DUMP\n",
+	} {
+		if !strings.Contains(listing, want) {
+			t.Errorf("listing has no %q in\n%s", want, listing)
+		}
+	}
+
+	fields := dumpFields(t, listing, "COUNT")
+	if got := fields[len(fields)-1]; got != label {
+		t.Errorf("COUNT has label %q, want %q", got, label)
+	}
+	if strings.ContainsAny(listing[strings.Index(listing, "SYMBOL TABLE DUMP"):], "[]\x00") {
+		t.Errorf("symbol table dump prints labels as runes:\n%s", listing)
+	}
+}
@@ -0,0 +1,322 @@
+package pascomp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//////////////////////////LLVM Code Generator//////////////////////////
+//Translates the quadruples into textual LLVM IR.  The program's variables
+//become internal globals; parameters, locals and temporaries become
+//allocas in the entry block of their function so that mem2reg can turn
+//them into registers.  Integers are i32 and reals double.  The main
+//program is @main and each procedure a void function taking its
+//parameters by value.  Input, output and runtime errors are done by the
+//small C runtime in runtime/japcrt.c:
+//	llc -filetype=obj prog.ll && cc prog.o runtime/japcrt.c
+
+type llvmGenerator struct {
+	ir         *IrProgram
+	st         *SymbolTable
+	w          *bytes.Buffer
+	main       int
+	locals     map[int]bool // symbols with an alloca in the current function
+	args       []string     // arguments passed since the last call
+	values     int          // the number of values named so far
+	blocks     int          // the number of blocks named so far
+	terminated bool         // whether the current block has ended
+}
+
+// The runtime functions every module declares
+const llvmDeclarations = `declare void @japc_write_int(i32)
+declare void @japc_write_real(double)
+declare i32 @putchar(i32)
+declare i32 @japc_read_int(i32)
+declare double @japc_read_real(i32)
+declare void @japc_divzero(i32) noreturn
+`
+
+// GenerateLLVM() -	Write the program as an LLVM module to w
+func GenerateLLVM(ir *IrProgram, w io.Writer) error {
+	this := &llvmGenerator{ir: ir, st: ir.St, w: new(bytes.Buffer), main: ir.Procs[0].Index}
+
+	fmt.Fprintf(this.w, "; %s - generated by JAPC\n\n", this.st.Getlexeme(this.main))
+	fmt.Fprint(this.w, llvmDeclarations)
+	for _, n := range ir.Procs[0].Vars {
+		fmt.Fprintf(this.w, "@%s = internal global %s %s\n", this.name(n), this.typ(n), this.zero(n))
+	}
+	for _, p := range ir.Procs {
+		this.function(p)
+	}
+
+	_, err := this.w.WriteTo(w)
+	return err
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Functions
+////////////////////////////////////////////////////////////////////
+
+func (this *llvmGenerator) function(p *IrProc) {
+	this.locals = make(map[int]bool)
+	this.values, this.blocks, this.terminated = 0, 0, false
+
+	if p.Index == this.main {
+		fmt.Fprintf(this.w, "\ndefine i32 @main() {\n")
+	} else {
+		params := make([]string, len(p.Params))
+		for i, n := range p.Params {
+			params[i] = fmt.Sprintf("%s %%%s.arg", this.typ(n), this.name(n))
+		}
+		fmt.Fprintf(this.w, "\ndefine void @%s(%s) {\n", this.name(p.Index), strings.Join(params, ", "))
+	}
+	fmt.Fprintln(this.w, "entry:")
+
+	//The program's variables are globals; everything else is a local
+	allocas := [][]int{p.Params, p.Vars, p.Temps}
+	if p.Index == this.main {
+		allocas = [][]int{p.Temps}
+	}
+	for _, list := range allocas {
+		for _, n := range list {
+			this.locals[n] = true
+			this.inst("%%%s = alloca %s", this.name(n), this.typ(n))
+		}
+	}
+	for _, n := range p.Params {
+		this.inst("store %s %%%s.arg, %s* %%%s", this.typ(n), this.name(n), this.typ(n), this.name(n))
+	}
+
+	for _, q := range p.Code {
+		this.quad(p, q)
+	}
+	fmt.Fprintln(this.w, "}")
+}
+
+func (this *llvmGenerator) quad(p *IrProc, q Quad) {
+	if q.Op == IrLabel {
+		this.label(this.name(q.Result))
+		return
+	}
+	if this.terminated {
+		//Code after a jump can only be reached by a label
+		this.label(this.block("dead"))
+	}
+
+	switch q.Op {
+	case IrAssign:
+		this.store(q.Result, this.value(q.Arg1))
+
+	case IrAdd, IrSub, IrMul, IrDiv:
+		a, b := this.value(q.Arg1), this.value(q.Arg2)
+		ops := map[IrOp]string{IrAdd: "add", IrSub: "sub", IrMul: "mul", IrDiv: "sdiv"}
+		if this.real(q.Result) {
+			ops = map[IrOp]string{IrAdd: "fadd", IrSub: "fsub", IrMul: "fmul", IrDiv: "fdiv"}
+		}
+		if q.Op == IrDiv {
+			this.divzeroCheck(q.Arg2, b, q.Line)
+			if !this.real(q.Result) {
+				this.store(q.Result, this.sdiv(a, b))
+				break
+			}
+		}
+		v := this.newValue()
+		this.inst("%s = %s %s %s, %s", v, ops[q.Op], this.typ(q.Result), a, b)
+		this.store(q.Result, v)
+
+	case IrNeg:
+		a, v := this.value(q.Arg1), this.newValue()
+		if this.real(q.Result) {
+			this.inst("%s = fneg double %s", v, a)
+		} else {
+			this.inst("%s = sub i32 0, %s", v, a)
+		}
+		this.store(q.Result, v)
+
+	case IrFloat:
+		a, v := this.value(q.Arg1), this.newValue()
+		this.inst("%s = sitofp i32 %s to double", v, a)
+		this.store(q.Result, v)
+
+	case IrGoto:
+		this.inst("br label %%%s", this.name(q.Result))
+		this.terminated = true
+
+	case IrIf, IrIffalse:
+		c := this.compare(q)
+		target, next := "%"+this.name(q.Result), this.block("next")
+		if q.Op == IrIf {
+			this.inst("br i1 %s, label %s, label %%%s", c, target, next)
+		} else {
+			this.inst("br i1 %s, label %%%s, label %s", c, next, target)
+		}
+		this.terminated = true
+		this.label(next)
+
+	case IrRead:
+		v := this.newValue()
+		if this.real(q.Result) {
+			this.inst("%s = call double @japc_read_real(i32 %d)", v, q.Line)
+		} else {
+			this.inst("%s = call i32 @japc_read_int(i32 %d)", v, q.Line)
+		}
+		this.store(q.Result, v)
+
+	case IrWrite:
+		a := this.value(q.Arg1)
+		if this.real(q.Arg1) {
+			this.inst("call void @japc_write_real(double %s)", a)
+		} else {
+			this.inst("call void @japc_write_int(i32 %s)", a)
+		}
+
+	case IrWritesp:
+		this.inst("call i32 @putchar(i32 32)")
+	case IrWriteln:
+		this.inst("call i32 @putchar(i32 10)")
+
+	case IrParam:
+		this.args = append(this.args, this.typ(q.Arg1)+" "+this.value(q.Arg1))
+
+	case IrCall:
+		this.inst("call void @%s(%s)", this.name(q.Arg1), strings.Join(this.args, ", "))
+		this.args = nil
+
+	case IrReturn:
+		if p.Index == this.main {
+			this.inst("ret i32 0")
+		} else {
+			this.inst("ret void")
+		}
+		this.terminated = true
+
+	default:
+		panic(fmt.Sprintf("llvm: cannot generate %s", q.Op))
+	}
+}
+
+// compare() - Compare a conditional jump's operands giving an i1
+func (this *llvmGenerator) compare(q Quad) string {
+	a, b := this.value(q.Arg1), this.value(q.Arg2)
+	v := this.newValue()
+	if this.real(q.Arg1) {
+		conds := map[TokenType]string{Tokequals: "oeq", Tokgreater: "ogt", Tokless: "olt", Toknotequal: "une"}
+		this.inst("%s = fcmp %s double %s, %s", v, conds[q.Rel], a, b)
+	} else {
+		conds := map[TokenType]string{Tokequals: "eq", Tokgreater: "sgt", Tokless: "slt", Toknotequal: "ne"}
+		this.inst("%s = icmp %s i32 %s, %s", v, conds[q.Rel], a, b)
+	}
+	return v
+}
+
+// divzeroCheck() - Stop with a runtime error if the divisor b is zero
+func (this *llvmGenerator) divzeroCheck(divisor int, b string, line int) {
+	c := this.newValue()
+	if this.real(divisor) {
+		this.inst("%s = fcmp oeq double %s, 0.0", c, b)
+	} else {
+		this.inst("%s = icmp eq i32 %s, 0", c, b)
+	}
+	fail, ok := this.block("divzero"), this.block("nonzero")
+	this.inst("br i1 %s, label %%%s, label %%%s", c, fail, ok)
+	this.terminated = true
+	this.label(fail)
+	this.inst("call void @japc_divzero(i32 %d)", line)
+	this.inst("unreachable")
+	this.terminated = true
+	this.label(ok)
+}
+
+// sdiv() -	Divide integers, wrapping the one quotient too big to fit
+//			around as the other targets do rather than leaving it undefined
+func (this *llvmGenerator) sdiv(a, b string) string {
+	minus, divisor, q, neg, v := this.newValue(), this.newValue(), this.newValue(), this.newValue(), this.newValue()
+	this.inst("%s = icmp eq i32 %s, -1", minus, b)
+	this.inst("%s = select i1 %s, i32 1, i32 %s", divisor, minus, b)
+	this.inst("%s = sdiv i32 %s, %s", q, a, divisor)
+	this.inst("%s = sub i32 0, %s", neg, a)
+	this.inst("%s = select i1 %s, i32 %s, i32 %s", v, minus, neg, q)
+	return v
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Operands
+////////////////////////////////////////////////////////////////////
+
+// value() -	A literal as a constant, anything else loaded from its
+//				memory into a new value
+func (this *llvmGenerator) value(tabindex int) string {
+	if this.st.Getsmclass(tabindex) == Stliteral {
+		if this.real(tabindex) {
+			v, _ := strconv.ParseFloat(this.st.Getlexeme(tabindex), 64)
+			return fmt.Sprintf("0x%016X", math.Float64bits(v))
+		}
+		return strconv.Itoa(int(int32(this.st.Getivalue(tabindex))))
+	}
+	v, t := this.newValue(), this.typ(tabindex)
+	this.inst("%s = load %s, %s* %s", v, t, t, this.pointer(tabindex))
+	return v
+}
+
+func (this *llvmGenerator) store(tabindex int, v string) {
+	t := this.typ(tabindex)
+	this.inst("store %s %s, %s* %s", t, v, t, this.pointer(tabindex))
+}
+
+func (this *llvmGenerator) pointer(tabindex int) string {
+	if this.locals[tabindex] {
+		return "%" + this.name(tabindex)
+	}
+	return "@" + this.name(tabindex)
+}
+
+// name() - The identifier a symbol has in the module
+func (this *llvmGenerator) name(tabindex int) string {
+	return this.ir.Operand(tabindex)
+}
+
+func (this *llvmGenerator) real(tabindex int) bool {
+	return this.st.Getdatatype(tabindex) == Dtreal
+}
+
+func (this *llvmGenerator) typ(tabindex int) string {
+	if this.real(tabindex) {
+		return "double"
+	}
+	return "i32"
+}
+
+func (this *llvmGenerator) zero(tabindex int) string {
+	if this.real(tabindex) {
+		return "0.0"
+	}
+	return "0"
+}
+
+func (this *llvmGenerator) newValue() string {
+	this.values++
+	return "%v" + strconv.Itoa(this.values)
+}
+
+// block() - A new block name that cannot clash with a label
+func (this *llvmGenerator) block(kind string) string {
+	this.blocks++
+	return kind + strconv.Itoa(this.blocks)
+}
+
+// label() - Start a block, falling into it from an unfinished one
+func (this *llvmGenerator) label(name string) {
+	if !this.terminated {
+		this.inst("br label %%%s", name)
+	}
+	fmt.Fprintf(this.w, "%s:\n", name)
+	this.terminated = false
+}
+
+func (this *llvmGenerator) inst(format string, args ...interface{}) {
+	fmt.Fprintf(this.w, "  "+format+"\n", args...)
+}
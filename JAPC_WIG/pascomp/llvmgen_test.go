@@ -0,0 +1,346 @@
+package pascomp
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// llvmFunction is a function definition as the tests pick it apart
+type llvmFunction struct {
+	header string
+	blocks [][]string // each block's label followed by its instructions
+}
+
+// llvmFunctions() - The function definitions in a module by name
+func llvmFunctions(t *testing.T, module string) map[string]*llvmFunction {
+	t.Helper()
+	define := regexp.MustCompile(`^define \w+ @([\w.]+)\(`)
+	functions := make(map[string]*llvmFunction)
+	var f *llvmFunction
+	for _, line := range strings.Split(module, "\n") {
+		switch {
+		case f == nil:
+			if m := define.FindStringSubmatch(line); m != nil {
+				f = &llvmFunction{header: line}
+				functions[m[1]] = f
+			}
+		case line == "}":
+			f = nil
+		case strings.HasSuffix(line, ":") && !strings.HasPrefix(line, " "):
+			f.blocks = append(f.blocks, []string{strings.TrimSuffix(line, ":")})
+		default:
+			if len(f.blocks) == 0 {
+				t.Fatalf("instruction before the first block: %q", line)
+			}
+			f.blocks[len(f.blocks)-1] = append(f.blocks[len(f.blocks)-1], strings.TrimSpace(line))
+		}
+	}
+	return functions
+}
+
+// generateLLVM() - The LLVM module for a program, optimized or not
+func generateLLVM(t *testing.T, source string, optimized bool) string {
+	t.Helper()
+	ir := GenerateIR(parseSource(t, source))
+	if optimized {
+		Optimize(ir)
+	}
+	var out bytes.Buffer
+	if err := GenerateLLVM(ir, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+const factProgram = `PROGRAM Sample3;
+	DECLARE
+		INTEGER n, i, total;
+		REAL average;
+
+	PROCEDURE Fact PARAMETERS INTEGER k;
+		DECLARE INTEGER product;
+	BEGIN
+		SET product = 1;
+		WHILE k > 1 DO
+			SET product = product * k;
+			SET k = k - 1
+		ENDWHILE;
+		WRITE product
+	END;
+
+	BEGIN
+		READ n;
+		SET i = 0;
+		SET total = 0;
+		UNTIL i = n DO
+			SET i = i + 1;
+			SET total = total + i
+		ENDUNTIL;
+		WRITE n, total;
+		IF n > 0 THEN
+			SET average = total / n;
+			WRITE average
+		ELSE
+			WRITE 0
+		ENDIF;
+		CALL Fact(n)
+	END.
+`
+
+func TestGenerateLLVM(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		functions map[string]string // each function's header
+		globals   []string
+		allocas   map[string][]string // the allocas each function's entry block starts with
+		contains  []string
+	}{
+		{
+			name:      "empty",
+			source:    "PROGRAM Empty;\nBEGIN\nEND.\n",
+			functions: map[string]string{"main": "define i32 @main() {"},
+			contains:  []string{"ret i32 0"},
+		},
+		{
+			name:      "arithmetic",
+			source:    "PROGRAM Calc;\nDECLARE\n\tINTEGER a, b;\n\tREAL r;\nBEGIN\n\tREAD a, b;\n\tSET r = a / b;\n\tWRITE -a * 2, r\nEND.\n",
+			functions: map[string]string{"main": "define i32 @main() {"},
+			globals: []string{"@A = internal global i32 0", "@B = internal global i32 0",
+				"@R = internal global double 0.0"},
+			allocas: map[string][]string{"main": {"= alloca i32"}},
+			contains: []string{"call i32 @japc_read_int(i32 6)", "sdiv i32", "icmp eq i32",
+				"call void @japc_divzero(i32 7)", "unreachable", "sitofp i32", "call void @japc_write_real(double"},
+		},
+		{
+			name:   "procedure",
+			source: factProgram,
+			functions: map[string]string{"main": "define i32 @main() {",
+				"FACT": "define void @FACT(i32 %K.arg) {"},
+			globals: []string{"@N = internal global i32 0", "@AVERAGE = internal global double 0.0"},
+			allocas: map[string][]string{"FACT": {"%K = alloca i32", "%PRODUCT = alloca i32"}},
+			contains: []string{"store i32 %K.arg, i32* %K", "icmp sgt i32", "ret void",
+				"call void @FACT(i32 "},
+		},
+	}
+
+	for _, test := range tests {
+		for _, optimized := range []bool{false, true} {
+			module := generateLLVM(t, test.source, optimized)
+			if err := checkLLVM(module); err != nil {
+				t.Errorf("%s: checkLLVM: %v\n%s", test.name, err, module)
+			}
+
+			functions := llvmFunctions(t, module)
+			if len(functions) != len(test.functions) {
+				t.Errorf("%s: %d functions, want %d:\n%s", test.name, len(functions), len(test.functions), module)
+			}
+			for name, header := range test.functions {
+				f, ok := functions[name]
+				if !ok {
+					t.Errorf("%s: no definition of @%s", test.name, name)
+					continue
+				}
+				if f.header != header {
+					t.Errorf("%s: @%s is defined as %q, want %q", test.name, name, f.header, header)
+				}
+				if len(f.blocks) == 0 || f.blocks[0][0] != "entry" {
+					t.Errorf("%s: @%s does not start with an entry block", test.name, name)
+				}
+				//Every block ends in exactly one terminator
+				for _, block := range f.blocks {
+					for i, inst := range block[1:] {
+						op := strings.Fields(inst)[0]
+						terminator := op == "br" || op == "ret" || op == "unreachable"
+						if last := i == len(block)-2; terminator != last {
+							t.Errorf("%s: @%s block %s has %q at %d of %d", test.name, name, block[0], inst, i+1, len(block)-1)
+						}
+					}
+					if len(block) == 1 {
+						t.Errorf("%s: @%s block %s is empty", test.name, name, block[0])
+					}
+				}
+				//Allocas are in the entry block only
+				for i, block := range f.blocks {
+					for _, inst := range block[1:] {
+						if strings.Contains(inst, "= alloca ") && i != 0 {
+							t.Errorf("%s: @%s has %q outside its entry block", test.name, name, inst)
+						}
+					}
+				}
+			}
+			for name, allocas := range test.allocas {
+				if f, ok := functions[name]; ok {
+					entry := strings.Join(f.blocks[0][1:], "\n")
+					for _, a := range allocas {
+						if !strings.Contains(entry, a) {
+							t.Errorf("%s: @%s's entry block has no %q:\n%s", test.name, name, a, entry)
+						}
+					}
+				}
+			}
+			for _, want := range append(test.globals, test.contains...) {
+				if !strings.Contains(module, want) {
+					t.Errorf("%s: module has no %q:\n%s", test.name, want, module)
+				}
+			}
+		}
+	}
+}
+
+func TestCheckLLVM(t *testing.T) {
+	const header = "declare void @japc_write_int(i32)\n@X = internal global i32 0\n"
+	tests := []struct {
+		name, module, err string
+	}{
+		{"valid", header + "define i32 @main() {\nentry:\n  %v1 = load i32, i32* @X\n  call void @japc_write_int(i32 %v1)\n  br label %end\nend:\n  ret i32 0\n}\n", ""},
+		{"no terminator", header + "define i32 @main() {\nentry:\n  %v1 = load i32, i32* @X\n}\n", "no terminator"},
+		{"fall into label", header + "define i32 @main() {\nentry:\n  %v1 = load i32, i32* @X\nnext:\n  ret i32 0\n}\n", "no terminator"},
+		{"after terminator", header + "define i32 @main() {\nentry:\n  ret i32 0\n  %v1 = load i32, i32* @X\n}\n", "outside a block"},
+		{"undefined value", header + "define i32 @main() {\nentry:\n  call void @japc_write_int(i32 %v9)\n  ret i32 0\n}\n", "%v9 is used"},
+		{"undefined label", header + "define i32 @main() {\nentry:\n  br label %nowhere\n}\n", "label %nowhere"},
+		{"undefined global", "define i32 @main() {\nentry:\n  %v1 = load i32, i32* @Y\n  ret i32 0\n}\n", "@Y is used"},
+		{"value twice", header + "define i32 @main() {\nentry:\n  %v1 = load i32, i32* @X\n  %v1 = load i32, i32* @X\n  ret i32 0\n}\n", "defined twice"},
+		{"label twice", header + "define i32 @main() {\nentry:\n  br label %a\na:\n  br label %a\na:\n  ret i32 0\n}\n", "defined twice"},
+		{"unclosed", header + "define i32 @main() {\nentry:\n  ret i32 0\n", "not closed"},
+	}
+	for _, test := range tests {
+		err := checkLLVM(test.module)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		case test.err != "" && err == nil:
+			t.Errorf("%s: no error, want one about %q", test.name, test.err)
+		case err != nil && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%s: error %q, want one about %q", test.name, err, test.err)
+		}
+	}
+}
+
+var (
+	llvmGlobalDef = regexp.MustCompile(`^(?:@([\w.]+) = |(?:define|declare) [^@]*@([\w.]+)\()`)
+	llvmLocalDef  = regexp.MustCompile(`^\s+%([\w.]+) = `)
+	llvmLabelDef  = regexp.MustCompile(`^([\w.]+):$`)
+	llvmParam     = regexp.MustCompile(`%([\w.]+)[,)]`)
+	llvmLocalUse  = regexp.MustCompile(`%([\w.]+)`)
+	llvmLabelUse  = regexp.MustCompile(`label %([\w.]+)`)
+	llvmGlobalUse = regexp.MustCompile(`@([\w.]+)`)
+)
+
+// checkLLVM() -	Check the structure of a module written by GenerateLLVM:
+//					every function's blocks end in exactly one terminator
+//					and every value, label and global used is defined.
+//					It is not a full parser, only the subset generated.
+func checkLLVM(text string) error {
+	globals := make(map[string]bool)
+	var globalUses []string
+	var function string
+	var values, labels map[string]bool
+	var valueUses, labelUses []string
+	terminated := true
+
+	for i, line := range strings.Split(text, "\n") {
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("line %d: %s", i+1, fmt.Sprintf(format, args...))
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+		for _, m := range llvmGlobalUse.FindAllStringSubmatch(line, -1) {
+			globalUses = append(globalUses, m[1])
+		}
+
+		if function == "" {
+			m := llvmGlobalDef.FindStringSubmatch(line)
+			if m == nil {
+				return fail("expected a global, declaration or definition")
+			}
+			name := m[1] + m[2]
+			if globals[name] {
+				return fail("@%s is defined twice", name)
+			}
+			globals[name] = true
+			if strings.HasPrefix(line, "define ") {
+				if !strings.HasSuffix(line, "{") {
+					return fail("expected { after the definition of @%s", name)
+				}
+				function = name
+				values, labels = make(map[string]bool), make(map[string]bool)
+				valueUses, labelUses = nil, nil
+				for _, p := range llvmParam.FindAllStringSubmatch(line, -1) {
+					values[p[1]] = true
+				}
+				terminated = true
+			}
+			continue
+		}
+
+		switch {
+		case line == "}":
+			if !terminated {
+				return fail("the last block of @%s has no terminator", function)
+			}
+			for _, v := range valueUses {
+				if !values[v] {
+					return fmt.Errorf("%%%s is used in @%s but never defined", v, function)
+				}
+			}
+			for _, l := range labelUses {
+				if !labels[l] {
+					return fmt.Errorf("label %%%s is used in @%s but never defined", l, function)
+				}
+			}
+			function = ""
+
+		case llvmLabelDef.MatchString(line):
+			name := llvmLabelDef.FindStringSubmatch(line)[1]
+			if !terminated {
+				return fail("block before %s has no terminator", name)
+			}
+			if labels[name] {
+				return fail("label %s is defined twice", name)
+			}
+			labels[name] = true
+			terminated = false
+
+		default:
+			if terminated {
+				return fail("instruction outside a block")
+			}
+			if m := llvmLocalDef.FindStringSubmatch(line); m != nil {
+				if values[m[1]] {
+					return fail("%%%s is defined twice", m[1])
+				}
+				values[m[1]] = true
+			}
+			for _, m := range llvmLabelUse.FindAllStringSubmatch(line, -1) {
+				labelUses = append(labelUses, m[1])
+			}
+			//Everything after = is a use, as are labels' names
+			uses := line
+			if at := strings.Index(line, " = "); at >= 0 {
+				uses = line[at:]
+			}
+			for _, m := range llvmLocalUse.FindAllStringSubmatch(llvmLabelUse.ReplaceAllString(uses, ""), -1) {
+				valueUses = append(valueUses, m[1])
+			}
+			switch strings.Fields(trimmed)[0] {
+			case "ret", "br", "unreachable":
+				terminated = true
+			}
+		}
+	}
+	if function != "" {
+		return fmt.Errorf("@%s is not closed", function)
+	}
+	for _, g := range globalUses {
+		if !globals[g] {
+			return fmt.Errorf("@%s is used but never defined or declared", g)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package pascomp
+
+//////////////////////////Loop Optimization//////////////////////////
+//Every WHILE and UNTIL loop lowers to a label, the code of the loop and
+//a goto back to the label, and nothing outside the loop jumps into it,
+//so a backward jump marks out a loop and the code just ahead of its
+//label runs once each time the loop is entered.  Two passes use that
+//spot.  A temporary assigned once from operands the loop never changes
+//is hoisted there.  Its value is only read inside the loop, so working
+//it out when the loop runs no times costs nothing, but a division that
+//might fail stays where it is.  A multiplication of an induction
+//variable, one the loop only ever steps up or down by an unchanging
+//amount, by an unchanging factor is strength reduced: a new temporary
+//is given the product ahead of the loop and stepped along with the
+//variable by the step times the factor, so the multiplication becomes
+//a copy.  A call may assign any of the program's variables, so in a
+//loop with a call none of them counts as unchanging.
+
+// irLoop is the code Code[head:end+1] of a procedure from the label at
+// head to the jump back to it at end
+type irLoop struct {
+	head, end int
+}
+
+// irLoops() -	The loops of a procedure, innermost first.  Loops some
+//				jump from outside enters other than by its label are
+//				left out.
+func irLoops(p *IrProc) []irLoop {
+	labels := make(map[int]int)
+	for i, q := range p.Code {
+		if q.Op == IrLabel {
+			labels[q.Result] = i
+		}
+	}
+	ends := make(map[int]int)
+	var heads []int
+	for i, q := range p.Code {
+		switch q.Op {
+		case IrGoto, IrIf, IrIffalse:
+			if l, ok := labels[q.Result]; ok && l < i {
+				if _, ok := ends[l]; !ok {
+					heads = append(heads, l)
+				}
+				ends[l] = i
+			}
+		}
+	}
+
+	var loops []irLoop
+	for _, head := range heads {
+		l := irLoop{head, ends[head]}
+		entered := false
+		for i, q := range p.Code {
+			switch q.Op {
+			case IrGoto, IrIf, IrIffalse:
+				at := labels[q.Result]
+				if (i < l.head || i > l.end) && at >= l.head && at <= l.end {
+					entered = true
+				}
+			}
+		}
+		if !entered {
+			loops = append(loops, l)
+		}
+	}
+	//A loop inside another is shorter than it
+	for i := 1; i < len(loops); i++ {
+		for j := i; j > 0 && loops[j].end-loops[j].head < loops[j-1].end-loops[j-1].head; j-- {
+			loops[j], loops[j-1] = loops[j-1], loops[j]
+		}
+	}
+	return loops
+}
+
+// loops() -	Hoist invariant code out of every loop and strength reduce
+//				its induction variables; reports any change
+func (this *optimizer) loops(p *IrProc) bool {
+	changed := false
+	for again := true; again; {
+		again = false
+		for _, l := range irLoops(p) {
+			if this.hoist(p, l) || this.reduce(p, l) {
+				changed, again = true, true
+				break
+			}
+		}
+	}
+	return changed
+}
+
+// loopInfo is what a loop assigns
+type loopInfo struct {
+	defs  map[int][]int // the positions in the procedure assigning each symbol
+	calls bool
+}
+
+func (this *optimizer) loopInfo(p *IrProc, l irLoop) loopInfo {
+	info := loopInfo{defs: make(map[int][]int)}
+	for i := l.head; i <= l.end; i++ {
+		q := p.Code[i]
+		if quadDefines(q) {
+			info.defs[q.Result] = append(info.defs[q.Result], i)
+		}
+		if q.Op == IrCall {
+			info.calls = true
+		}
+	}
+	return info
+}
+
+// invariant() -	Whether an operand keeps its value throughout the loop
+func (this *optimizer) invariant(info loopInfo, s int) bool {
+	if s < 0 || this.literal(s) {
+		return true
+	}
+	if len(info.defs[s]) > 0 {
+		return false
+	}
+	return !info.calls || this.st.Getproc(s) != this.main || this.st.Getsmclass(s) != Stvariable
+}
+
+// preheader() -	Put code just ahead of a loop's label with the
+//					loop's own code, changed, after it
+func (this *optimizer) preheader(p *IrProc, l irLoop, pre, body []Quad) {
+	code := append([]Quad(nil), p.Code[:l.head]...)
+	code = append(code, pre...)
+	code = append(code, body...)
+	p.Code = append(code, p.Code[l.end+1:]...)
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Invariant Code Motion
+////////////////////////////////////////////////////////////////////
+
+// hoist() -	Move the temporaries a loop computes from operands it
+//				never changes ahead of it; reports any change
+func (this *optimizer) hoist(p *IrProc, l irLoop) bool {
+	info := this.loopInfo(p, l)
+	assigned := make(map[int]int)
+	for _, q := range p.Code {
+		if quadDefines(q) {
+			assigned[q.Result]++
+		}
+	}
+
+	var pre, body []Quad
+	for i := l.head; i <= l.end; i++ {
+		q := p.Code[i]
+		switch q.Op {
+		case IrAssign, IrAdd, IrSub, IrMul, IrDiv, IrNeg, IrFloat:
+			if this.st.Getsmclass(q.Result) == Sttempvar && assigned[q.Result] == 1 &&
+				this.invariant(info, q.Arg1) && this.invariant(info, q.Arg2) && this.removable(q) {
+				//What it computes no longer changes in the loop either
+				delete(info.defs, q.Result)
+				pre = append(pre, q)
+				continue
+			}
+		}
+		body = append(body, q)
+	}
+	if len(pre) == 0 {
+		return false
+	}
+	this.preheader(p, l, pre, body)
+	return true
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Strength Reduction
+////////////////////////////////////////////////////////////////////
+
+// step() -	The amount an assignment steps an induction variable by,
+//			whether it steps down, and whether it is a step at all
+func (this *optimizer) step(q Quad, info loopInfo) (by int, down, ok bool) {
+	v := q.Result
+	switch {
+	case q.Op == IrAdd && q.Arg1 == v && q.Arg2 != v:
+		by = q.Arg2
+	case q.Op == IrAdd && q.Arg2 == v && q.Arg1 != v:
+		by = q.Arg1
+	case q.Op == IrSub && q.Arg1 == v && q.Arg2 != v:
+		by, down = q.Arg2, true
+	default:
+		return -1, false, false
+	}
+	return by, down, this.st.Getdatatype(by) == Dtinteger && this.invariant(info, by)
+}
+
+// reduce() -	Turn the multiplications of a loop's induction variables
+//				by unchanging factors into additions; reports any change
+func (this *optimizer) reduce(p *IrProc, l irLoop) bool {
+	info := this.loopInfo(p, l)
+	induction := func(v int) bool {
+		if v < 0 || this.st.Getdatatype(v) != Dtinteger || len(info.defs[v]) == 0 {
+			return false
+		}
+		switch this.st.Getsmclass(v) {
+		case Stvariable, Stparameter, Sttempvar:
+		default:
+			return false
+		}
+		if info.calls && this.st.Getproc(v) == this.main {
+			return false
+		}
+		for _, i := range info.defs[v] {
+			if _, _, ok := this.step(p.Code[i], info); !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	type product struct{ v, factor int }
+	reduced := make(map[product]int) // the temporary tracking each product
+	var order []product
+	body := append([]Quad(nil), p.Code[l.head:l.end+1]...)
+	for i, q := range body {
+		if q.Op != IrMul {
+			continue
+		}
+		v, factor := q.Arg1, q.Arg2
+		if !induction(v) {
+			v, factor = q.Arg2, q.Arg1
+		}
+		if !induction(v) || q.Result == v || this.st.Getdatatype(factor) != Dtinteger ||
+			!this.invariant(info, factor) {
+			continue
+		}
+		key := product{v, factor}
+		if _, ok := reduced[key]; !ok {
+			temp := this.st.Installtemp(p.Index, Sttempvar, Dtinteger)
+			p.Temps = append(p.Temps, temp)
+			reduced[key] = temp
+			order = append(order, key)
+		}
+		body[i] = Quad{Op: IrAssign, Arg1: reduced[key], Arg2: -1, Result: q.Result, Line: q.Line}
+	}
+	if len(order) == 0 {
+		return false
+	}
+
+	//Each tracking temporary starts as the product and moves with every
+	//step of its variable
+	var pre []Quad
+	steps := make(map[int][]Quad) // the quadruples to follow each step
+	for _, key := range order {
+		temp := reduced[key]
+		pre = append(pre, Quad{Op: IrMul, Arg1: key.v, Arg2: key.factor, Result: temp, Line: p.Code[l.head+1].Line})
+		for _, at := range info.defs[key.v] {
+			q := p.Code[at]
+			by, down, _ := this.step(q, info)
+			mul := Quad{Op: IrMul, Arg1: by, Arg2: key.factor, Result: -1, Line: q.Line}
+			amount, ok := this.evaluate(mul)
+			if this.literal(by) && this.st.Getivalue(by) == 1 {
+				amount, ok = key.factor, true
+			}
+			if !ok {
+				amount = this.st.Installtemp(p.Index, Sttempvar, Dtinteger)
+				p.Temps = append(p.Temps, amount)
+				mul.Result = amount
+				pre = append(pre, mul)
+			}
+			op := IrAdd
+			if down {
+				op = IrSub
+			}
+			steps[at] = append(steps[at], Quad{Op: op, Arg1: temp, Arg2: amount, Result: temp, Line: q.Line})
+		}
+	}
+
+	var code []Quad
+	for i, q := range body {
+		code = append(code, q)
+		code = append(code, steps[l.head+i]...)
+	}
+	this.preheader(p, l, pre, code)
+	return true
+}
@@ -0,0 +1,411 @@
+package pascomp
+
+import (
+	"bytes"
+	"testing"
+)
+
+// dumpIR() - The textual dump of a program's quadruples
+func dumpIR(t *testing.T, ir *IrProgram) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := ir.Dump(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestOptimizeLoops(t *testing.T) {
+	tests := []struct {
+		name, source, before, after string
+	}{
+		//An invariant product is hoisted, a product of the stepped variable
+		//is reduced and the multiplication by 0 folded away
+		{"WHILE", `PROGRAM Whiles;
+	DECLARE INTEGER i, n, total, step;
+BEGIN
+	READ n, step;
+	SET i = 0;
+	WHILE i < n DO
+		SET total = total + i * 4 + n * step + i * 0;
+		SET i = i + 2
+	ENDWHILE;
+	WRITE total
+END.
+`, `program WHILES
+	var   integer I
+	var   integer N
+	var   integer TOTAL
+	var   integer STEP
+	temp  integer _t46
+	temp  integer _t47
+	temp  integer _t48
+	temp  integer _t49
+	temp  integer _t50
+	read N
+	read STEP
+	I := 0
+_loop44:
+	iffalse I < N goto _loop45
+	_t48 := I * 4
+	_t47 := TOTAL + _t48
+	_t49 := N * STEP
+	_t46 := _t47 + _t49
+	_t50 := I * 0
+	TOTAL := _t46 + _t50
+	I := I + 2
+	goto _loop44
+_loop45:
+	write TOTAL
+	writeln
+	return
+`, `program WHILES
+	var   integer I
+	var   integer N
+	var   integer TOTAL
+	var   integer STEP
+	temp  integer _t46
+	temp  integer _t47
+	temp  integer _t48
+	temp  integer _t49
+	temp  integer _t51
+	read N
+	read STEP
+	I := 0
+	_t49 := N * STEP
+	_t51 := 0
+_loop44:
+	iffalse I < N goto _loop45
+	_t48 := _t51
+	_t47 := TOTAL + _t48
+	_t46 := _t47 + _t49
+	TOTAL := _t46
+	I := I + 2
+	_t51 := _t51 + 8
+	goto _loop44
+_loop45:
+	write TOTAL
+	writeln
+	return
+`},
+		//A step down and a multiplication by 1
+		{"UNTIL", `PROGRAM Untils;
+	DECLARE INTEGER k, n, sum;
+BEGIN
+	READ n;
+	SET k = n;
+	SET sum = 0;
+	UNTIL k = 0 DO
+		SET sum = sum + k * n * 1;
+		SET k = k - 1
+	ENDUNTIL;
+	WRITE sum
+END.
+`, `program UNTILS
+	var   integer K
+	var   integer N
+	var   integer SUM
+	temp  integer _t44
+	temp  integer _t45
+	read N
+	K := N
+	SUM := 0
+_loop42:
+	if K = 0 goto _loop43
+	_t45 := K * N
+	_t44 := _t45 * 1
+	SUM := SUM + _t44
+	K := K - 1
+	goto _loop42
+_loop43:
+	write SUM
+	writeln
+	return
+`, `program UNTILS
+	var   integer K
+	var   integer N
+	var   integer SUM
+	temp  integer _t44
+	temp  integer _t45
+	temp  integer _t46
+	read N
+	K := N
+	SUM := 0
+	_t46 := K * N
+_loop42:
+	if K = 0 goto _loop43
+	_t45 := _t46
+	_t44 := _t45
+	SUM := SUM + _t44
+	K := K - 1
+	_t46 := _t46 - N
+	goto _loop42
+_loop43:
+	write SUM
+	writeln
+	return
+`},
+		//The inner loop's invariant product is hoisted into the outer loop
+		//and reduced there
+		{"nested", `PROGRAM Nested;
+	DECLARE INTEGER i, j, n, cells;
+BEGIN
+	READ n;
+	SET i = 0;
+	SET cells = 0;
+	WHILE i < n DO
+		SET j = 0;
+		WHILE j < n DO
+			SET cells = cells + i * n + j;
+			SET j = j + 1
+		ENDWHILE;
+		SET i = i + 1
+	ENDWHILE;
+	WRITE cells
+END.
+`, `program NESTED
+	var   integer I
+	var   integer J
+	var   integer N
+	var   integer CELLS
+	temp  integer _t47
+	temp  integer _t48
+	read N
+	I := 0
+	CELLS := 0
+_loop43:
+	iffalse I < N goto _loop44
+	J := 0
+_loop45:
+	iffalse J < N goto _loop46
+	_t48 := I * N
+	_t47 := CELLS + _t48
+	CELLS := _t47 + J
+	J := J + 1
+	goto _loop45
+_loop46:
+	I := I + 1
+	goto _loop43
+_loop44:
+	write CELLS
+	writeln
+	return
+`, `program NESTED
+	var   integer I
+	var   integer J
+	var   integer N
+	var   integer CELLS
+	temp  integer _t47
+	temp  integer _t48
+	temp  integer _t49
+	read N
+	I := 0
+	CELLS := 0
+	_t49 := 0
+_loop43:
+	iffalse I < N goto _loop44
+	J := 0
+	_t48 := _t49
+_loop45:
+	iffalse J < N goto _loop46
+	_t47 := CELLS + _t48
+	CELLS := _t47 + J
+	J := J + 1
+	goto _loop45
+_loop46:
+	I := I + 1
+	_t49 := _t49 + N
+	goto _loop43
+_loop44:
+	write CELLS
+	writeln
+	return
+`},
+		//The call may change SCALE and N, so the main loop keeps its
+		//products; the procedure's loop still hoists one
+		{"CALL", `PROGRAM Calls;
+	DECLARE INTEGER i, n, scale;
+
+	PROCEDURE Grow PARAMETERS INTEGER by;
+		DECLARE INTEGER k;
+	BEGIN
+		SET k = 0;
+		WHILE k < by DO
+			SET scale = scale + by * 3;
+			SET k = k + 1
+		ENDWHILE
+	END;
+
+BEGIN
+	READ n;
+	SET scale = 1;
+	SET i = 0;
+	WHILE i < n DO
+		WRITE i * scale, n * 2;
+		CALL Grow(i);
+		SET i = i + 1
+	ENDWHILE
+END.
+`, `program CALLS
+	var   integer I
+	var   integer N
+	var   integer SCALE
+	temp  integer _t49
+	temp  integer _t50
+	read N
+	SCALE := 1
+	I := 0
+_loop47:
+	iffalse I < N goto _loop48
+	_t49 := I * SCALE
+	write _t49
+	writesp
+	_t50 := N * 2
+	write _t50
+	writeln
+	param I
+	call GROW, 1
+	I := I + 1
+	goto _loop47
+_loop48:
+	return
+
+procedure GROW
+	param integer BY
+	var   integer K
+	temp  integer _t53
+	K := 0
+_loop51:
+	iffalse K < BY goto _loop52
+	_t53 := BY * 3
+	SCALE := SCALE + _t53
+	K := K + 1
+	goto _loop51
+_loop52:
+	return
+`, `program CALLS
+	var   integer I
+	var   integer N
+	var   integer SCALE
+	temp  integer _t49
+	temp  integer _t50
+	read N
+	SCALE := 1
+	I := 0
+_loop47:
+	iffalse I < N goto _loop48
+	_t49 := I * SCALE
+	write _t49
+	writesp
+	_t50 := N * 2
+	write _t50
+	writeln
+	param I
+	call GROW, 1
+	I := I + 1
+	goto _loop47
+_loop48:
+	return
+
+procedure GROW
+	param integer BY
+	var   integer K
+	temp  integer _t53
+	K := 0
+	_t53 := BY * 3
+_loop51:
+	iffalse K < BY goto _loop52
+	SCALE := SCALE + _t53
+	K := K + 1
+	goto _loop51
+_loop52:
+	return
+`},
+	}
+	for _, test := range tests {
+		ir := GenerateIR(parseSource(t, test.source))
+		if got := dumpIR(t, ir); got != test.before {
+			t.Errorf("%s before optimizing:\n%s\nwant:\n%s", test.name, got, test.before)
+		}
+		Optimize(ir)
+		if got := dumpIR(t, ir); got != test.after {
+			t.Errorf("%s after optimizing:\n%s\nwant:\n%s", test.name, got, test.after)
+		}
+	}
+}
+
+func TestLoopEnteredInside(t *testing.T) {
+	ir := GenerateIR(parseSource(t, `PROGRAM Entered;
+	DECLARE INTEGER i, n, total;
+BEGIN
+	READ n;
+	SET i = 0;
+	WHILE i < n DO
+		SET total = total + n * 3 + i * 5;
+		SET i = i + 1
+	ENDWHILE;
+	WRITE total
+END.
+`))
+	p := ir.Procs[0]
+	if loops := irLoops(p); len(loops) != 1 {
+		t.Fatalf("found %d loops, want 1", len(loops))
+	}
+
+	//No source can jump into a loop, so add a jump past the loop's
+	//label to its step
+	var head, step int
+	for i, q := range p.Code {
+		switch {
+		case q.Op == IrLabel && head == 0:
+			head = i
+		case q.Op == IrAdd && ir.Operand(q.Result) == "I":
+			step = i
+		}
+	}
+	var n int
+	for _, v := range p.Vars {
+		if ir.Operand(v) == "N" {
+			n = v
+		}
+	}
+	inside := ir.St.Installtemp(p.Index, Stlabel, Dtnone)
+	code := append([]Quad(nil), p.Code[:head]...)
+	code = append(code, Quad{Op: IrIf, Rel: Tokgreater, Arg1: n, Arg2: ir.St.Installliteral("100", Dtinteger),
+		Result: inside, Line: 5})
+	code = append(code, p.Code[head:step]...)
+	code = append(code, Quad{Op: IrLabel, Arg1: -1, Arg2: -1, Result: inside})
+	p.Code = append(code, p.Code[step:]...)
+
+	if loops := irLoops(p); len(loops) != 0 {
+		t.Errorf("found %v, want the loop left out", loops)
+	}
+	//Nothing moves out of it or is reduced in it
+	Optimize(ir)
+	if got, want := dumpIR(t, ir), `program ENTERED
+	var   integer I
+	var   integer N
+	var   integer TOTAL
+	temp  integer _t46
+	temp  integer _t47
+	temp  integer _t48
+	read N
+	I := 0
+	if N > 100 goto _loop49
+_loop44:
+	iffalse I < N goto _loop45
+	_t47 := N * 3
+	_t46 := TOTAL + _t47
+	_t48 := I * 5
+	TOTAL := _t46 + _t48
+_loop49:
+	I := I + 1
+	goto _loop44
+_loop45:
+	write TOTAL
+	writeln
+	return
+`; got != want {
+		t.Errorf("after optimizing:\n%s\nwant:\n%s", got, want)
+	}
+}
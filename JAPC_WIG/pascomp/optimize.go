@@ -0,0 +1,327 @@
+package pascomp
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+//////////////////////////Optimizer//////////////////////////
+//Improves the quadruples of an IrProgram in place.  Arithmetic on
+//literals is worked out at compile time and the result installed as a
+//new literal, adding 0 or multiplying by 1 becomes a copy, a variable assigned a literal is replaced by that literal
+//in the quadruples that follow until it may have changed, and a branch
+//whose condition is known becomes a goto or disappears.  Code a goto
+//skips is then removed along with labels nothing jumps to, which joins
+//straight line code so that more constants reach their uses, and the
+//assignments and blocks that are left dead go too (see deadcode.go).
+//Once that settles, loops.go moves work out of loops and the rest is
+//tried again on what it leaves.
+//Constants are only followed within a run of quadruples no label
+//interrupts; nothing is assumed about a value at a join.  Division by
+//zero is left for the program to report when it runs.
+
+type optimizer struct {
+	st   *SymbolTable
+	main int
+}
+
+// Optimize() -	Fold and propagate constants, remove dead branches
+//				and dead code and optimize loops in every procedure
+//				until nothing more changes
+func Optimize(ir *IrProgram) {
+	this := &optimizer{st: ir.St, main: ir.Procs[0].Index}
+	globals := ir.Procs[0].Vars
+	for _, p := range ir.Procs {
+		for {
+			for {
+				folded := this.fold(p)
+				pruned := this.prune(p)
+				if !this.eliminate(p, globals) && !pruned && !folded {
+					break
+				}
+			}
+			if !this.loops(p) {
+				break
+			}
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Folding and Propagation
+////////////////////////////////////////////////////////////////////
+
+// fold() - One pass of folding and propagation; reports any change
+func (this *optimizer) fold(p *IrProc) bool {
+	changed := false
+	known := make(map[int]int) // variables and temporaries known to hold a literal
+	code := p.Code[:0]
+
+	for _, q := range p.Code {
+		old := q
+		switch q.Op {
+		case IrLabel:
+			known = make(map[int]int)
+		case IrCall:
+			//The procedure may assign any of the program's variables
+			for v := range known {
+				if this.st.Getproc(v) == this.main {
+					delete(known, v)
+				}
+			}
+		case IrAssign, IrAdd, IrSub, IrMul, IrDiv, IrNeg, IrFloat, IrIf, IrIffalse, IrWrite, IrParam:
+			if lit, ok := known[q.Arg1]; ok {
+				q.Arg1 = lit
+			}
+			if lit, ok := known[q.Arg2]; ok {
+				q.Arg2 = lit
+			}
+		}
+
+		switch q.Op {
+		case IrAdd, IrSub, IrMul, IrDiv, IrNeg, IrFloat:
+			if lit, ok := this.evaluate(q); ok {
+				q = Quad{Op: IrAssign, Arg1: lit, Arg2: -1, Result: q.Result, Line: q.Line}
+			} else if arg, ok := this.identity(q); ok {
+				q = Quad{Op: IrAssign, Arg1: arg, Arg2: -1, Result: q.Result, Line: q.Line}
+			}
+		case IrAssign:
+			//Assigning a name itself changes nothing
+			if q.Arg1 == q.Result {
+				changed = true
+				continue
+			}
+		case IrIf, IrIffalse:
+			if this.literal(q.Arg1) && this.literal(q.Arg2) {
+				changed = true
+				if this.compare(q) != (q.Op == IrIf) {
+					continue
+				}
+				q = Quad{Op: IrGoto, Arg1: -1, Arg2: -1, Result: q.Result, Line: q.Line}
+			}
+		}
+
+		//Record what the quadruple leaves in its result
+		switch q.Op {
+		case IrAssign, IrAdd, IrSub, IrMul, IrDiv, IrNeg, IrFloat, IrRead:
+			if q.Op == IrAssign && this.literal(q.Arg1) {
+				known[q.Result] = q.Arg1
+			} else {
+				delete(known, q.Result)
+			}
+		}
+
+		changed = changed || q != old
+		code = append(code, q)
+	}
+	p.Code = code
+	return changed
+}
+
+// evaluate() -	The literal an arithmetic quadruple computes when all
+//				its operands are literals
+func (this *optimizer) evaluate(q Quad) (int, bool) {
+	if !this.literal(q.Arg1) || (q.Arg2 >= 0 && !this.literal(q.Arg2)) {
+		return -1, false
+	}
+
+	switch {
+	case q.Op == IrFloat:
+		return this.realLiteral(float64(this.st.Getivalue(q.Arg1)))
+
+	case this.st.Getdatatype(q.Arg1) == Dtinteger:
+		x := this.st.Getivalue(q.Arg1)
+		var y int
+		if q.Arg2 >= 0 {
+			y = this.st.Getivalue(q.Arg2)
+		}
+		switch q.Op {
+		case IrAdd:
+			x += y
+		case IrSub:
+			x -= y
+		case IrMul:
+			x *= y
+		case IrDiv:
+			if y == 0 {
+				return -1, false
+			}
+			x /= y
+		case IrNeg:
+			x = -x
+		}
+		return this.st.Installliteral(strconv.Itoa(wrapInteger(x)), Dtinteger), true
+	}
+
+	x := this.realValue(q.Arg1)
+	var y float64
+	if q.Arg2 >= 0 {
+		y = this.realValue(q.Arg2)
+	}
+	switch q.Op {
+	case IrAdd:
+		x += y
+	case IrSub:
+		x -= y
+	case IrMul:
+		x *= y
+	case IrDiv:
+		if y == 0 {
+			return -1, false
+		}
+		x /= y
+	case IrNeg:
+		x = -x
+	}
+	return this.realLiteral(x)
+}
+
+// identity() -	The operand an arithmetic quadruple works out to when
+//				the other is a literal 0 or 1, or the 0 an integer is
+//				multiplied by.  Of these only x*1, x/1 and x-0 hold for
+//				reals too, as adding 0 can turn -0 into 0 and 0 times an
+//				infinity is not 0.
+func (this *optimizer) identity(q Quad) (int, bool) {
+	is := func(tabindex, v int) bool {
+		if !this.literal(tabindex) {
+			return false
+		}
+		if this.st.Getdatatype(tabindex) == Dtinteger {
+			return this.st.Getivalue(tabindex) == v
+		}
+		return this.realValue(tabindex) == float64(v)
+	}
+	integer := this.st.Getdatatype(q.Result) == Dtinteger
+
+	switch q.Op {
+	case IrMul:
+		switch {
+		case is(q.Arg2, 1):
+			return q.Arg1, true
+		case is(q.Arg1, 1):
+			return q.Arg2, true
+		case integer && is(q.Arg2, 0):
+			return q.Arg2, true
+		case integer && is(q.Arg1, 0):
+			return q.Arg1, true
+		}
+	case IrDiv:
+		if is(q.Arg2, 1) {
+			return q.Arg1, true
+		}
+	case IrAdd:
+		switch {
+		case integer && is(q.Arg2, 0):
+			return q.Arg1, true
+		case integer && is(q.Arg1, 0):
+			return q.Arg2, true
+		}
+	case IrSub:
+		if is(q.Arg2, 0) {
+			return q.Arg1, true
+		}
+	}
+	return -1, false
+}
+
+// compare() - Whether a condition on two literals holds
+func (this *optimizer) compare(q Quad) bool {
+	var sign int
+	if this.st.Getdatatype(q.Arg1) == Dtinteger {
+		x, y := this.st.Getivalue(q.Arg1), this.st.Getivalue(q.Arg2)
+		switch {
+		case x < y:
+			sign = -1
+		case x > y:
+			sign = 1
+		}
+	} else {
+		x, y := this.realValue(q.Arg1), this.realValue(q.Arg2)
+		switch {
+		case x < y:
+			sign = -1
+		case x > y:
+			sign = 1
+		}
+	}
+
+	switch q.Rel {
+	case Tokequals:
+		return sign == 0
+	case Tokgreater:
+		return sign > 0
+	case Tokless:
+		return sign < 0
+	}
+	return sign != 0
+}
+
+func (this *optimizer) literal(tabindex int) bool {
+	return tabindex >= 0 && this.st.Getsmclass(tabindex) == Stliteral
+}
+
+// realValue() -	A real literal's value, reparsed from the lexeme since
+//					the table only keeps single precision
+func (this *optimizer) realValue(tabindex int) float64 {
+	v, _ := strconv.ParseFloat(this.st.Getlexeme(tabindex), 64)
+	return v
+}
+
+// realLiteral() -	The literal for a real value, written so it reads back
+//					exactly.  Values no literal can spell are not folded.
+func (this *optimizer) realLiteral(v float64) (int, bool) {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return -1, false
+	}
+	lexeme := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(lexeme, ".e") {
+		lexeme += ".0"
+	}
+	return this.st.Installliteral(lexeme, Dtreal), true
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Dead Branches
+////////////////////////////////////////////////////////////////////
+
+// prune() -	Remove code a goto skips, jumps to the very next
+//				quadruple and labels no jump uses; reports any change.
+//				The closing return stays so every procedure has one.
+func (this *optimizer) prune(p *IrProc) bool {
+	targets := make(map[int]bool)
+	for _, q := range p.Code {
+		switch q.Op {
+		case IrGoto, IrIf, IrIffalse:
+			targets[q.Result] = true
+		}
+	}
+
+	changed := false
+	code := p.Code[:0]
+	reachable := true
+	for i, q := range p.Code {
+		switch {
+		case q.Op == IrLabel && !targets[q.Result]:
+			changed = true
+			continue
+		case q.Op == IrLabel:
+			reachable = true
+		case !reachable && q.Op != IrReturn:
+			changed = true
+			continue
+		}
+
+		switch q.Op {
+		case IrGoto, IrIf, IrIffalse:
+			if i+1 < len(p.Code) && p.Code[i+1].Op == IrLabel && p.Code[i+1].Result == q.Result {
+				changed = true
+				continue
+			}
+		}
+		reachable = q.Op != IrGoto
+		code = append(code, q)
+	}
+	p.Code = code
+	return changed
+}
@@ -0,0 +1,77 @@
+package pascomp
+
+import "testing"
+
+func TestFoldIdentities(t *testing.T) {
+	ir := GenerateIR(parseSource(t, `PROGRAM Identities;
+	DECLARE INTEGER b; REAL x;
+BEGIN
+	READ b, x;
+	WRITE b * 1, 1 * b, b + 0, 0 + b, b - 0, b * 0, 0 * b, b / 1;
+	WRITE x * 1.0, x / 1.0, x - 0.0, x + 0.0, x * 0.0, 0 - b
+END.
+`))
+	Optimize(ir)
+	//Adding a real 0 and multiplying a real by 0 stay, as does 0 - b
+	if got, want := dumpIR(t, ir), `program IDENTITIES
+	var   integer B
+	var   real X
+	temp  integer _t43
+	temp  integer _t44
+	temp  integer _t45
+	temp  integer _t46
+	temp  integer _t47
+	temp  integer _t50
+	temp  real _t51
+	temp  real _t52
+	temp  real _t53
+	temp  real _t54
+	temp  real _t55
+	temp  integer _t56
+	read B
+	read X
+	_t43 := B
+	write _t43
+	writesp
+	_t44 := B
+	write _t44
+	writesp
+	_t45 := B
+	write _t45
+	writesp
+	_t46 := B
+	write _t46
+	writesp
+	_t47 := B
+	write _t47
+	writesp
+	write 0
+	writesp
+	write 0
+	writesp
+	_t50 := B
+	write _t50
+	writeln
+	_t51 := X
+	write _t51
+	writesp
+	_t52 := X
+	write _t52
+	writesp
+	_t53 := X
+	write _t53
+	writesp
+	_t54 := X + 0.0
+	write _t54
+	writesp
+	_t55 := X * 0.0
+	write _t55
+	writesp
+	_t56 := 0 - B
+	write _t56
+	writeln
+	return
+`; got != want {
+		t.Errorf("after optimizing:\n%s\nwant:\n%s", got, want)
+	}
+}
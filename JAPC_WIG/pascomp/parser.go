@@ -0,0 +1,637 @@
+package pascomp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kdgwill/golang_dev/JAPC_WIG/diagnostics"
+)
+
+//////////////////////////Parser Implementation//////////////////////////
+//A recursive descent parser for the Pascal subset.  It pulls tokens from
+//the Scanner one at a time, installs declarations in the SymbolTable and
+//builds the tree described in ast.go.  The grammar it accepts is
+//
+//	program    ::= PROGRAM id ; block .
+//	block      ::= [CONST consts] [DECLARE decls] {procedure} BEGIN stmts END
+//	consts     ::= id = [-] constant ; {id = [-] constant ;}
+//	decls      ::= type idlist ; {type idlist ;}
+//	procedure  ::= PROCEDURE id [PARAMETERS decls | ;] [CONST consts]
+//					[DECLARE decls] BEGIN stmts END ;
+//	type       ::= INTEGER | REAL
+//	stmts      ::= stmt {; stmt}
+//	stmt       ::= SET id = expr
+//				 | READ id {, id}
+//				 | WRITE expr {, expr}
+//				 | IF cond THEN stmts [ELSE stmts] ENDIF
+//				 | WHILE cond DO stmts ENDWHILE
+//				 | UNTIL cond DO stmts ENDUNTIL
+//				 | CALL id [( expr {, expr} )]
+//				 | <empty>
+//	cond       ::= expr (= | > | < | !) expr
+//	expr       ::= term {(+ | -) term}
+//	term       ::= factor {(* | /) factor}
+//	factor     ::= id | constant | ( expr ) | - factor
+//
+//A named constant stands for its literal wherever it is used, so its
+//value is known to every code generator and the optimizer.
+//Procedures are only declared at the outermost level and must be declared
+//before they are called.  Integers are converted to reals wherever the two
+//are mixed; a real value can never be stored in an integer.
+
+// SyntaxError is returned by Parse for any syntax or semantic error
+type SyntaxError struct {
+	Line   int
+	Column int
+	Msg    string
+	Details
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s on line #%d", e.Msg, e.Line)
+}
+
+type Parser struct {
+	scanner *Scanner
+	st      *SymbolTable
+
+	// The current token, its attribute table index, lexeme and position
+	tok    TokenType
+	index  int
+	lexeme string
+	line   int
+	column int
+
+	// The program and the procedure whose declarations are being parsed
+	program, proc int
+
+	// Where each name was declared and every identifier read with
+	// the entry it names
+	declared map[int]Pos
+	refs     []Reference
+}
+
+// Reference is an identifier in the source and the attribute table
+// entry it names once scopes are resolved
+type Reference struct {
+	Pos
+	Index int
+}
+
+// NewParser() - Create a parser reading tokens from scanner
+func NewParser(scanner *Scanner) *Parser {
+	return &Parser{scanner: scanner, st: scanner.St, declared: make(map[int]Pos)}
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Public Parser Functions
+////////////////////////////////////////////////////////////////////
+
+// Parse() -	Parse a whole program.  The first error found stops
+//				the parse and is returned as a *SyntaxError
+func (this *Parser) Parse() (prog *Program, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			serr, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			prog, err = nil, serr
+		}
+	}()
+
+	this.next()
+	prog = this.parseProgram()
+	return prog, nil
+}
+
+// References() -	Every identifier read so far with the entry it
+//					names, in the order they appear; after an error,
+//					those up to it
+func (this *Parser) References() []Reference {
+	return this.refs
+}
+
+// Declared() -	Where each name declared so far was declared
+func (this *Parser) Declared() map[int]Pos {
+	return this.declared
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Private Parser Functions
+////////////////////////////////////////////////////////////////////
+
+func (this *Parser) parseProgram() *Program {
+	prog := &Program{Pos: this.pos(), St: this.st, Declared: this.declared}
+
+	this.expect(Tokprogram)
+	prog.Name = this.expectIdent()
+	this.st.Setattrib(prog.Name, Stprogram, Tokidentifier)
+	this.st.Installdatatype(prog.Name, Stprogram, Dtprogram)
+	this.program, this.proc = prog.Name, prog.Name
+	this.expect(Toksemicolon)
+
+	prog.Block = this.parseBlock(true)
+	this.next()
+	if this.tok != Tokperiod {
+		this.errorf(codeSyntax, "expected %s but found %s", tokenName(Tokperiod), this.found())
+	}
+	this.next()
+	if this.tok != Tokeof {
+		this.errorf(codeSyntax, "unexpected %s after the end of the program", this.found())
+	}
+	return prog
+}
+
+// parseBlock() -	Parse declarations, procedures (only in the program's
+//					own block) and the BEGIN ... END statement list
+func (this *Parser) parseBlock(outermost bool) *Block {
+	block := new(Block)
+
+	if this.tok == Tokconst {
+		this.next()
+		this.parseConsts()
+	}
+
+	if this.tok == Tokdeclare {
+		this.next()
+		block.Vars = this.parseDecls(Stvariable)
+	}
+
+	for outermost && this.tok == Tokprocedure {
+		block.Procs = append(block.Procs, this.parseProcedure())
+	}
+
+	this.expect(Tokbegin)
+	block.Body = this.parseStmts()
+	if this.tok != Tokend {
+		this.errorf(codeSyntax, "expected %s but found %s", tokenName(Tokend), this.found())
+	}
+	//END is not consumed so that the caller can close the scope
+	//before the scanner reads past it
+	return block
+}
+
+// parseDecls() -	Parse one or more "type idlist ;" groups and declare
+//					every name with the given semantic type
+func (this *Parser) parseDecls(smtype SemanticType) (names []int) {
+	if this.tok != Tokinteger && this.tok != Tokreal {
+		this.errorf(codeSyntax, "expected %s or %s but found %s",
+			tokenName(Tokinteger), tokenName(Tokreal), this.found())
+	}
+	for this.tok == Tokinteger || this.tok == Tokreal {
+		dt := Dtinteger
+		if this.tok == Tokreal {
+			dt = Dtreal
+		}
+		this.next()
+		for {
+			names = append(names, this.declare(this.expectIdentIndex(), smtype, dt))
+			this.next()
+			if this.tok != Tokcomma {
+				break
+			}
+			this.next()
+		}
+		this.expect(Toksemicolon)
+	}
+	return
+}
+
+// parseConsts() -	Parse one or more "id = [-] constant ;" definitions.
+//					A constant's value is the index of its literal,
+//					installed afresh when it is negated.
+func (this *Parser) parseConsts() {
+	this.expectIdentIndex()
+	for this.tok == Tokidentifier {
+		name := this.declare(this.index, Stconstant, Dtnone)
+		this.next()
+		this.expect(Tokequals)
+		negative := this.tok == Tokminus
+		if negative {
+			this.next()
+		}
+		if this.tok != Tokconstant {
+			this.errorf(codeSyntax, "expected %s but found %s", tokenName(Tokconstant), this.found())
+		}
+		lit := this.index
+		if negative {
+			lit = this.st.Installliteral("-"+this.lexeme, this.st.Getdatatype(lit))
+		}
+		this.st.Installdatatype(name, Stconstant, this.st.Getdatatype(lit))
+		this.st.SetIvalue(name, lit)
+		this.next()
+		this.expect(Toksemicolon)
+	}
+}
+
+func (this *Parser) parseProcedure() *Procedure {
+	proc := &Procedure{Pos: this.pos()}
+	this.expect(Tokprocedure)
+
+	//The name belongs to the outer scope so declare it
+	//before opening the procedure's own scope
+	proc.Index = this.declare(this.expectIdentIndex(), Stprocedure, Dtprocedure)
+	this.st.SetIvalue(proc.Index, 0)
+	this.st.enterproc(proc.Index)
+	this.proc = proc.Index
+	this.next()
+
+	if this.tok == Tokparameters {
+		this.next()
+		proc.Params = this.parseDecls(Stparameter)
+		//	The procedure's value points to its first parameter and
+		//	every parameter's value to the one following it
+		prev := proc.Index
+		for _, param := range proc.Params {
+			this.st.SetIvalue(prev, param)
+			this.st.SetIvalue(param, 0)
+			prev = param
+		}
+	} else {
+		this.expect(Toksemicolon)
+	}
+
+	proc.Block = this.parseBlock(false)
+	this.st.exitproc()
+	this.proc = this.program
+	this.next()
+	this.expect(Toksemicolon)
+	return proc
+}
+
+// declare() -	Give an identifier its semantic and data types.  If the
+//				name is already in use by an outer scope a new entry is
+//				opened for it.
+func (this *Parser) declare(tabindex int, smtype SemanticType, dt DataType) int {
+	if this.st.Getsmclass(tabindex) != Stunknown {
+		if this.st.Getproc(tabindex) == this.proc {
+			serr := this.syntaxError(this.pos(), codeRedeclared, "%s is already declared", this.st.Getlexeme(tabindex))
+			serr.Related = declaredAt(this.declared, tabindex, "first declared here")
+			panic(serr)
+		}
+		tabindex = this.st.openscope(tabindex)
+		//The name being declared is the last one read
+		this.refs[len(this.refs)-1].Index = tabindex
+	}
+	this.st.Installdatatype(tabindex, smtype, dt)
+	this.st.Setproc(this.proc, tabindex)
+	this.declared[tabindex] = this.pos()
+	return tabindex
+}
+
+func (this *Parser) parseStmts() (stmts []Stmt) {
+	for {
+		if stmt := this.parseStmt(); stmt != nil {
+			stmts = append(stmts, stmt)
+		}
+		if this.tok != Toksemicolon {
+			return
+		}
+		this.next()
+	}
+}
+
+func (this *Parser) parseStmt() Stmt {
+	pos := this.pos()
+
+	switch this.tok {
+	case Tokset:
+		this.next()
+		target := this.variable()
+		this.next()
+		this.expect(Tokequals)
+		value := this.parseExpr()
+		if this.st.Getdatatype(target) == Dtinteger && value.Type() == Dtreal {
+			serr := this.syntaxError(pos, codeRealToInteger, "cannot assign a real value to the integer %s",
+				this.st.Getlexeme(target))
+			serr.Related = declaredAt(this.declared, target, "declared INTEGER here")
+			serr.Notes = []string{"integers are converted to reals, but a real is never converted to an integer"}
+			panic(serr)
+		}
+		return &SetStmt{Pos: pos, Target: target, Value: this.convert(value, this.st.Getdatatype(target))}
+
+	case Tokread:
+		stmt := &ReadStmt{Pos: pos}
+		for {
+			this.next()
+			stmt.Targets = append(stmt.Targets, this.variable())
+			this.next()
+			if this.tok != Tokcomma {
+				return stmt
+			}
+		}
+
+	case Tokwrite:
+		stmt := &WriteStmt{Pos: pos}
+		for {
+			this.next()
+			stmt.Values = append(stmt.Values, this.parseExpr())
+			if this.tok != Tokcomma {
+				return stmt
+			}
+		}
+
+	case Tokif:
+		this.next()
+		stmt := &IfStmt{Pos: pos, Cond: this.parseCond()}
+		this.expect(Tokthen)
+		stmt.Then = this.parseStmts()
+		if this.tok == Tokelse {
+			this.next()
+			stmt.Else = this.parseStmts()
+		}
+		this.expect(Tokendif)
+		return stmt
+
+	case Tokwhile:
+		this.next()
+		stmt := &WhileStmt{Pos: pos, Cond: this.parseCond()}
+		this.expect(Tokdo)
+		stmt.Body = this.parseStmts()
+		this.expect(Tokendwhile)
+		return stmt
+
+	case Tokuntil:
+		this.next()
+		stmt := &UntilStmt{Pos: pos, Cond: this.parseCond()}
+		this.expect(Tokdo)
+		stmt.Body = this.parseStmts()
+		this.expect(Tokenduntil)
+		return stmt
+
+	case Tokcall:
+		return this.parseCall(pos)
+	}
+	//Empty statement
+	return nil
+}
+
+func (this *Parser) parseCall(pos Pos) Stmt {
+	this.next()
+	name := this.expectIdentIndex()
+	if this.st.Getsmclass(name) != Stprocedure {
+		serr := this.syntaxError(this.pos(), codeNotProcedure, "%s is not a procedure", this.lexeme)
+		if this.st.Getsmclass(name) == Stunknown {
+			this.suggest(serr, Stprocedure)
+		} else {
+			serr.Related = declaredAt(this.declared, name, "declared here")
+		}
+		panic(serr)
+	}
+	stmt := &CallStmt{Pos: pos, Proc: name}
+	this.next()
+
+	if this.tok == Tokopenparen {
+		for {
+			this.next()
+			stmt.Args = append(stmt.Args, this.parseExpr())
+			if this.tok != Tokcomma {
+				break
+			}
+		}
+		this.expect(Tokcloseparen)
+	}
+
+	//Check the arguments against the parameter list
+	param := this.st.Getivalue(name)
+	for i, arg := range stmt.Args {
+		if param == 0 {
+			serr := this.syntaxError(pos, codeArguments, "too many arguments in call to %s", this.st.Getlexeme(name))
+			serr.Related = declaredAt(this.declared, name, "declared here")
+			panic(serr)
+		}
+		if this.st.Getdatatype(param) == Dtinteger && arg.Type() == Dtreal {
+			serr := this.syntaxError(arg.Position(), codeRealToInteger,
+				"cannot pass a real value as the integer parameter %s", this.st.Getlexeme(param))
+			serr.Related = declaredAt(this.declared, param, "declared INTEGER here")
+			serr.Notes = []string{"integers are converted to reals, but a real is never converted to an integer"}
+			panic(serr)
+		}
+		stmt.Args[i] = this.convert(arg, this.st.Getdatatype(param))
+		param = this.st.Getivalue(param)
+	}
+	if param != 0 {
+		serr := this.syntaxError(pos, codeArguments, "not enough arguments in call to %s", this.st.Getlexeme(name))
+		serr.Related = declaredAt(this.declared, name, "declared here")
+		panic(serr)
+	}
+	return stmt
+}
+
+func (this *Parser) parseCond() *Cond {
+	cond := &Cond{Pos: this.pos()}
+	cond.Left = this.parseExpr()
+	switch this.tok {
+	case Tokequals, Tokgreater, Tokless, Toknotequal:
+		cond.Op = this.tok
+	default:
+		this.errorf(codeSyntax, "expected a relational operator but found %s", this.found())
+	}
+	this.next()
+	cond.Right = this.parseExpr()
+	cond.Left, cond.Right = this.balance(cond.Left, cond.Right)
+	return cond
+}
+
+func (this *Parser) parseExpr() Expr {
+	x := this.parseTerm()
+	for this.tok == Tokplus || this.tok == Tokminus {
+		pos, op := this.pos(), this.tok
+		this.next()
+		x = this.binary(pos, op, x, this.parseTerm())
+	}
+	return x
+}
+
+func (this *Parser) parseTerm() Expr {
+	x := this.parseFactor()
+	for this.tok == Tokstar || this.tok == Tokslash {
+		pos, op := this.pos(), this.tok
+		this.next()
+		x = this.binary(pos, op, x, this.parseFactor())
+	}
+	return x
+}
+
+func (this *Parser) parseFactor() Expr {
+	pos := this.pos()
+
+	switch this.tok {
+	case Tokidentifier:
+		if index := this.index; this.st.Getsmclass(index) == Stconstant {
+			this.next()
+			return this.literal(pos, this.st.Getivalue(index))
+		}
+		index := this.variable()
+		this.next()
+		return &Ident{Pos: pos, Index: index, Dt: this.st.Getdatatype(index)}
+
+	case Tokconstant:
+		lit := this.literal(pos, this.index)
+		this.next()
+		return lit
+
+	case Tokopenparen:
+		this.next()
+		x := this.parseExpr()
+		this.expect(Tokcloseparen)
+		return x
+
+	case Tokminus:
+		this.next()
+		return &Negate{Pos: pos, X: this.parseFactor()}
+	}
+
+	this.errorf(codeSyntax, "expected an expression but found %s", this.found())
+	return nil
+}
+
+// literal() -	The node for a literal's attribute table entry
+func (this *Parser) literal(pos Pos, index int) *Literal {
+	lit := &Literal{Pos: pos, Index: index, Dt: this.st.Getdatatype(index)}
+	if lit.Dt == Dtinteger {
+		lit.Ival = this.st.Getivalue(index)
+		lit.Rval = float64(lit.Ival)
+	} else {
+		//Reparse the lexeme since the table only keeps single precision
+		lit.Rval, _ = strconv.ParseFloat(this.st.Getlexeme(index), 64)
+	}
+	return lit
+}
+
+// binary() -	Build an arithmetic node converting an integer
+//				operand to real if the other one is real
+func (this *Parser) binary(pos Pos, op TokenType, x, y Expr) Expr {
+	x, y = this.balance(x, y)
+	return &Binary{Pos: pos, Op: op, Left: x, Right: y, Dt: x.Type()}
+}
+
+func (this *Parser) balance(x, y Expr) (Expr, Expr) {
+	if x.Type() == Dtreal || y.Type() == Dtreal {
+		return this.convert(x, Dtreal), this.convert(y, Dtreal)
+	}
+	return x, y
+}
+
+// convert() -	Wrap an integer expression in a call to _float
+//				when a real is wanted
+func (this *Parser) convert(x Expr, dt DataType) Expr {
+	if dt == Dtreal && x.Type() == Dtinteger {
+		return &Float{Pos: x.Position(), X: x}
+	}
+	return x
+}
+
+// variable() -	The current token must be a declared variable or
+//				parameter; returns its attribute table index
+func (this *Parser) variable() int {
+	index := this.expectIdentIndex()
+	switch this.st.Getsmclass(index) {
+	case Stvariable, Stparameter:
+		return index
+	case Stunknown:
+		serr := this.syntaxError(this.pos(), codeUndeclared, "%s is not declared", this.lexeme)
+		this.suggest(serr, Stvariable, Stparameter)
+		panic(serr)
+	default:
+		serr := this.syntaxError(this.pos(), codeNotVariable, "%s is not a variable", this.lexeme)
+		serr.Related = declaredAt(this.declared, index, "declared here")
+		panic(serr)
+	}
+}
+
+func (this *Parser) next() {
+	this.tok, this.lexeme = this.scanner.GetToken(&this.index)
+	this.line, this.column = this.scanner.Line(), this.scanner.Column()
+	if this.tok == Tokidentifier {
+		this.refs = append(this.refs, Reference{this.pos(), this.index})
+	}
+}
+
+// pos() - Where the current token starts
+func (this *Parser) pos() Pos {
+	return Pos{Line: this.line, Column: this.column}
+}
+
+// expect() -	Consume the current token if it is tok
+func (this *Parser) expect(tok TokenType) {
+	if this.tok != tok {
+		this.errorf(codeSyntax, "expected %s but found %s", tokenName(tok), this.found())
+	}
+	this.next()
+}
+
+// expectIdent() -	Consume an identifier and return its index
+func (this *Parser) expectIdent() int {
+	index := this.expectIdentIndex()
+	this.next()
+	return index
+}
+
+// expectIdentIndex() -	Check that the current token is an identifier
+//						without consuming it
+func (this *Parser) expectIdentIndex() int {
+	if this.tok != Tokidentifier {
+		this.errorf(codeSyntax, "expected an identifier but found %s", this.found())
+	}
+	return this.index
+}
+
+func (this *Parser) found() string {
+	switch this.tok {
+	case Tokidentifier, Tokconstant:
+		return "`" + this.lexeme + "`"
+	}
+	return tokenName(this.tok)
+}
+
+func (this *Parser) errorf(code string, format string, args ...interface{}) {
+	panic(this.syntaxError(this.pos(), code, format, args...))
+}
+
+// syntaxError() -	An error at pos with one of the codes in Rules, for
+//					the caller to add details to before panicking
+func (this *Parser) syntaxError(pos Pos, code string, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{Line: pos.Line, Column: pos.Column, Msg: fmt.Sprintf(format, args...),
+		Details: Details{Code: code}}
+}
+
+// suggest() -	Suggest the name of one of the given semantic types
+//				visible here that is spelled most like the current token
+func (this *Parser) suggest(serr *SyntaxError, smtypes ...SemanticType) {
+	var candidates []int
+	for index := range this.declared {
+		if owner := this.st.Getproc(index); owner != this.proc && owner != this.program {
+			continue
+		}
+		for _, smtype := range smtypes {
+			if this.st.Getsmclass(index) == smtype {
+				candidates = append(candidates, index)
+			}
+		}
+	}
+	if best, ok := closest(this.st, this.lexeme, candidates); ok {
+		spelling := this.st.Getspelling(best)
+		serr.Help = append(serr.Help, diagnostics.Suggestion{Message: "did you mean " + spelling + "?",
+			Span:        diagnostics.Span{Line: this.line, Column: this.column},
+			Replacement: spelling})
+	}
+}
+
+// tokenName() - A readable name for a token class used in messages
+func tokenName(tok TokenType) string {
+	switch tok {
+	case Tokidentifier:
+		return "an identifier"
+	case Tokconstant:
+		return "a constant"
+	case Tokeof:
+		return "the end of the file"
+	}
+	if int(tok) < numTokens {
+		return "`" + strings.ToUpper(keywords[tok]) + "`"
+	}
+	return tok.String()
+}
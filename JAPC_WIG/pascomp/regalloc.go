@@ -0,0 +1,166 @@
+package pascomp
+
+import (
+	"sort"
+)
+
+//////////////////////////Register Allocation//////////////////////////
+//Linear scan allocation of a procedure's integer temporaries and local
+//variables.  Each symbol's live interval runs from the first quadruple
+//that mentions it to the last.  A local variable's interval is widened
+//to cover any loop it overlaps, since its value may be carried round
+//the loop.  A temporary is assigned before it is used, so it only needs
+//widening when it is assigned ahead of a loop that keeps reading it, as
+//the loop optimizations in loops.go arrange.  Intervals are visited in order of their start and when
+//no register is free the one used least often is spilled, counting a
+//use inside a loop ten times for each loop around it, so that values
+//in hot WHILE and UNTIL bodies stay in registers.  Spilled symbols keep
+//the [bp-N] label labelscope gave them, or their .bss label in the
+//program itself.  The program's variables are never allocated since
+//every procedure may use them.
+
+// liveInterval is the stretch of code over which a symbol needs a register
+type liveInterval struct {
+	sym        int
+	start, end int
+	weight     int    // uses weighted by loop depth
+	reg        string // the register assigned, if any
+}
+
+// live() -	Whether the value is needed both before and after quadruple i
+func (iv *liveInterval) live(i int) bool {
+	return iv.start < i && i < iv.end
+}
+
+// allocateRegisters() -	Assign registers to the integer temporaries and
+//							locals of a procedure, returning the intervals
+//							given one.  Other symbols are spilled to memory.
+func allocateRegisters(st *SymbolTable, p *IrProc, main int, regs []string) []*liveInterval {
+	candidate := func(s int) bool {
+		if s < 0 || st.Getdatatype(s) != Dtinteger || st.Getproc(s) != p.Index {
+			return false
+		}
+		sm := st.Getsmclass(s)
+		return sm == Sttempvar || (sm == Stvariable && p.Index != main)
+	}
+
+	//Every backward jump closes a loop
+	labels := make(map[int]int)
+	for i, q := range p.Code {
+		if q.Op == IrLabel {
+			labels[q.Result] = i
+		}
+	}
+	var loops [][2]int
+	for i, q := range p.Code {
+		switch q.Op {
+		case IrGoto, IrIf, IrIffalse:
+			if l, ok := labels[q.Result]; ok && l < i {
+				loops = append(loops, [2]int{l, i})
+			}
+		}
+	}
+
+	intervals := make(map[int]*liveInterval)
+	var order []*liveInterval
+	for i, q := range p.Code {
+		if q.Op == IrCall {
+			continue
+		}
+		weight := 1
+		for _, loop := range loops {
+			if loop[0] <= i && i <= loop[1] && weight < 10000 {
+				weight *= 10
+			}
+		}
+		for _, s := range [...]int{q.Arg1, q.Arg2, q.Result} {
+			if !candidate(s) {
+				continue
+			}
+			iv, ok := intervals[s]
+			if !ok {
+				iv = &liveInterval{sym: s, start: i}
+				intervals[s] = iv
+				order = append(order, iv)
+			}
+			iv.end = i
+			iv.weight += weight
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, iv := range order {
+			for _, loop := range loops {
+				if st.Getsmclass(iv.sym) != Stvariable {
+					if iv.start < loop[0] && iv.end >= loop[0] && iv.end < loop[1] {
+						iv.end, changed = loop[1], true
+					}
+					continue
+				}
+				if iv.start <= loop[1] && iv.end >= loop[0] &&
+					(iv.start > loop[0] || iv.end < loop[1]) {
+					iv.start, iv.end = minInt(iv.start, loop[0]), maxInt(iv.end, loop[1])
+					changed = true
+				}
+			}
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return order[i].start < order[j].start })
+
+	free := append([]string(nil), regs...)
+	var active []*liveInterval
+	for _, iv := range order {
+		//Free the registers of intervals that have ended
+		kept := active[:0]
+		for _, a := range active {
+			if a.end < iv.start {
+				free = append(free, a.reg)
+			} else {
+				kept = append(kept, a)
+			}
+		}
+		active = kept
+
+		if len(free) > 0 {
+			iv.reg, free = free[0], free[1:]
+			active = append(active, iv)
+			continue
+		}
+
+		//Spill whichever is used least
+		lightest := -1
+		for i, a := range active {
+			if a.weight < iv.weight && (lightest < 0 || a.weight < active[lightest].weight) {
+				lightest = i
+			}
+		}
+		if lightest >= 0 {
+			spilled := active[lightest]
+			iv.reg, spilled.reg = spilled.reg, ""
+			active[lightest] = iv
+		}
+	}
+
+	var allocated []*liveInterval
+	for _, iv := range order {
+		if iv.reg != "" {
+			allocated = append(allocated, iv)
+		}
+	}
+	return allocated
+}
+
+func minInt(x, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+func maxInt(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,185 @@
+package pascomp
+
+import (
+	"io"
+	"strings"
+)
+
+//////////////////////////Interactive Sessions//////////////////////////
+//A Session reads a program a piece at a time, as a read-eval-print loop
+//types it.  Each input is parsed against one symbol table that lasts the
+//whole session, as if it were the next part of the program's outermost
+//block, and run at once by the tree walking interpreter, whose globals
+//last as long.  An input holds any of
+//
+//	CONST consts | DECLARE decls | decls | procedure | stmt | expr
+//
+//separated by semicolons, where the DECLARE before declarations and the
+//semicolon after the last may be left off and an expression on its own
+//is written as WRITE would.  An input with an error changes nothing:
+//the symbol table is put back as it was before the input was scanned.
+//Errors point at lines counted from the start of the input.
+
+// Session is an interactive session with a symbol table of its own
+type Session struct {
+	St      *SymbolTable
+	parser  *Parser
+	interp  *Interpreter
+	program int // the entry that owns what the session declares
+}
+
+// The name of the entry that owns a session's declarations, which no
+// identifier can spell
+const sessionName = "_session"
+
+// NewSession() -	Start a session whose READs read from in and whose
+//					WRITEs and expressions write to out
+func NewSession(in io.Reader, out io.Writer) *Session {
+	this := &Session{St: NewSymbolTable()}
+	this.St.Installname(sessionName, &this.program)
+	this.St.Setattrib(this.program, Stprogram, Tokidentifier)
+	this.St.Installdatatype(this.program, Stprogram, Dtprogram)
+
+	this.parser = &Parser{st: this.St, program: this.program, proc: this.program}
+	prog := &Program{Name: this.program, Block: new(Block), St: this.St}
+	this.interp = NewInterpreter(prog, in, out)
+	return this
+}
+
+// Eval() -	Parse an input and run it.  A *SyntaxError leaves the
+//			session as it was; a *RuntimeError stops the input's
+//			statements with the ones before it done.
+func (this *Session) Eval(input string) error {
+	saved := *this.St
+	vars, procs, stmts, err := this.parse(input)
+	if err != nil && this.parser.tok == Tokeof {
+		//Declarations may leave off the semicolon that ends them
+		*this.St = saved
+		if v, p, st, retry := this.parse(input + ";"); retry == nil {
+			vars, procs, stmts, err = v, p, st, nil
+		}
+	}
+	if err != nil {
+		*this.St = saved
+		return err
+	}
+
+	for _, v := range vars {
+		this.interp.globals[v] = new(cell)
+	}
+	for _, proc := range procs {
+		this.interp.procs[proc.Index] = proc
+	}
+	return this.run(stmts)
+}
+
+// parse() -	Parse an input into the variables and procedures it
+//				declares and the statements it runs
+func (this *Session) parse(input string) (vars []int, procs []*Procedure, stmts []Stmt, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			serr, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			err = serr
+		}
+	}()
+
+	var scanner Scanner
+	scanner.scanWith(strings.NewReader(input), this.St)
+	p := this.parser
+	p.scanner, p.refs, p.declared = &scanner, nil, make(map[int]Pos)
+
+	p.next()
+	for p.tok != Tokeof {
+		//Whether the item ends with a semicolon of its own
+		ended := true
+		switch p.tok {
+		case Toksemicolon:
+			p.next()
+			continue
+		case Tokconst:
+			p.next()
+			p.parseConsts()
+		case Tokdeclare:
+			p.next()
+			vars = append(vars, p.parseDecls(Stvariable)...)
+		case Tokinteger, Tokreal:
+			vars = append(vars, p.parseDecls(Stvariable)...)
+		case Tokprocedure:
+			procs = append(procs, p.parseProcedure())
+		case Tokset, Tokread, Tokwrite, Tokif, Tokwhile, Tokuntil, Tokcall:
+			stmts = append(stmts, p.parseStmt())
+			ended = false
+		default:
+			pos := p.pos()
+			stmts = append(stmts, &WriteStmt{Pos: pos, Values: []Expr{p.parseExpr()}})
+			ended = false
+		}
+		if !ended && p.tok != Toksemicolon && p.tok != Tokeof {
+			p.errorf(codeSyntax, "expected %s but found %s", tokenName(Toksemicolon), p.found())
+		}
+	}
+	return vars, procs, stmts, nil
+}
+
+// run() -	Run statements against the session's globals, writing
+//			their output before any runtime error is returned
+func (this *Session) run(stmts []Stmt) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rerr, ok := r.(*RuntimeError)
+			if !ok {
+				panic(r)
+			}
+			err = rerr
+		}
+		if ferr := this.interp.out.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+	this.interp.execStmts(stmts, nil)
+	return nil
+}
+
+// Complete() -	Whether an input is whole or the lines after it are
+//				still needed: every BEGIN, IF, WHILE and UNTIL closed
+//				and any procedure's END reached
+func Complete(input string) bool {
+	var scanner Scanner
+	scanner.NewScannerReader(strings.NewReader(input))
+	tokens, err := scanner.ScanAll()
+	if err != nil {
+		//The error is reported when the input is run
+		return true
+	}
+	depth, procedure := 0, false
+	for _, t := range tokens {
+		switch t.Type {
+		case Tokbegin, Tokif, Tokwhile, Tokuntil:
+			depth++
+		case Tokend, Tokendif, Tokendwhile, Tokenduntil:
+			depth--
+		case Tokprocedure:
+			procedure = true
+		}
+		if t.Type == Tokend && depth <= 0 {
+			procedure = false
+		}
+	}
+	return depth <= 0 && !procedure
+}
+
+// Tokens() -	Write the tokens of a line as a table without adding
+//				its names to the session's symbol table
+func (this *Session) Tokens(w io.Writer, line string) error {
+	st := *this.St
+	var scanner Scanner
+	scanner.scanWith(strings.NewReader(line), &st)
+	tokens, err := scanner.ScanAll()
+	if werr := WriteTokens(w, &st, tokens, "table"); err == nil {
+		err = werr
+	}
+	return err
+}
@@ -0,0 +1,34 @@
+package pascomp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSessionTableFull(t *testing.T) {
+	var out bytes.Buffer
+	s := NewSession(strings.NewReader(""), &out)
+	if err := s.Eval("INTEGER count; SET count = 41"); err != nil {
+		t.Fatal(err)
+	}
+
+	var decls strings.Builder
+	for i := 0; i < 2100; i++ {
+		fmt.Fprintf(&decls, "INTEGER v%d;\n", i)
+	}
+	err := s.Eval(decls.String())
+	serr, ok := err.(*SyntaxError)
+	if !ok || serr.Code != codeTableFull || serr.Line == 0 {
+		t.Fatalf("declaring too many names gave %#v, want a table-full error at a line", err)
+	}
+
+	//The input that filled the table is undone, so the session goes on
+	if err := s.Eval("INTEGER more; SET more = count + 1; more"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "42" {
+		t.Errorf("session wrote %q, want 42", got)
+	}
+}
@@ -18,10 +18,16 @@ const endOfFile rune = 0 //careful with this look into another time
 //Go does not support classes per say but what they do support is a struct with specialized functions that act as methods when initialized
 type Scanner struct {
 	St         *SymbolTable
-	originFile *os.File
+	originFile io.ReadCloser
 	reader     *bufio.Reader
 	lineNum    int
+	column     int //column of the last character read, counting from 1
+	prevColumn int //column before it, for ungetc
+	tokLine    int //line on which the last token returned by GetToken started
+	tokColumn  int //and its column
 	lookahead  rune
+	raw        rune   //the last character read before it was uppercased
+	spelling   string //the word being scanned as it was written
 }
 
 ////////////////////////////////////////////////////////////////////
@@ -40,23 +46,44 @@ func (this *Scanner) NewScanner(arg ...string) {
 		fmt.Scanf("%s", &filename)
 	}
 
+	if filename == "-" {
+		this.NewScannerReader(os.Stdin)
+		return
+	}
 	if filepath.Ext(filename) != ".pas" {
 		//log.Fatal("Usage: ", filepath.Base(arg[0]), " <FileName>.pas")
 		log.Fatal("Only pascal files with extension `.pas` allowed")
 	}
 
 	file, err := os.Open(filename) // For read access.
-	if err == io.ErrUnexpectedEOF {
+	if err != nil {
 		log.Fatal("Cannout Open ", filename, "\n", err)
 		//Fatal calls os.exit()
 	}
 	this.originFile = file
-	this.reader = bufio.NewReader(this.originFile)
+	this.start()
+}
+
+// NewScannerReader() -	Scan a program read from r instead of a file,
+//						such as standard input or text held in memory
+func (this *Scanner) NewScannerReader(r io.Reader) {
+	this.St = NewSymbolTable()
+	this.originFile = io.NopCloser(r)
+	this.start()
+}
 
+// scanWith() -	Scan a program read from r into an existing symbol
+//				table, such as an interactive session's
+func (this *Scanner) scanWith(r io.Reader, st *SymbolTable) {
+	this.St = st
+	this.originFile = io.NopCloser(r)
+	this.start()
+}
+
+func (this *Scanner) start() {
+	this.reader = bufio.NewReader(this.originFile)
 	this.lineNum = 1
-	if err != io.EOF {
-		this.lookahead = this.firstChar()
-	}
+	this.lookahead = this.firstChar()
 }
 
 //Fake Destructor please remember to call defer in main method
@@ -78,7 +105,20 @@ func (this *Scanner) GetToken(tabIndex *int) (token TokenType, lexeme string) {
 		return Tokeof, lexeme
 	}
 
+	//Remember where this token started for error reporting
+	this.tokLine, this.tokColumn = this.lineNum, this.column
+	defer func() {
+		//A full symbol table is an error at the token that overflowed it
+		if r := recover(); r != nil {
+			if serr, ok := r.(*SyntaxError); ok && serr.Line == 0 {
+				serr.Line, serr.Column = this.tokLine, this.tokColumn
+			}
+			panic(r)
+		}
+	}()
+
 	lexeme = string(char)
+	this.spelling = string(this.raw)
 	this.lookahead = this.getc()
 
 	switch {
@@ -94,6 +134,24 @@ func (this *Scanner) GetToken(tabIndex *int) (token TokenType, lexeme string) {
 	return
 }
 
+// Line() - Returns the line on which the last token returned
+//			by GetToken started
+func (this *Scanner) Line() int {
+	return this.tokLine
+}
+
+// Column() -	Returns the column at which the last token started,
+//				counting characters from 1; a tab counts as one
+func (this *Scanner) Column() int {
+	return this.tokColumn
+}
+
+// Spelling() -	The last word GetToken returned as it was written,
+//				before it was uppercased
+func (this *Scanner) Spelling() string {
+	return this.spelling
+}
+
 ////////////////////////////////////////////////////////////////////
 //Mark: Private Scanner Functions
 ////////////////////////////////////////////////////////////////////
@@ -104,6 +162,7 @@ func (this *Scanner) scanWord(token *TokenType, lexeme *string, tabIndex *int) {
 
 	for char != endOfFile && (unicode.IsLetter(char) || unicode.IsNumber(char)) {
 		*lexeme += string(char)
+		this.spelling += string(this.raw)
 		char = this.getc()
 	}
 	//Put back last invalid character
@@ -123,6 +182,7 @@ func (this *Scanner) scanWord(token *TokenType, lexeme *string, tabIndex *int) {
 		this.St.Setattrib(*tabIndex, Stunknown, Tokidentifier)
 		*token = Tokidentifier
 	}
+	this.St.Setspelling(*tabIndex, this.spelling)
 
 }
 
@@ -175,23 +235,21 @@ func (this *Scanner) scanNum(token *TokenType, lexeme *string, tabIndex *int) {
 	} else {
 
 		this.St.Setattrib(*tabIndex, Stunknown, Tokconstant)
-		this.St.Installdatatype(*tabIndex, Stliteral, Dtreal)
 
 		if isFloat {
 			// If is it real?
+			this.St.Installdatatype(*tabIndex, Stliteral, Dtreal)
 			rval, _ := strconv.ParseFloat(*lexeme, 32)
 			this.St.SetFvalue(*tabIndex, float32(rval))
 		} else {
 			// Must be an integer literal
+			this.St.Installdatatype(*tabIndex, Stliteral, Dtinteger)
 			ival, _ := strconv.Atoi(*lexeme)
-			this.St.SetIvalue(*tabIndex, ival)
+			this.St.SetIvalue(*tabIndex, wrapInteger(ival))
 		}
 		*token = this.St.gettok_class(*tabIndex)
 		return
 	}
-	this.ungetc(this.lookahead)
-	*token = this.St.gettok_class(*tabIndex)
-	return
 }
 
 func (this *Scanner) scanOp(token *TokenType, lexeme *string, tabIndex *int) {
@@ -205,9 +263,10 @@ func (this *Scanner) scanOp(token *TokenType, lexeme *string, tabIndex *int) {
 	//	table.  If it's not there already, it must be
 	//	invalid
 
+	//	The parser turns this into the error Parse returns
 	if !this.St.IsPresent(*lexeme, tabIndex) {
-		log.Fatal(lexeme, " is an illegal operator on line #", this.lineNum)
-		//exit(3);
+		panic(&SyntaxError{Line: this.tokLine, Column: this.tokColumn, Msg: *lexeme + " is an illegal operator",
+			Details: Details{Code: codeIllegalOperator}})
 	}
 
 	*token = this.St.gettok_class(*tabIndex)
@@ -226,15 +285,20 @@ func (this *Scanner) getc() rune {
 	if err != nil && err != io.EOF {
 		panic(err)
 	}
+	this.prevColumn = this.column
 	//Return adequate identifier if at end of file
 	if err == io.EOF {
 		char = endOfFile
 	} else if char == '\n' {
 		this.lineNum++
+		this.column = 0
 	} else if size == 0 {
 		char = ' ' //uneeded
+	} else {
+		this.column++
 	}
 
+	this.raw = char
 	return unicode.ToUpper(char) //Force all alphabet to upper
 }
 
@@ -242,6 +306,7 @@ func (this *Scanner) ungetc(char rune) {
 	if char == '\n' {
 		this.lineNum--
 	}
+	this.column = this.prevColumn
 	this.reader.UnreadRune()
 }
 
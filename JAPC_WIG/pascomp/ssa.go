@@ -0,0 +1,249 @@
+package pascomp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//////////////////////////Static Single Assignment//////////////////////////
+//Renames the parameters, variables and temporaries a procedure owns so
+//that each is assigned exactly once.  Version 0 is the value a name has
+//on entry and every assignment makes a new version.  Phi nodes are placed
+//on the iterated dominance frontier of the blocks assigning a name, but
+//only for names some block reads before assigning (semi-pruned form);
+//the renaming then walks the dominator tree.  The program's variables
+//belong to the program, so a procedure leaves them alone, and in the
+//program a call gives each of them a new version since the procedure
+//may assign it.  The quadruples of the IrProc are not changed.
+
+// Phi is Sym.Version := phi(Sym.Args[0], ...), one version per predecessor
+type Phi struct {
+	Sym, Version int
+	Args         []int
+}
+
+// SSAName is one version of a symbol
+type SSAName struct {
+	Sym, Version int
+}
+
+// SSAQuad is a quadruple with the version of each renamed operand
+type SSAQuad struct {
+	Quad
+	Versions [3]int    // of Arg1, Arg2 and Result; -1 if not renamed
+	Clobbers []SSAName // for a call in the program: its variables' new versions
+}
+
+// ToSSA() - Build the SSA form of every reachable block
+func (this *CFG) ToSSA() {
+	if len(this.Blocks) == 0 {
+		return
+	}
+	st, p := this.ir.St, this.Proc
+	main := this.ir.Procs[0]
+	renamed := func(s int) bool {
+		if s < 0 || st.Getproc(s) != p.Index {
+			return false
+		}
+		switch st.Getsmclass(s) {
+		case Stparameter, Stvariable, Sttempvar:
+			return true
+		}
+		return false
+	}
+	var clobbered []int
+	if p == main {
+		clobbered = main.Vars
+	}
+
+	//The names read before they are assigned in some block and the
+	//blocks assigning each name
+	global := make(map[int]bool)
+	defs := make(map[int][]*BasicBlock)
+	var names []int
+	for _, b := range this.order {
+		assigned := make(map[int]bool)
+		define := func(s int) {
+			if !assigned[s] {
+				assigned[s] = true
+				if len(defs[s]) == 0 {
+					names = append(names, s)
+				}
+				defs[s] = append(defs[s], b)
+			}
+		}
+		for _, q := range b.Code {
+			for _, s := range quadUses(q) {
+				if renamed(s) && !assigned[s] {
+					global[s] = true
+				}
+			}
+			if quadDefines(q) && renamed(q.Result) {
+				define(q.Result)
+			}
+			if q.Op == IrCall {
+				for _, s := range clobbered {
+					define(s)
+				}
+			}
+		}
+	}
+
+	for _, s := range names {
+		if !global[s] {
+			continue
+		}
+		placed := make(map[*BasicBlock]bool)
+		work := append([]*BasicBlock(nil), defs[s]...)
+		for len(work) > 0 {
+			b := work[len(work)-1]
+			work = work[:len(work)-1]
+			for _, f := range b.Frontier {
+				if placed[f] {
+					continue
+				}
+				placed[f] = true
+				f.Phis = append(f.Phis, &Phi{Sym: s, Args: make([]int, len(f.Preds))})
+				work = append(work, f)
+			}
+		}
+	}
+
+	//Rename down the dominator tree with a stack of versions per name
+	stacks := make(map[int][]int)
+	counts := make(map[int]int)
+	current := func(s int) int {
+		if stack := stacks[s]; len(stack) > 0 {
+			return stack[len(stack)-1]
+		}
+		return 0
+	}
+	fresh := func(s int) int {
+		counts[s]++
+		stacks[s] = append(stacks[s], counts[s])
+		return counts[s]
+	}
+	var rename func(b *BasicBlock)
+	rename = func(b *BasicBlock) {
+		depth := make(map[int]int)
+		for s, stack := range stacks {
+			depth[s] = len(stack)
+		}
+
+		for _, phi := range b.Phis {
+			phi.Version = fresh(phi.Sym)
+		}
+		b.SSA = nil
+		for _, q := range b.Code {
+			sq := SSAQuad{Quad: q, Versions: [3]int{-1, -1, -1}}
+			for i, s := range quadUses(q) {
+				if renamed(s) {
+					sq.Versions[i] = current(s)
+				}
+			}
+			if quadDefines(q) && renamed(q.Result) {
+				sq.Versions[2] = fresh(q.Result)
+			}
+			if q.Op == IrCall {
+				for _, s := range clobbered {
+					sq.Clobbers = append(sq.Clobbers, SSAName{s, fresh(s)})
+				}
+			}
+			b.SSA = append(b.SSA, sq)
+		}
+		for _, s := range b.Succs {
+			for i, pred := range s.Preds {
+				if pred != b {
+					continue
+				}
+				for _, phi := range s.Phis {
+					phi.Args[i] = current(phi.Sym)
+				}
+			}
+		}
+		for _, c := range b.Children {
+			rename(c)
+		}
+
+		for s := range stacks {
+			stacks[s] = stacks[s][:depth[s]]
+		}
+	}
+	rename(this.order[0])
+	this.ssa = true
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Textual Dump
+////////////////////////////////////////////////////////////////////
+
+// ssaName() - A symbol with its version, A.2 or _t5.1
+func (this *CFG) ssaName(sym, version int) string {
+	if sym < 0 {
+		return ""
+	}
+	if version < 0 {
+		return this.ir.Operand(sym)
+	}
+	return this.ir.Operand(sym) + "." + strconv.Itoa(version)
+}
+
+func (this *CFG) formatSSA(q SSAQuad) string {
+	text := formatQuad(q.Quad, this.ssaName(q.Arg1, q.Versions[0]),
+		this.ssaName(q.Arg2, q.Versions[1]), this.ssaName(q.Result, q.Versions[2]))
+	if len(q.Clobbers) > 0 {
+		var names []string
+		for _, c := range q.Clobbers {
+			names = append(names, this.ssaName(c.Sym, c.Version))
+		}
+		text += "\t; defines " + strings.Join(names, ", ")
+	}
+	return text
+}
+
+func (this *CFG) formatPhi(phi *Phi) string {
+	args := make([]string, len(phi.Args))
+	for i, v := range phi.Args {
+		args[i] = this.ssaName(phi.Sym, v)
+	}
+	return fmt.Sprintf("%s := phi(%s)", this.ssaName(phi.Sym, phi.Version), strings.Join(args, ", "))
+}
+
+// Dump() -	Write the blocks of the graph, each headed by its
+//			predecessors, immediate dominator and dominance frontier
+func (this *CFG) Dump(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	kind := "procedure"
+	if this.Proc == this.ir.Procs[0] {
+		kind = "program"
+	}
+	fmt.Fprintf(bw, "%s %s\n", kind, this.ir.St.Getlexeme(this.Proc.Index))
+	list := func(blocks []*BasicBlock) string {
+		if len(blocks) == 0 {
+			return "-"
+		}
+		names := make([]string, len(blocks))
+		for i, b := range blocks {
+			names[i] = this.Name(b)
+		}
+		return strings.Join(names, " ")
+	}
+	for _, b := range this.Blocks {
+		idom := "-"
+		if b.Idom != nil {
+			idom = this.Name(b.Idom)
+		}
+		if b.rpo < 0 {
+			idom = "unreachable"
+		}
+		fmt.Fprintf(bw, "%s:\t; preds %s; idom %s; frontier %s\n",
+			this.Name(b), list(b.Preds), idom, list(b.Frontier))
+		for _, line := range this.blockLines(b) {
+			fmt.Fprintf(bw, "\t%s\n", strings.TrimPrefix(line, "  "))
+		}
+	}
+	return bw.Flush()
+}
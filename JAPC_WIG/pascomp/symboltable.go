@@ -108,6 +108,9 @@ func (this *SymbolTable) Installname(name string, tabindex *int) bool {
 	// (linking it to its previous entry if necessary) and
 	// create an entry in the attribute table with the
 	// bare essentials.
+	if this.namTabLen == nameTableSize || this.strTabLen+length > stringTableSize {
+		panic(tableFull("the symbol table has no room for " + name))
+	}
 	nameindex = this.namTabLen
 	this.namTabLen++
 	this.nametable[nameindex].strstart = this.strTabLen
@@ -126,6 +129,15 @@ func (this *SymbolTable) Installname(name string, tabindex *int) bool {
 
 }
 
+// tableFull() -	The error for a program with more names than the
+//					tables hold, which the scanner places at the token
+//					it was installing
+func tableFull(msg string) *SyntaxError {
+	return &SyntaxError{Msg: msg, Details: Details{Code: codeTableFull,
+		Notes: []string{fmt.Sprintf("a program may have at most %d names and %d characters of them",
+			attribTableSize, stringTableSize)}}}
+}
+
 // ispresent() - after finding the hash value, it traces
 //		 through the hash list, link by link looking to see
 //		 if the current token string is there.
@@ -186,10 +198,11 @@ func (this *SymbolTable) IsPresent(name string, tabIndex *int) (found bool) {
 	}
 
 	// If it's there, we actually went right past it.
-	if found {
-		nameindex = oldnameindex
+	if !found {
+		*tabIndex = -1
+		return
 	}
-	*tabIndex = this.nametable[nameindex].symtabptr
+	*tabIndex = this.nametable[oldnameindex].symtabptr
 	return
 }
 
@@ -228,6 +241,9 @@ func (this *SymbolTable) hashcode(name string) int {
 func (this *SymbolTable) Installattrib(nameindex int) int {
 
 	var tabindex int = this.attribTabLen
+	if tabindex == attribTableSize {
+		panic(tableFull("the attribute table is full"))
+	}
 	this.nametable[nameindex].symtabptr = tabindex
 	this.attribTabLen++
 	this.attribTable[tabindex].thisname = nameindex
@@ -313,6 +329,63 @@ func (this *SymbolTable) closescope() {
 
 }
 
+// EnterProc() -	Push the current procedure on the procedure
+//					stack and make tabindex the procedure whose
+//					scope new identifiers are linked into
+func (this *SymbolTable) enterproc(tabindex int) {
+	this.procStack.Push(this.thisproc)
+	this.thisproc = this.initprocentry(tabindex)
+}
+
+// ExitProc() -	Close the scope of the current procedure and
+//				restore the enclosing procedure from the stack
+func (this *SymbolTable) exitproc() {
+	this.closescope()
+	if item := this.procStack.Pop(); item != nil {
+		this.thisproc = item.(procstackitem)
+	} else {
+		this.thisproc = this.initprocentry(-1)
+	}
+}
+
+// InstallTemp() -	Create an entry for a temporary variable (Sttempvar)
+//					or a label (Stlabel) belonging to a procedure.  The
+//					entry is named after the label makelabel gives it
+//					so that it prints like any other symbol.
+func (this *SymbolTable) Installtemp(owner int, stype SemanticType, dclass DataType) int {
+	var tabindex int
+	name := "_t"
+	if stype == Stlabel {
+		name = "_loop"
+	}
+	this.Installname(name+strconv.Itoa(this.attribTabLen), &tabindex)
+	this.Setattrib(tabindex, stype, Tokidentifier)
+	this.Installdatatype(tabindex, stype, dclass)
+	this.Setproc(owner, tabindex)
+	return tabindex
+}
+
+// InstallLiteral() -	Find or create the entry for a literal the way the
+//						scanner installs one, for values worked out at
+//						compile time.  A real's lexeme must contain a
+//						point or exponent so it cannot name an integer.
+func (this *SymbolTable) Installliteral(lexeme string, dclass DataType) int {
+	var tabindex int
+	if this.Installname(lexeme, &tabindex) {
+		return tabindex
+	}
+	this.Setattrib(tabindex, Stunknown, Tokconstant)
+	this.Installdatatype(tabindex, Stliteral, dclass)
+	if dclass == Dtreal {
+		rval, _ := strconv.ParseFloat(lexeme, 32)
+		this.SetFvalue(tabindex, float32(rval))
+	} else {
+		ival, _ := strconv.Atoi(lexeme)
+		this.SetIvalue(tabindex, wrapInteger(ival))
+	}
+	return tabindex
+}
+
 // SetProc() -	Set the identifier's owning procedure
 func (this *SymbolTable) Setproc(thisproc int, tabindex int) {
 	this.attribTable[tabindex].owningprocedure = thisproc
@@ -323,6 +396,12 @@ func (this *SymbolTable) Getproc(tabindex int) int {
 	return this.attribTable[tabindex].owningprocedure
 }
 
+// GetOuterScope() -	Returns the entry the identifier hides in an
+//						outer scope, or -1 if it hides none
+func (this *SymbolTable) Getouterscope(tabindex int) int {
+	return this.attribTable[tabindex].outerscope
+}
+
 // SetValue() -	Set the value for a real identifier
 func (this *SymbolTable) SetFvalue(tabindex int, val float32) {
 	this.attribTable[tabindex].value.tag = treal
@@ -339,11 +418,23 @@ func (this *SymbolTable) SetIvalue(tabindex, val int) {
 //						generator.  If the label is not Installed in the
 //						symbol table, it creates one and returns it.
 func (this *SymbolTable) Getlabel(tabindex int, varlabel []rune) {
-	if this.attribTable[tabindex].label[0] != 0 {
-		copy(varlabel, this.attribTable[tabindex].label[:])
-	} else {
-		this.makelabel(tabindex, &varlabel)
+	if this.attribTable[tabindex].label[0] == 0 {
+		var label []rune
+		this.makelabel(tabindex, &label)
 	}
+	copy(varlabel, this.attribTable[tabindex].label[:])
+}
+
+// GetLabelName() -	Returns the label from Getlabel as a string
+func (this *SymbolTable) Getlabelname(tabindex int) string {
+	label := make([]rune, labelSize)
+	this.Getlabel(tabindex, label)
+	for i, r := range label {
+		if r == 0 {
+			return string(label[:i])
+		}
+	}
+	return string(label)
 }
 
 // makelabel() -	Makes a label which is used by the final code
@@ -353,30 +444,26 @@ func (this *SymbolTable) makelabel(tabindex int, label *[]rune) {
 	var ivalue int
 	var indexstr string // [5]rune
 
-	*label = make([]rune, labelSize)
-
 	switch this.Getsmclass(tabindex) {
 	case Stliteral:
 		if this.Getdatatype(tabindex) == Dtinteger {
 			ivalue = this.attribTable[tabindex].thisname
 			temp := this.nametable[ivalue].strstart
 			k := temp + this.nametable[ivalue].strlength
-			*label = this.stringtable[temp:k]
+			*label = append([]rune(nil), this.stringtable[temp:k]...)
 			break
 		}
 		fallthrough
 
 	case Sttempvar:
-		copy(*label, []rune("_t")[:])
 		//strconv.Itoa(123)
 		indexstr = strconv.FormatInt(int64(tabindex), 10)
 		//label = fmt.Sprint(label, indexstr)
-		*label = append((*label), []rune(indexstr)...)
+		*label = append([]rune("_t"), []rune(indexstr)...)
 		break
 	case Stlabel:
-		copy(*label, []rune("_loop")[:])
 		indexstr = strconv.FormatInt(int64(tabindex), 10)
-		*label = append((*label), []rune(indexstr)...)
+		*label = append([]rune("_loop"), []rune(indexstr)...)
 		break
 	case Stprogram:
 		fallthrough
@@ -388,7 +475,8 @@ func (this *SymbolTable) makelabel(tabindex int, label *[]rune) {
 		ivalue = this.attribTable[tabindex].thisname
 		temp := this.nametable[ivalue].strstart
 		k := temp + this.nametable[ivalue].strlength
-		*label = this.stringtable[temp:k]
+		//Copy the lexeme so appending cannot overwrite the string table
+		*label = append([]rune(nil), this.stringtable[temp:k]...)
 
 		if len(*label) >= 5 {
 			indexstr = strconv.FormatInt(int64(tabindex), 10)
@@ -398,10 +486,17 @@ func (this *SymbolTable) makelabel(tabindex int, label *[]rune) {
 	copy(this.attribTable[tabindex].label[:], *label)
 }
 
+// labelscope() -	Label every parameter, local variable and temporary
+//					of a procedure with its address relative to bp.
+//					Parameters are pushed in order before the call so
+//					the last one sits just above the return address and
+//					saved bp at [bp+4]; locals and temporaries grow down
+//					from [bp-2].  Integers take 2 bytes and reals 4.
+//					Returns the number of bytes of locals to reserve.
 func (this *SymbolTable) labelscope(procindex int) int {
 
-	var oldsymptr, symptr, numbytes int //totalbytes int
-	var label = make([]rune, labelSize)
+	var symptr, numbytes int //totalbytes int
+	var label []rune
 
 	for symptr = this.Getivalue(procindex); symptr != 0; symptr = this.Getivalue(symptr) {
 		//numrunes += (this.getdatatype(symptr) == dtinteger)? 2 : 4;
@@ -412,50 +507,47 @@ func (this *SymbolTable) labelscope(procindex int) int {
 
 	}
 
-	//totalbytes = numbytes
-	for oldsymptr, symptr = symptr, this.Getivalue(procindex); symptr != 0; oldsymptr, symptr = symptr, this.Getivalue(symptr) {
+	//Skip the saved bp and the return address
+	numbytes += 4
+	for symptr = this.Getivalue(procindex); symptr != 0; symptr = this.Getivalue(symptr) {
 		this.paramlabel(symptr, &label, &numbytes)
 	}
 
-	numbytes -= 2
-	if this.Getivalue(procindex) == 0 {
-		symptr = procindex + 1
-	} else {
-		symptr = this.attribTable[oldsymptr].scopenext
-	}
-	for ; symptr != -1 && this.Getsmclass(symptr) != Stprocedure; symptr = this.attribTable[symptr].scopenext {
-		this.paramlabel(symptr, &label, &numbytes)
+	numbytes = 0
+	for symptr = 0; symptr < this.attribTabLen; symptr++ {
+		if this.Getproc(symptr) != procindex {
+			continue
+		}
+		if sm := this.Getsmclass(symptr); sm == Stvariable || sm == Sttempvar {
+			this.paramlabel(symptr, &label, &numbytes)
+		}
 	}
-	return (-numbytes - 2)
+	return -numbytes
 }
 
+// paramlabel() -	Move bytecount down past this symbol and label it
+//					with the resulting offset from bp
 func (this *SymbolTable) paramlabel(tabindex int, label *[]rune, bytecount *int) {
 	var indexstr string
 	//	enum symboltype thissymbol;
 
-	if *bytecount < 0 {
-		if this.Getdatatype(tabindex) == Dtinteger {
-			copy(*label, []rune("[bp")[:])
-
-		} else {
-			copy(*label, []rune("[bp")[:])
-		}
-	} else {
-		copy(*label, []rune("[bp"))
+	//*runecount -= this.Ggetdatatype(tabindex) == dtinteger? 2: 4;
+	*bytecount -= 2
+	if this.Getdatatype(tabindex) != Dtinteger {
+		*bytecount -= 2 //- 4
 	}
+
+	*label = []rune("[bp")
 	if *bytecount > 0 {
 		*label = append((*label), []rune("+")...)
 	}
 
 	indexstr = strconv.FormatInt(int64(*bytecount), 10)
 	*label = append((*label), []rune(indexstr)...)
-	//*runecount -= this.Ggetdatatype(tabindex) == dtinteger? 2: 4;
-	*bytecount -= 2
-	if this.Getdatatype(tabindex) != Dtinteger {
-		*bytecount -= 2 //- 4
-	}
-
 	*label = append((*label), []rune("]")...)
+
+	//Clear any label this symbol had before
+	this.attribTable[tabindex].label = [labelSize]rune{}
 	copy(this.attribTable[tabindex].label[:], *label)
 }
 
@@ -468,6 +560,32 @@ func (this *SymbolTable) Printlexeme(tabindex int) {
 	fmt.Print(string(s))
 }
 
+// GetLexeme() - Returns the lexeme for a given attribute table entry
+func (this *SymbolTable) Getlexeme(tabindex int) string {
+	i := this.attribTable[tabindex].thisname
+	j := this.nametable[i].strstart
+	k := j + this.nametable[i].strlength
+	return string(this.stringtable[j:k])
+}
+
+// Setspelling() -	Remember how a name was written in the source.
+//					Only the first spelling seen is kept.
+func (this *SymbolTable) Setspelling(tabindex int, spelling string) {
+	name := &this.nametable[this.attribTable[tabindex].thisname]
+	if name.spelling == "" {
+		name.spelling = spelling
+	}
+}
+
+// Getspelling() -	The name of an entry as it was first written, or
+//					its lexeme if the scanner did not record one
+func (this *SymbolTable) Getspelling(tabindex int) string {
+	if spelling := this.nametable[this.attribTable[tabindex].thisname].spelling; spelling != "" {
+		return spelling
+	}
+	return this.Getlexeme(tabindex)
+}
+
 // PrintToken() -	Print the token class's name given the token
 //                  class.
 func (this *SymbolTable) Printtoken(i int) {
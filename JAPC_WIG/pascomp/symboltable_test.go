@@ -0,0 +1,165 @@
+package pascomp
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSymbolTableCapacity(t *testing.T) {
+	st := NewSymbolTable()
+	first := st.attribTabLen
+	entries := make(map[string]int)
+	for i := first; i < attribTableSize; i++ {
+		var index int
+		name := fmt.Sprintf("N%d", i)
+		if st.Installname(name, &index) {
+			t.Fatalf("%s was already installed", name)
+		}
+		entries[name] = index
+	}
+	if st.attribTabLen != attribTableSize {
+		t.Fatalf("%d entries after filling the table, want %d", st.attribTabLen, attribTableSize)
+	}
+
+	//Every name is found again at its entry, the first and last too
+	for name, want := range entries {
+		var index int
+		if !st.IsPresent(name, &index) || index != want {
+			t.Fatalf("%s is at %d, want %d", name, index, want)
+		}
+		if got := st.Getlexeme(index); got != name {
+			t.Fatalf("entry %d is %s, want %s", index, got, name)
+		}
+	}
+	var index int
+	if !st.Installname("n1999", &index) || index != entries["N1999"] {
+		t.Errorf("installing N1999 again gave entry %d, want %d", index, entries["N1999"])
+	}
+
+	//One more name is an error, not an exit
+	defer func() {
+		serr, ok := recover().(*SyntaxError)
+		if !ok || serr.Code != codeTableFull {
+			t.Errorf("installing into a full table panicked with %#v, want a table-full error", serr)
+		}
+	}()
+	st.Installname("ONEMORE", &index)
+	t.Error("installing into a full table did not fail")
+}
+
+func TestInstallTempAndLiteral(t *testing.T) {
+	prog := parseSource(t, constProgram)
+	st := prog.St
+
+	temp := st.Installtemp(prog.Name, Sttempvar, Dtreal)
+	if got, want := st.Getlabelname(temp), fmt.Sprintf("_t%d", temp); got != want {
+		t.Errorf("temporary is labeled %q, want %q", got, want)
+	}
+	if st.Getlexeme(temp) != fmt.Sprintf("_T%d", temp) || st.Getproc(temp) != prog.Name ||
+		st.Getsmclass(temp) != Sttempvar || st.Getdatatype(temp) != Dtreal {
+		t.Errorf("temporary %d is %s of %d, %v %v", temp, st.Getlexeme(temp), st.Getproc(temp),
+			st.Getsmclass(temp), st.Getdatatype(temp))
+	}
+	label := st.Installtemp(prog.Name, Stlabel, Dtnone)
+	if got, want := st.Getlabelname(label), fmt.Sprintf("_loop%d", label); got != want {
+		t.Errorf("label is labeled %q, want %q", got, want)
+	}
+	if other := st.Installtemp(prog.Name, Sttempvar, Dtinteger); other == temp || other == label {
+		t.Errorf("a second temporary reuses entry %d", other)
+	}
+
+	//The scanner's 10 and Installliteral's are the same entry
+	ten := st.Installliteral("10", Dtinteger)
+	if st.Getivalue(ten) != 10 || st.Getsmclass(ten) != Stliteral || st.Getlabelname(ten) != "10" {
+		t.Errorf("literal 10 is %v %d labeled %q", st.Getsmclass(ten), st.Getivalue(ten), st.Getlabelname(ten))
+	}
+	if again := st.Installliteral("10", Dtinteger); again != ten {
+		t.Errorf("literal 10 installed again at %d, want %d", again, ten)
+	}
+	half := st.Installliteral("0.5", Dtreal)
+	if st.Getdatatype(half) != Dtreal || st.Getrvalue(half) != 0.5 {
+		t.Errorf("literal 0.5 is %v %v", st.Getdatatype(half), st.Getrvalue(half))
+	}
+}
+
+func TestLabelScope(t *testing.T) {
+	prog := parseSource(t, `PROGRAM Scopes;
+	DECLARE
+		INTEGER count, x;
+		REAL total;
+
+	PROCEDURE Add PARAMETERS INTEGER x; REAL y;
+		DECLARE INTEGER count; REAL sum;
+	BEGIN
+		SET count = x;
+		SET sum = y + count
+	END;
+
+	PROCEDURE Twice PARAMETERS INTEGER count;
+	BEGIN
+		WRITE count * 2
+	END;
+
+	BEGIN
+		SET count = 1;
+		SET x = 2;
+		SET total = 3.5;
+		CALL Add(x, total);
+		CALL Twice(count)
+	END.
+`)
+	st := prog.St
+	entry := func(proc int, name string) int {
+		t.Helper()
+		for i := 0; i < st.attribTabLen; i++ {
+			if st.Getproc(i) == proc && st.Getlexeme(i) == name {
+				return i
+			}
+		}
+		t.Fatalf("no %s in %s", name, st.Getlexeme(proc))
+		return -1
+	}
+	add, twice := prog.Block.Procs[0].Index, prog.Block.Procs[1].Index
+
+	//Parameters sit above the saved bp and return address in order,
+	//locals below bp in the order they were declared
+	if reserved := st.labelscope(add); reserved != 6 {
+		t.Errorf("Add reserves %d bytes of locals, want 6", reserved)
+	}
+	if reserved := st.labelscope(twice); reserved != 0 {
+		t.Errorf("Twice reserves %d bytes of locals, want 0", reserved)
+	}
+	tests := []struct {
+		proc  int
+		name  string
+		label string
+	}{
+		{add, "X", "[bp+8]"},
+		{add, "Y", "[bp+4]"},
+		{add, "COUNT", "[bp-2]"},
+		{add, "SUM", "[bp-6]"},
+		{twice, "COUNT", "[bp+4]"},
+		//The program's names keep their own labels under the ones
+		//the procedures hide
+		{prog.Name, "COUNT", fmt.Sprintf("COUNT%d", entry(prog.Name, "COUNT"))},
+		{prog.Name, "X", "X"},
+		{prog.Name, "TOTAL", fmt.Sprintf("TOTAL%d", entry(prog.Name, "TOTAL"))},
+	}
+	for _, test := range tests {
+		index := entry(test.proc, test.name)
+		if got := st.Getlabelname(index); got != test.label {
+			t.Errorf("%s in %s is labeled %q, want %q", test.name, st.Getlexeme(test.proc), got, test.label)
+		}
+	}
+
+	//Each hiding name links to the one it hides
+	for _, proc := range []int{add, twice} {
+		inner := entry(proc, "COUNT")
+		if outer := st.Getouterscope(inner); outer != entry(prog.Name, "COUNT") {
+			t.Errorf("COUNT in %s hides entry %d, want the program's", st.Getlexeme(proc), outer)
+		}
+	}
+	if outer := st.Getouterscope(entry(prog.Name, "COUNT")); outer != -1 {
+		t.Errorf("the program's COUNT hides entry %d", outer)
+	}
+}
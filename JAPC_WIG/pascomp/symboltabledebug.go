@@ -1,9 +1,14 @@
 package pascomp
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
 
 var tokclstring = [...]string{"begin     ", "call      ",
-	"declare   ", "do        ", "else      ", "end       ",
+	"const     ", "declare   ", "do        ", "else      ", "end       ",
 	"endif     ", "enduntil  ", "endwhile  ", "if        ",
 	"integer   ", "parameters", "procedure ", "program   ",
 	"read      ", "real      ", "set       ", "then      ",
@@ -31,17 +36,22 @@ var datatypestring = [...]string{"unknown", "none   ", "program",
 //						information, including the name and token
 //						class
 func DumpSymbolTable(st *SymbolTable) {
+	WriteSymbolTable(os.Stdout, st)
+}
+
+// WriteSymbolTable() -	Writes the dump DumpSymbolTable prints to w
+func WriteSymbolTable(w io.Writer, st *SymbolTable) {
 	var i, j int
 	var printstring string
 
 	//	Print the symbol table's heading
-	fmt.Print("SYMBOL TABLE DUMP\n-----------------\n\n")
-	fmt.Print("                   Token       Symbol     Data")
-	fmt.Print("              Owning\n")
-	fmt.Print("Index   Name       Class       Type       Type")
-	fmt.Print("          Value   Procedure    Label\n")
-	fmt.Print("-----   ----       -----       ------     ----")
-	fmt.Print("          -----   ---------    ---------------\n")
+	fmt.Fprint(w, "SYMBOL TABLE DUMP\n-----------------\n\n")
+	fmt.Fprint(w, "                   Token       Symbol     Data")
+	fmt.Fprint(w, "              Owning\n")
+	fmt.Fprint(w, "Index   Name       Class       Type       Type")
+	fmt.Fprint(w, "          Value   Procedure    Label\n")
+	fmt.Fprint(w, "-----   ----       -----       ------     ----")
+	fmt.Fprint(w, "          -----   ---------    ---------------\n")
 
 	//	Print the data for each entry
 	for i = 0; i < st.attribTabLen; i++ {
@@ -49,8 +59,8 @@ func DumpSymbolTable(st *SymbolTable) {
 		//if (i%10 == 9) st.getchar();
 
 		//	Print the entry number and lexeme
-		fmt.Printf("%5d\t", i)
-		st.Printlexeme(i)
+		fmt.Fprintf(w, "%5d\t", i)
+		fmt.Fprint(w, st.Getlexeme(i))
 
 		//
 		//	After printing the lexeme, move to column 20.  If
@@ -62,39 +72,39 @@ func DumpSymbolTable(st *SymbolTable) {
 		printstring = string(st.stringtable[s:e])
 		if len(printstring) < 11 {
 			for j = 0; j < 11-len(printstring); j++ {
-				fmt.Print(" ")
+				fmt.Fprint(w, " ")
 			}
 		} else {
-			fmt.Print("\n          ")
+			fmt.Fprint(w, "\n          ")
 		}
 		// Print the token class, symbol type and data type
-		fmt.Print(tokclstring[st.attribTable[i].tok_class], "  ")
-		fmt.Print(symtypestring[st.attribTable[i].smtype], "  ")
-		fmt.Print(datatypestring[st.attribTable[i].dataclass], "  ")
+		fmt.Fprint(w, tokclstring[st.attribTable[i].tok_class], "  ")
+		fmt.Fprint(w, symtypestring[st.attribTable[i].smtype], "  ")
+		fmt.Fprint(w, datatypestring[st.attribTable[i].dataclass], "  ")
 
 		//	If the value is real or integer, print the
 		//	value in the correct format.
 		if st.attribTable[i].value.tag == tint {
-			fmt.Printf("%10d", st.attribTable[i].value.val.(int))
+			fmt.Fprintf(w, "%10d", st.attribTable[i].value.val.(int))
 		} else {
-			fmt.Printf("%1.4E", st.attribTable[i].value.val.(float32))
+			fmt.Fprintf(w, "%1.4E", st.attribTable[i].value.val.(float32))
 		}
 		//	If there is no procedure that owns the symbol
 		//	(which is the case for reserved words, operators,
 		//	and literals), print "global."
 		if st.attribTable[i].owningprocedure == -1 {
-			fmt.Print("   global")
+			fmt.Fprint(w, "   global")
 			//	Otherwise print the name of the owning
 			//	procedure in capital letters to make it
 			//	stand out.
 		} else {
-			fmt.Print("   ")
-			st.LexemeInCaps(st.attribTable[i].owningprocedure)
+			fmt.Fprint(w, "   ")
+			fmt.Fprint(w, strings.ToUpper(st.Getlexeme(st.attribTable[i].owningprocedure)))
 		}
 
 		//	Print the assembly language label.
-		fmt.Print("       ", st.attribTable[i].label)
-		fmt.Println()
+		fmt.Fprint(w, "       ", strings.TrimRight(string(st.attribTable[i].label[:]), "\x00"))
+		fmt.Fprintln(w)
 	}
 
 }
@@ -127,7 +137,7 @@ func DumpSymbolTable2(st *SymbolTable) {
 		} else {
 			fmt.Printf("%d\t", st.attribTable[i].value.val.(int))
 		}
-		fmt.Printf("%s\n", st.attribTable[i].label)
+		fmt.Printf("%s\n", string(st.attribTable[i].label[:]))
 	}
 
 	for i = 0; i < st.strTabLen; i++ {
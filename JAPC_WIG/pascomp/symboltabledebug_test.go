@@ -0,0 +1,69 @@
+package pascomp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// parseSource() - Parse a program held in a string, failing the test on an error
+func parseSource(t *testing.T, source string) *Program {
+	t.Helper()
+	var scanner Scanner
+	scanner.NewScannerReader(strings.NewReader(source))
+	prog, err := NewParser(&scanner).Parse()
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return prog
+}
+
+// dumpFields() - The fields of the dump's line for a name
+func dumpFields(t *testing.T, dump, name string) []string {
+	t.Helper()
+	for _, line := range strings.Split(dump, "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && fields[1] == name {
+			return fields
+		}
+	}
+	t.Fatalf("no line for %s in\n%s", name, dump)
+	return nil
+}
+
+const constProgram = `PROGRAM Sample;
+	CONST
+		limit = 10;
+	DECLARE
+		INTEGER count;
+	BEGIN
+		SET count = limit;
+		WRITE count
+	END.
+`
+
+func TestTokenClassNames(t *testing.T) {
+	if len(tokclstring) != int(Tokunknown)+1 {
+		t.Fatalf("%d token class names for %d token classes", len(tokclstring), int(Tokunknown)+1)
+	}
+}
+
+func TestWriteSymbolTableClasses(t *testing.T) {
+	prog := parseSource(t, constProgram)
+	var out bytes.Buffer
+	WriteSymbolTable(&out, prog.St)
+
+	tests := []struct{ name, class string }{
+		{"CALL", "call"},
+		{"CONST", "const"},
+		{"DECLARE", "declare"},
+		{"WRITE", "write"},
+		{")", "closeparen"},
+		{"LIMIT", "identifier"},
+		{"COUNT", "identifier"},
+	}
+	for _, test := range tests {
+		if fields := dumpFields(t, out.String(), test.name); len(fields) < 3 || fields[2] != test.class {
+			t.Errorf("%s has class %q, want %q", test.name, fields[2], test.class)
+		}
+	}
+}
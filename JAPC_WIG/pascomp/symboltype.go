@@ -6,18 +6,18 @@ const (
 	tabStop int = 8
 	// The size of the name table, hash table,
 	// string table and attribute table
-	nameTableSize   int = 200
+	nameTableSize   int = 2000
 	hashTableSize   int = 100
-	stringTableSize int = 1200
-	attribTableSize int = 200
+	stringTableSize int = 12000
+	attribTableSize int = 2000
 
 	// No more than 120 characters per line + null
 	maxLine int = 121
 
-	// The Pascal Subset for this project currently contains 21 keywords
+	// The Pascal Subset for this project currently contains 22 keywords
 	// and 13 other tokens with entries in the symbol table
 	// their is also 1 additional to handle the special case float
-	numKeywords int = 21
+	numKeywords int = 22
 	numOthers   int = 13
 	numTokens   int = numKeywords + numOthers
 	labelSize   int = 10
@@ -44,12 +44,14 @@ type attribTabType struct {
 
 // The structure for name table entries, i.e, a starting point in
 // a long array, a pointer to the entry in the attribute table and
-//	the next lexeme with the same hash value.
+//	the next lexeme with the same hash value.  The spelling is the
+//	name as it was first written, before the scanner uppercased it.
 type nameTabType struct {
 	strstart  int
 	strlength int
 	symtabptr int
 	nextname  int
+	spelling  string
 }
 
 //////////////////////////COMPLIMENTING DATA OBJECTS//////////////////////////
@@ -100,8 +102,9 @@ type TokenType int
 const (
 	Tokbegin   TokenType = iota //1
 	Tokcall                     //2
-	Tokdeclare                  //3
-	Tokdo                       //4
+	Tokconst                    //3
+	Tokdeclare                  //4
+	Tokdo                       //5
 	Tokelse
 	Tokend
 	Tokendif
@@ -142,7 +145,7 @@ const (
 
 // [...] is to tell the Go intrepreter/compiler to figure out the array size
 var tokenTypes = [...]string{"tokbegin",
-	"tokcall", "tokdeclare", "tokdo",
+	"tokcall", "tokconst", "tokdeclare", "tokdo",
 	"tokelse", "tokend", "tokendif", "tokenduntil",
 	"tokendwhile", "tokif", "tokinteger",
 	"tokparameters", "tokprocedure", "tokprogram",
@@ -161,13 +164,18 @@ func (tok TokenType) String() string {
 
 //	The key words and operators - used in initializing the symbol
 //	table
-var keywords = [...]string{"begin", "call", "declare",
+var keywords = [...]string{"begin", "call", "const", "declare",
 	"do", "else", "end", "endif", "enduntil", "endwhile",
 	"if", "integer", "parameters", "procedure", "program",
 	"read", "real", "set", "then", "until", "while",
 	"write", "*", "+", "-", "/", "=", ";",
 	",", ".", ">", "<", "!", "(", ")", "_float"}
 
+// Keywords() - The language's keywords, in lower case
+func Keywords() []string {
+	return append([]string(nil), keywords[:numKeywords]...)
+}
+
 //////////////////////////SYMANTIC TYPES//////////////////////////
 // The semantic types, i.e, keywords, procedures, variables, constants
 type SemanticType int
@@ -222,3 +230,10 @@ var dataTypes = [...]string{
 func (dat DataType) String() string {
 	return dataTypes[dat]
 }
+
+// wrapInteger() -	An integer as the language keeps it: 32 bits wide,
+//					wrapping around when it overflows like every target
+//					but x86, whose integers are its machine word
+func wrapInteger(v int) int {
+	return int(int32(v))
+}
@@ -0,0 +1,167 @@
+package pascomp
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+//////////////////////////Token Dumps//////////////////////////
+//The tokens of a program with where each starts, written in one of
+//several formats: the lexeme and token class separated by a tab as
+//the scanner has always printed them, one JSON object to a line, CSV
+//with a header row, or a table whose columns line up.  Words keep the
+//spelling they were written with; everything else is the lexeme the
+//symbol table holds.
+
+// Token is one token the scanner found
+type Token struct {
+	Type   TokenType
+	Lexeme string
+	Index  int // the attribute table entry
+	Line   int
+	Column int // counting characters from 1
+}
+
+// Kind() - The token's class without its tok prefix, such as identifier
+func (t Token) Kind() string {
+	return strings.TrimPrefix(t.Type.String(), "tok")
+}
+
+// ScanAll() -	Every token up to the end of the file.  An illegal
+//				operator stops the scan and is returned as a
+//				*SyntaxError with the tokens before it.
+func (this *Scanner) ScanAll() (tokens []Token, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			serr, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			err = serr
+		}
+	}()
+
+	var index int
+	for {
+		tok, lexeme := this.GetToken(&index)
+		if tok == Tokeof {
+			return tokens, nil
+		}
+		if first := []rune(lexeme); len(first) > 0 && unicode.IsLetter(first[0]) {
+			lexeme = this.Spelling()
+		}
+		tokens = append(tokens, Token{Type: tok, Lexeme: lexeme, Index: index,
+			Line: this.Line(), Column: this.Column()})
+	}
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Token Text
+////////////////////////////////////////////////////////////////////
+
+// sourceText is a program's text with where each of its lines starts,
+// for finding the text of the tokens scanned from it
+type sourceText struct {
+	text  []rune
+	lines []int // the offset in text at which each line starts
+}
+
+// newSourceText() - The text of a program
+func newSourceText(source []byte) sourceText {
+	this := sourceText{text: []rune(string(source)), lines: []int{0}}
+	for i, r := range this.text {
+		if r == '\n' {
+			this.lines = append(this.lines, i+1)
+		}
+	}
+	return this
+}
+
+// offset() -	The offset in the text of a line and column, or the end
+//				of the text for a place past it
+func (this sourceText) offset(line, column int) int {
+	if line > len(this.lines) {
+		return len(this.text)
+	}
+	if at := this.lines[line-1] + column - 1; at < len(this.text) {
+		return at
+	}
+	return len(this.text)
+}
+
+// extent() -	Where the text of one of the tokens scanned from the
+//				text starts and ends.  A token runs to the next token, a
+//				space or a comment, and no further than limit.
+func (this sourceText) extent(tokens []Token, i, limit int) (start, end int) {
+	start = this.offset(tokens[i].Line, tokens[i].Column)
+	if i+1 < len(tokens) {
+		limit = this.offset(tokens[i+1].Line, tokens[i+1].Column)
+	}
+	end = start + 1
+	for end < limit && !unicode.IsSpace(this.text[end]) && this.text[end] != '{' {
+		end++
+	}
+	return start, end
+}
+
+// TokenFormats are the formats WriteTokens knows
+var TokenFormats = []string{"text", "json", "csv", "table"}
+
+// WriteTokens() - Write tokens in one of the TokenFormats
+func WriteTokens(w io.Writer, st *SymbolTable, tokens []Token, format string) error {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case "text":
+		for _, t := range tokens {
+			fmt.Fprintf(bw, "%s\t%s\n", st.Getlexeme(t.Index), t.Type)
+		}
+
+	case "json":
+		enc := json.NewEncoder(bw)
+		for _, t := range tokens {
+			err := enc.Encode(struct {
+				Kind   string `json:"kind"`
+				Lexeme string `json:"lexeme"`
+				Index  int    `json:"index"`
+				Line   int    `json:"line"`
+				Column int    `json:"column"`
+			}{t.Kind(), t.Lexeme, t.Index, t.Line, t.Column})
+			if err != nil {
+				return err
+			}
+		}
+
+	case "csv":
+		cw := csv.NewWriter(bw)
+		cw.Write([]string{"kind", "lexeme", "index", "line", "column"})
+		for _, t := range tokens {
+			cw.Write([]string{t.Kind(), t.Lexeme, strconv.Itoa(t.Index),
+				strconv.Itoa(t.Line), strconv.Itoa(t.Column)})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+
+	case "table":
+		tw := tabwriter.NewWriter(bw, 0, tabStop, 2, ' ', 0)
+		fmt.Fprintln(tw, "KIND\tLEXEME\tINDEX\tLINE\tCOLUMN")
+		for _, t := range tokens {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\n", t.Kind(), t.Lexeme, t.Index, t.Line, t.Column)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unknown token format %q; use one of %s", format, strings.Join(TokenFormats, ", "))
+	}
+	return bw.Flush()
+}
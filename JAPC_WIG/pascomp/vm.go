@@ -0,0 +1,210 @@
+package pascomp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+//////////////////////////Virtual Machine//////////////////////////
+//A stack machine that executes a Module.  Values are pushed on a single
+//operand stack; each call pushes a frame holding the callee's slots and
+//the address to return to.
+
+// Calls nested deeper than this are reported as a stack overflow
+const maxCallDepth = 100000
+
+// A value of either data type
+type vmValue struct {
+	i int64
+	r float64
+}
+
+// A variable's storage and whether it has been assigned yet
+type vmSlot struct {
+	vmValue
+	set bool
+}
+
+type vmFrame struct {
+	proc  int
+	ret   int
+	slots []vmSlot
+}
+
+type VM struct {
+	m       *Module
+	in      *bufio.Reader
+	out     *bufio.Writer
+	stack   []vmValue
+	globals []vmSlot
+	frames  []vmFrame
+}
+
+// NewVM() - Create a machine to run m reading from in and writing to out
+func NewVM(m *Module, in io.Reader, out io.Writer) *VM {
+	return &VM{
+		m:       m,
+		in:      bufio.NewReader(in),
+		out:     bufio.NewWriter(out),
+		globals: make([]vmSlot, len(m.Globals)),
+	}
+}
+
+// Run() -	Execute the module from the start of the main program
+//			until it halts or a runtime error occurs
+func (this *VM) Run() (err error) {
+	defer func() {
+		if ferr := this.out.Flush(); err == nil {
+			err = ferr
+		}
+	}()
+
+	code := this.m.Code
+	this.frames = append(this.frames[:0], vmFrame{proc: 0, ret: -1})
+	frame := &this.frames[0]
+
+	for pc := this.m.Procs[0].Entry; ; {
+		op := Opcode(code[pc])
+		at := pc
+		pc += 1 + op.operandSize()
+
+		switch op {
+		case OpHalt:
+			return nil
+
+		case OpPushi:
+			this.push(vmValue{i: int64(binary.LittleEndian.Uint64(code[at+1:]))})
+		case OpPushr:
+			this.push(vmValue{r: math.Float64frombits(binary.LittleEndian.Uint64(code[at+1:]))})
+
+		case OpLoadg, OpLoadl:
+			slots, names := this.globals, this.m.Globals
+			if op == OpLoadl {
+				slots, names = frame.slots, this.m.Procs[frame.proc].SlotNames
+			}
+			n := this.m.operand(at)
+			if !slots[n].set {
+				return this.errorAt(at, "%s is used before it is assigned a value", names[n])
+			}
+			this.push(slots[n].vmValue)
+		case OpStoreg:
+			this.globals[this.m.operand(at)] = vmSlot{this.pop(), true}
+		case OpStorel:
+			frame.slots[this.m.operand(at)] = vmSlot{this.pop(), true}
+
+		case OpAddi, OpSubi, OpMuli, OpDivi:
+			y, x := this.pop().i, this.pop().i
+			if op == OpDivi && y == 0 {
+				return this.errorAt(at, "division by zero")
+			}
+			this.push(vmValue{i: int64(arith(arithops[op-OpAddi], int(x), int(y)))})
+		case OpAddr, OpSubr, OpMulr, OpDivr:
+			y, x := this.pop().r, this.pop().r
+			if op == OpDivr && y == 0 {
+				return this.errorAt(at, "division by zero")
+			}
+			this.push(vmValue{r: rarith(arithops[op-OpAddr], x, y)})
+		case OpNegi:
+			this.push(vmValue{i: int64(wrapInteger(int(-this.pop().i)))})
+		case OpNegr:
+			this.push(vmValue{r: -this.pop().r})
+		case OpItor:
+			this.push(vmValue{r: float64(this.pop().i)})
+
+		case OpEqi, OpGti, OpLti, OpNei:
+			y, x := this.pop().i, this.pop().i
+			this.push(truth(compare(relops[op-OpEqi], int(x), int(y))))
+		case OpEqr, OpGtr, OpLtr, OpNer:
+			y, x := this.pop().r, this.pop().r
+			this.push(truth(rcompare(relops[op-OpEqr], x, y)))
+
+		case OpJmp:
+			pc = this.m.operand(at)
+		case OpJmpf:
+			if this.pop().i == 0 {
+				pc = this.m.operand(at)
+			}
+		case OpJmpt:
+			if this.pop().i != 0 {
+				pc = this.m.operand(at)
+			}
+
+		case OpCall:
+			if len(this.frames) >= maxCallDepth {
+				return this.errorAt(at, "stack overflow")
+			}
+			n := this.m.operand(at)
+			p := &this.m.Procs[n]
+			callee := vmFrame{proc: n, ret: pc, slots: make([]vmSlot, len(p.SlotNames))}
+			//The arguments were pushed in order so the last is on top
+			for i := p.Params - 1; i >= 0; i-- {
+				callee.slots[i] = vmSlot{this.pop(), true}
+			}
+			this.frames = append(this.frames, callee)
+			frame = &this.frames[len(this.frames)-1]
+			pc = p.Entry
+		case OpRet:
+			pc = frame.ret
+			this.frames = this.frames[:len(this.frames)-1]
+			frame = &this.frames[len(this.frames)-1]
+
+		case OpReadi, OpReadr:
+			var word string
+			if _, err := fmt.Fscan(this.in, &word); err != nil {
+				return this.errorAt(at, "no input left to read")
+			}
+			var v vmValue
+			var err error
+			if op == OpReadi {
+				v.i, err = strconv.ParseInt(word, 10, 32)
+			} else {
+				v.r, err = strconv.ParseFloat(word, 64)
+			}
+			if err != nil {
+				return this.errorAt(at, "%q is not a valid number", word)
+			}
+			this.push(v)
+
+		case OpWritei:
+			this.out.WriteString(strconv.FormatInt(this.pop().i, 10))
+		case OpWriter:
+			this.out.WriteString(formatValue(Dtreal, cell{rval: this.pop().r}))
+		case OpWritesp:
+			this.out.WriteByte(' ')
+		case OpWriteln:
+			this.out.WriteByte('\n')
+
+		default:
+			return this.errorAt(at, "illegal instruction %s", op)
+		}
+	}
+}
+
+// The arithmetic and relational operators in the order of their opcodes
+var arithops = [...]TokenType{Tokplus, Tokminus, Tokstar, Tokslash}
+var relops = [...]TokenType{Tokequals, Tokgreater, Tokless, Toknotequal}
+
+func truth(b bool) vmValue {
+	if b {
+		return vmValue{i: 1}
+	}
+	return vmValue{}
+}
+
+func (this *VM) push(v vmValue) {
+	this.stack = append(this.stack, v)
+}
+
+func (this *VM) pop() vmValue {
+	v := this.stack[len(this.stack)-1]
+	this.stack = this.stack[:len(this.stack)-1]
+	return v
+}
+
+func (this *VM) errorAt(pc int, format string, args ...interface{}) error {
+	return &RuntimeError{Line: this.m.LineAt(pc), Msg: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,281 @@
+package pascomp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//////////////////////////WebAssembly Code Generator//////////////////////////
+//Translates a parsed Program into a WebAssembly text module.  The tree is
+//used rather than the quadruples since wasm only has structured control
+//flow: IF becomes if/else and the loops become a loop inside a block that
+//br_if leaves.  The program's variables are mutable globals, parameters
+//and locals are wasm locals; integers are i32 and reals f64.  The main
+//program is exported as "main" and reading, writing and runtime errors
+//are imported from the host under "japc" (see runtime/japcrt.js).
+
+// The wasm type of each data type and the suffix of its host functions
+var watTypes = map[DataType]string{Dtinteger: "i32", Dtreal: "f64"}
+var watSuffixes = map[DataType]string{Dtinteger: "int", Dtreal: "real"}
+
+type watGenerator struct {
+	st     *SymbolTable
+	w      *bufio.Writer
+	main   int
+	indent int
+}
+
+// The functions the host provides.  Reads take the line for error messages.
+const watImports = `  (import "japc" "write_int" (func $write_int (param i32)))
+  (import "japc" "write_real" (func $write_real (param f64)))
+  (import "japc" "write_char" (func $write_char (param i32)))
+  (import "japc" "read_int" (func $read_int (param i32) (result i32)))
+  (import "japc" "read_real" (func $read_real (param i32) (result f64)))
+  (import "japc" "divzero" (func $divzero (param i32)))
+`
+
+// Division checks for zero itself so the host can report the line
+const watDivide = `  (func $idiv (param $x i32) (param $y i32) (param $line i32) (result i32)
+    local.get $y
+    i32.eqz
+    if
+      local.get $line
+      call $divzero
+      unreachable
+    end
+    ;; i32.div_s traps on the one quotient too big to fit, which wraps
+    local.get $y
+    i32.const -1
+    i32.eq
+    if
+      i32.const 0
+      local.get $x
+      i32.sub
+      return
+    end
+    local.get $x
+    local.get $y
+    i32.div_s
+  )
+  (func $rdiv (param $x f64) (param $y f64) (param $line i32) (result f64)
+    local.get $y
+    f64.const 0
+    f64.eq
+    if
+      local.get $line
+      call $divzero
+      unreachable
+    end
+    local.get $x
+    local.get $y
+    f64.div
+  )
+`
+
+// GenerateWAT() - Write the program as a WebAssembly text module to w
+func GenerateWAT(prog *Program, w io.Writer) error {
+	this := &watGenerator{st: prog.St, w: bufio.NewWriter(w), main: prog.Name}
+
+	fmt.Fprintf(this.w, ";; %s - generated by JAPC\n(module\n", this.st.Getlexeme(prog.Name))
+	this.w.WriteString(watImports)
+	for _, v := range prog.Block.Vars {
+		t := this.typ(v)
+		fmt.Fprintf(this.w, "  (global $%s (mut %s) (%s.const 0))\n", this.st.Getlexeme(v), t, t)
+	}
+	this.w.WriteString(watDivide)
+
+	for _, proc := range prog.Block.Procs {
+		fmt.Fprintf(this.w, "  (func $%s", this.st.Getlexeme(proc.Index))
+		for _, p := range proc.Params {
+			fmt.Fprintf(this.w, " (param $%s %s)", this.st.Getlexeme(p), this.typ(p))
+		}
+		fmt.Fprintln(this.w)
+		for _, v := range proc.Block.Vars {
+			fmt.Fprintf(this.w, "    (local $%s %s)\n", this.st.Getlexeme(v), this.typ(v))
+		}
+		this.body(proc.Block.Body)
+	}
+
+	fmt.Fprintf(this.w, "  (func $main (export \"main\")\n")
+	this.body(prog.Block.Body)
+	fmt.Fprintln(this.w, ")")
+	return this.w.Flush()
+}
+
+func (this *watGenerator) body(stmts []Stmt) {
+	this.indent = 2
+	this.stmts(stmts)
+	fmt.Fprintln(this.w, "  )")
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Statements
+////////////////////////////////////////////////////////////////////
+
+func (this *watGenerator) stmts(stmts []Stmt) {
+	for _, stmt := range stmts {
+		this.stmt(stmt)
+	}
+}
+
+func (this *watGenerator) stmt(stmt Stmt) {
+	line := stmt.Position().Line
+
+	switch s := stmt.(type) {
+	case *SetStmt:
+		this.expr(s.Value)
+		this.set(s.Target)
+
+	case *ReadStmt:
+		for _, target := range s.Targets {
+			this.inst("i32.const %d", line)
+			this.inst("call $read_%s", watSuffixes[this.st.Getdatatype(target)])
+			this.set(target)
+		}
+
+	case *WriteStmt:
+		for i, value := range s.Values {
+			if i > 0 {
+				this.inst("i32.const 32")
+				this.inst("call $write_char")
+			}
+			this.expr(value)
+			this.inst("call $write_%s", watSuffixes[value.Type()])
+		}
+		this.inst("i32.const 10")
+		this.inst("call $write_char")
+
+	case *IfStmt:
+		this.cond(s.Cond)
+		this.inst("if")
+		this.block(s.Then)
+		if s.Else != nil {
+			this.inst("else")
+			this.block(s.Else)
+		}
+		this.inst("end")
+
+	case *WhileStmt, *UntilStmt:
+		//block/loop: br_if 1 leaves the loop and br 0 repeats it
+		cond, body, until := this.loopParts(stmt)
+		this.inst("block")
+		this.indent++
+		this.inst("loop")
+		this.indent++
+		this.cond(cond)
+		if !until {
+			this.inst("i32.eqz")
+		}
+		this.inst("br_if 1")
+		this.stmts(body)
+		this.inst("br 0")
+		this.indent--
+		this.inst("end")
+		this.indent--
+		this.inst("end")
+
+	case *CallStmt:
+		for _, arg := range s.Args {
+			this.expr(arg)
+		}
+		this.inst("call $%s", this.st.Getlexeme(s.Proc))
+	}
+}
+
+// loopParts() - The condition and body of a loop and whether it is an UNTIL
+func (this *watGenerator) loopParts(stmt Stmt) (*Cond, []Stmt, bool) {
+	if s, ok := stmt.(*UntilStmt); ok {
+		return s.Cond, s.Body, true
+	}
+	s := stmt.(*WhileStmt)
+	return s.Cond, s.Body, false
+}
+
+func (this *watGenerator) block(stmts []Stmt) {
+	this.indent++
+	this.stmts(stmts)
+	this.indent--
+}
+
+// cond() - Leave 1 on the stack if the condition holds and 0 if not
+func (this *watGenerator) cond(cond *Cond) {
+	this.expr(cond.Left)
+	this.expr(cond.Right)
+	t := this.exprType(cond.Left)
+	if t == "i32" {
+		this.inst("i32.%s", map[TokenType]string{Tokequals: "eq", Tokgreater: "gt_s", Tokless: "lt_s", Toknotequal: "ne"}[cond.Op])
+	} else {
+		this.inst("f64.%s", map[TokenType]string{Tokequals: "eq", Tokgreater: "gt", Tokless: "lt", Toknotequal: "ne"}[cond.Op])
+	}
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Expressions
+////////////////////////////////////////////////////////////////////
+
+func (this *watGenerator) expr(expr Expr) {
+	switch e := expr.(type) {
+	case *Ident:
+		this.inst("%s.get $%s", this.scope(e.Index), this.st.Getlexeme(e.Index))
+
+	case *Literal:
+		if e.Dt == Dtinteger {
+			this.inst("i32.const %d", int32(e.Ival))
+		} else {
+			this.inst("f64.const %s", strconv.FormatFloat(e.Rval, 'g', -1, 64))
+		}
+
+	case *Negate:
+		if e.Type() == Dtinteger {
+			this.inst("i32.const 0")
+			this.expr(e.X)
+			this.inst("i32.sub")
+		} else {
+			this.expr(e.X)
+			this.inst("f64.neg")
+		}
+
+	case *Float:
+		this.expr(e.X)
+		this.inst("f64.convert_i32_s")
+
+	case *Binary:
+		this.expr(e.Left)
+		this.expr(e.Right)
+		t := this.exprType(e)
+		if e.Op == Tokslash {
+			this.inst("i32.const %d", e.Line)
+			this.inst("call $%s", map[string]string{"i32": "idiv", "f64": "rdiv"}[t])
+			break
+		}
+		this.inst("%s.%s", t, map[TokenType]string{Tokplus: "add", Tokminus: "sub", Tokstar: "mul"}[e.Op])
+	}
+}
+
+// set() - Pop the top of the stack into a variable
+func (this *watGenerator) set(tabindex int) {
+	this.inst("%s.set $%s", this.scope(tabindex), this.st.Getlexeme(tabindex))
+}
+
+// scope() - Whether a variable is a wasm global or local
+func (this *watGenerator) scope(tabindex int) string {
+	if this.st.Getproc(tabindex) == this.main {
+		return "global"
+	}
+	return "local"
+}
+
+func (this *watGenerator) typ(tabindex int) string {
+	return watTypes[this.st.Getdatatype(tabindex)]
+}
+
+func (this *watGenerator) exprType(expr Expr) string {
+	return watTypes[expr.Type()]
+}
+
+func (this *watGenerator) inst(format string, args ...interface{}) {
+	fmt.Fprintf(this.w, strings.Repeat("  ", this.indent)+format+"\n", args...)
+}
@@ -0,0 +1,555 @@
+package pascomp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//////////////////////////x86 Floating Point//////////////////////////
+//Real quadruples for the x86 code generator.  The 16 and 32-bit targets
+//use the x87 stack, loading each operand and storing the result with fstp;
+//the 64-bit target uses SSE2 with the value in xmm0.  Real literals live
+//in .data under their _tN labels.  _writereal prints like C's %g (six
+//significant digits) so native output matches the interpreter.
+
+// The jump taken for each relational operator and for its negation after
+// a real comparison, which sets the flags like an unsigned one
+var x86RealJumps = map[TokenType][2]string{
+	Tokequals:   {"je", "jne"},
+	Tokgreater:  {"ja", "jbe"},
+	Tokless:     {"jb", "jae"},
+	Toknotequal: {"jne", "je"},
+}
+
+// isReal() - Whether a quadruple computes, compares or moves a real
+func (this *x86Generator) isReal(q Quad) bool {
+	switch q.Op {
+	case IrAssign, IrAdd, IrSub, IrMul, IrDiv, IrNeg, IrRead:
+		return this.st.Getdatatype(q.Result) == Dtreal
+	case IrIf, IrIffalse, IrWrite, IrParam:
+		return this.st.Getdatatype(q.Arg1) == Dtreal
+	case IrFloat:
+		return true
+	}
+	return false
+}
+
+// sse() - Whether reals are done with SSE2 rather than the x87
+func (this *x86Generator) sse() bool {
+	return this.target == X86Linux64
+}
+
+// realOperand() - The memory a real symbol or literal lives in
+func (this *x86Generator) realOperand(tabindex int) string {
+	return fmt.Sprintf("%s [%s]", this.r.real, this.addr(tabindex))
+}
+
+func (this *x86Generator) realQuad(q Quad) {
+	if this.sse() {
+		this.sseQuad(q)
+	} else {
+		this.x87Quad(q)
+	}
+}
+
+func (this *x86Generator) x87Quad(q Quad) {
+	r := this.r
+	switch q.Op {
+	case IrAssign:
+		this.op("fld", this.realOperand(q.Arg1))
+
+	case IrAdd, IrSub, IrMul, IrDiv:
+		if q.Op == IrDiv {
+			this.op("fld", this.realOperand(q.Arg2))
+			this.op("ftst")
+			this.op("fnstsw", "ax")
+			this.op("fstp", "st0")
+			this.op("sahf")
+			this.realDivzeroCheck(q.Line)
+		}
+		this.op("fld", this.realOperand(q.Arg1))
+		op := map[IrOp]string{IrAdd: "fadd", IrSub: "fsub", IrMul: "fmul", IrDiv: "fdiv"}[q.Op]
+		this.op(op, this.realOperand(q.Arg2))
+
+	case IrNeg:
+		this.op("fld", this.realOperand(q.Arg1))
+		this.op("fchs")
+
+	case IrFloat:
+		//fild needs its integer in memory
+		this.load(r.ax, q.Arg1)
+		this.op("mov", r.word+" [_itmp]", r.ax)
+		this.op("fild", r.word+" [_itmp]")
+
+	case IrIf, IrIffalse:
+		this.op("fld", this.realOperand(q.Arg2))
+		this.op("fld", this.realOperand(q.Arg1))
+		this.op("fcompp")
+		this.op("fnstsw", "ax")
+		this.op("sahf")
+		this.realJump(q)
+		return
+
+	case IrRead:
+		this.runtimeCall("_readreal")
+
+	case IrWrite:
+		this.op("fld", this.realOperand(q.Arg1))
+		this.runtimeCall("_writereal")
+		return
+
+	case IrParam:
+		//Push the high half first so the value is in order on the stack
+		addr := this.addr(q.Arg1)
+		this.op("push", fmt.Sprintf("%s [%s+%d]", r.word, addr, r.size))
+		this.op("push", fmt.Sprintf("%s [%s]", r.word, addr))
+		return
+	}
+	this.op("fstp", this.realOperand(q.Result))
+}
+
+func (this *x86Generator) sseQuad(q Quad) {
+	r := this.r
+	switch q.Op {
+	case IrAssign:
+		this.op("movsd", "xmm0", this.realOperand(q.Arg1))
+
+	case IrAdd, IrSub, IrMul, IrDiv:
+		if q.Op == IrDiv {
+			this.op("movsd", "xmm1", this.realOperand(q.Arg2))
+			this.op("xorpd", "xmm2", "xmm2")
+			this.op("ucomisd", "xmm1", "xmm2")
+			this.realDivzeroCheck(q.Line)
+		}
+		this.op("movsd", "xmm0", this.realOperand(q.Arg1))
+		op := map[IrOp]string{IrAdd: "addsd", IrSub: "subsd", IrMul: "mulsd", IrDiv: "divsd"}[q.Op]
+		this.op(op, "xmm0", this.realOperand(q.Arg2))
+
+	case IrNeg:
+		//Flip the sign bit
+		this.op("mov", r.ax, this.realOperand(q.Arg1))
+		this.op("btc", r.ax, "63")
+		this.op("movq", "xmm0", r.ax)
+
+	case IrFloat:
+		this.load(r.ax, q.Arg1)
+		this.op("cvtsi2sd", "xmm0", r.ax)
+
+	case IrIf, IrIffalse:
+		this.op("movsd", "xmm0", this.realOperand(q.Arg1))
+		this.op("ucomisd", "xmm0", this.realOperand(q.Arg2))
+		this.realJump(q)
+		return
+
+	case IrRead:
+		this.runtimeCall("_readreal")
+
+	case IrWrite:
+		this.op("movsd", "xmm0", this.realOperand(q.Arg1))
+		this.runtimeCall("_writereal")
+		return
+
+	case IrParam:
+		//A real takes two words; the value goes in the lower one
+		this.op("sub", r.sp, strconv.Itoa(r.size))
+		this.op("push", this.realOperand(q.Arg1))
+		return
+	}
+	this.op("movsd", this.realOperand(q.Result), "xmm0")
+}
+
+func (this *x86Generator) realJump(q Quad) {
+	jumps := x86RealJumps[q.Rel]
+	if q.Op == IrIf {
+		this.op(jumps[0], this.symbol(q.Result))
+	} else {
+		this.op(jumps[1], this.symbol(q.Result))
+	}
+}
+
+// realDivzeroCheck() -	Stop with a runtime error if the comparison
+//						just made found the divisor equal to zero
+func (this *x86Generator) realDivzeroCheck(line int) {
+	this.checks++
+	ok := "_nonzero" + strconv.Itoa(this.checks)
+	this.op("jne", ok)
+	this.op("mov", this.r.ax, strconv.Itoa(line))
+	this.op("jmp", "_divzero")
+	fmt.Fprintf(this.w, "%s:\n", ok)
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Runtime and Data
+////////////////////////////////////////////////////////////////////
+
+// realRuntime() -	_writereal and _readreal.  Reals are passed and
+//					returned on top of the x87 stack or in xmm0.
+func (this *x86Generator) realRuntime() {
+	r := this.r
+	real := func(label string) string { return r.real + " [" + label + "]" }
+	fe := r.word + " [_fe]"
+
+	//_writereal: scale the magnitude into [1e5, 1e6) counting the
+	//decimal exponent, round it to six digits and format those
+	fmt.Fprintln(this.w, "\n_writereal:")
+	if this.sse() {
+		this.op("xorpd", "xmm1", "xmm1")
+		this.op("ucomisd", "xmm0", "xmm1")
+		this.op("jae", ".pos")
+		this.op("movq", r.ax, "xmm0")
+		this.op("btc", r.ax, "63")
+		this.op("movq", "xmm0", r.ax)
+	} else {
+		this.op("ftst")
+		this.op("fnstsw", "ax")
+		this.op("sahf")
+		this.op("jae", ".pos")
+		this.op("fchs")
+	}
+	this.op("mov", "al", "'-'")
+	this.op("call", "_putchar")
+	fmt.Fprintln(this.w, ".pos:")
+	if this.sse() {
+		this.op("ucomisd", "xmm0", "xmm1")
+	} else {
+		this.op("ftst")
+		this.op("fnstsw", "ax")
+		this.op("sahf")
+	}
+	this.op("jne", ".nonzero")
+	if !this.sse() {
+		this.op("fstp", "st0")
+	}
+	this.op("mov", "al", "'0'")
+	this.op("jmp", "_putchar")
+	fmt.Fprintln(this.w, ".nonzero:")
+	this.op("mov", fe, "5")
+	fmt.Fprintln(this.w, ".big:")
+	this.realCompare(real("_c1e6"))
+	this.op("jb", ".small")
+	this.realArith("div", real("_c10"))
+	this.op("inc", fe)
+	this.op("jmp", ".big")
+	fmt.Fprintln(this.w, ".small:")
+	this.realCompare(real("_c1e5"))
+	this.op("jae", ".round")
+	this.realArith("mul", real("_c10"))
+	this.op("dec", fe)
+	this.op("jmp", ".small")
+	fmt.Fprintln(this.w, ".round:")
+	if this.sse() {
+		this.op("cvtsd2si", "eax", "xmm0")
+		this.op("mov", "[_fm]", "eax")
+	} else {
+		this.op("fistp", "dword [_fm]")
+	}
+	this.op("cmp", "dword [_fm]", "1000000")
+	this.op("jb", "_fmtreal")
+	this.op("mov", "dword [_fm]", "100000")
+	this.op("inc", fe)
+
+	this.fmtreal()
+	this.readreal()
+}
+
+// fmtreal() -	Print the six digit integer in _fm times 10 to the
+//				power _fe-5 the way %g does: trailing zeros dropped,
+//				exponent form below 1e-4 or from 1e6 up
+func (this *x86Generator) fmtreal() {
+	r := this.r
+	fe := r.word + " [_fe]"
+	digit := "[_fbuf+" + r.di + "]"
+
+	fmt.Fprintln(this.w, "\n_fmtreal:")
+	//The 16-bit target needs a 386 for these 32-bit registers
+	this.op("mov", "eax", "[_fm]")
+	this.op("mov", "ebx", "10")
+	this.op("mov", r.si, "_fbuf+5")
+	this.op("mov", r.cx, "6")
+	fmt.Fprintln(this.w, ".conv:")
+	this.op("xor", "edx", "edx")
+	this.op("div", "ebx")
+	this.op("add", "dl", "'0'")
+	this.op("mov", "["+r.si+"]", "dl")
+	this.op("dec", r.si)
+	this.op("loop", ".conv")
+
+	//bx counts the digits left once trailing zeros are dropped
+	this.op("mov", r.bx, "6")
+	fmt.Fprintln(this.w, ".trim:")
+	this.op("cmp", "byte [_fbuf-1+"+r.bx+"]", "'0'")
+	this.op("jne", ".trimmed")
+	this.op("dec", r.bx)
+	this.op("jmp", ".trim")
+	fmt.Fprintln(this.w, ".trimmed:")
+	this.op("mov", r.ax, fe)
+	this.op("cmp", r.ax, "-4")
+	this.op("jl", ".exp")
+	this.op("cmp", r.ax, "6")
+	this.op("jge", ".exp")
+	this.op("test", r.ax, r.ax)
+	this.op("js", ".fraction")
+
+	//At least one digit before the point, padded with zeros
+	this.op("xor", r.di, r.di)
+	fmt.Fprintln(this.w, ".fixed:")
+	this.op("mov", "al", "'0'")
+	this.op("cmp", r.di, r.bx)
+	this.op("jae", ".pad")
+	this.op("mov", "al", digit)
+	fmt.Fprintln(this.w, ".pad:")
+	this.op("call", "_putchar")
+	this.op("inc", r.di)
+	this.op("mov", r.ax, fe)
+	this.op("inc", r.ax)
+	this.op("cmp", r.di, r.ax)
+	this.op("jl", ".fixed")
+	this.op("jg", ".after")
+	this.op("cmp", r.di, r.bx)
+	this.op("jae", ".done")
+	this.op("mov", "al", "'.'")
+	this.op("call", "_putchar")
+	fmt.Fprintln(this.w, ".after:")
+	this.op("cmp", r.di, r.bx)
+	this.op("jb", ".fixed")
+	fmt.Fprintln(this.w, ".done:")
+	this.op("ret")
+
+	//0. and -e-1 zeros before the digits
+	fmt.Fprintln(this.w, ".fraction:")
+	this.op("mov", "al", "'0'")
+	this.op("call", "_putchar")
+	this.op("mov", "al", "'.'")
+	this.op("call", "_putchar")
+	this.op("mov", r.di, fe)
+	fmt.Fprintln(this.w, ".zeros:")
+	this.op("inc", r.di)
+	this.op("jz", ".digits")
+	this.op("mov", "al", "'0'")
+	this.op("call", "_putchar")
+	this.op("jmp", ".zeros")
+	fmt.Fprintln(this.w, ".digits:")
+	this.op("mov", "al", digit)
+	this.op("call", "_putchar")
+	this.op("inc", r.di)
+	this.op("cmp", r.di, r.bx)
+	this.op("jb", ".digits")
+	this.op("ret")
+
+	//d.ddddde+XX
+	fmt.Fprintln(this.w, ".exp:")
+	this.op("mov", "al", "[_fbuf]")
+	this.op("call", "_putchar")
+	this.op("mov", r.di, "1")
+	this.op("cmp", r.di, r.bx)
+	this.op("jae", ".e")
+	this.op("mov", "al", "'.'")
+	this.op("call", "_putchar")
+	fmt.Fprintln(this.w, ".mantissa:")
+	this.op("mov", "al", digit)
+	this.op("call", "_putchar")
+	this.op("inc", r.di)
+	this.op("cmp", r.di, r.bx)
+	this.op("jb", ".mantissa")
+	fmt.Fprintln(this.w, ".e:")
+	this.op("mov", "al", "'e'")
+	this.op("call", "_putchar")
+	this.op("mov", "al", "'+'")
+	this.op("cmp", fe, "0")
+	this.op("jge", ".sign")
+	this.op("neg", fe)
+	this.op("mov", "al", "'-'")
+	fmt.Fprintln(this.w, ".sign:")
+	this.op("call", "_putchar")
+	this.op("cmp", fe, "10")
+	this.op("jae", ".twodigits")
+	this.op("mov", "al", "'0'")
+	this.op("call", "_putchar")
+	fmt.Fprintln(this.w, ".twodigits:")
+	this.op("mov", r.ax, fe)
+	this.op("jmp", "_writeint")
+}
+
+// readreal() -	Skip white space and read [-]digits[.digits][e[+|-]digits]
+//				accumulating the digits as a whole number and counting
+//				in di the power of ten to scale it by
+func (this *x86Generator) readreal() {
+	r := this.r
+	rexp := r.word + " [_rexp]"
+
+	fmt.Fprintln(this.w, "\n_readreal:")
+	if this.sse() {
+		this.op("xorpd", "xmm0", "xmm0")
+	} else {
+		this.op("fldz")
+	}
+	this.op("xor", r.bx, r.bx) // 1 if negative
+	this.op("xor", r.si, r.si) // the number of digits
+	this.op("xor", r.di, r.di) // the power of ten
+	fmt.Fprintln(this.w, ".skip:")
+	this.op("call", "_getchar")
+	this.op("cmp", r.ax, "-1")
+	this.op("je", "_badinput")
+	this.op("cmp", r.ax, "' '")
+	this.op("jle", ".skip")
+	this.op("cmp", "al", "'-'")
+	this.op("jne", ".whole")
+	this.op("inc", r.bx)
+	this.op("call", "_getchar")
+	fmt.Fprintln(this.w, ".whole:")
+	this.op("sub", r.ax, "'0'")
+	this.op("cmp", r.ax, "9")
+	this.op("ja", ".point")
+	this.readDigit()
+	this.op("call", "_getchar")
+	this.op("jmp", ".whole")
+	fmt.Fprintln(this.w, ".point:")
+	this.op("cmp", r.ax, "'.'-'0'")
+	this.op("jne", ".mantissa")
+	fmt.Fprintln(this.w, ".fraction:")
+	this.op("call", "_getchar")
+	this.op("sub", r.ax, "'0'")
+	this.op("cmp", r.ax, "9")
+	this.op("ja", ".mantissa")
+	this.readDigit()
+	this.op("dec", r.di)
+	this.op("jmp", ".fraction")
+	fmt.Fprintln(this.w, ".mantissa:")
+	this.op("test", r.si, r.si)
+	this.op("jz", "_badinput")
+	this.op("cmp", r.ax, "'e'-'0'")
+	this.op("je", ".exp")
+	this.op("cmp", r.ax, "'E'-'0'")
+	this.op("jne", ".scale")
+
+	//The exponent is added to di; bx is borrowed for its sign
+	fmt.Fprintln(this.w, ".exp:")
+	this.op("push", r.bx)
+	this.op("xor", r.bx, r.bx)
+	this.op("mov", rexp, "0")
+	this.op("call", "_getchar")
+	this.op("cmp", "al", "'+'")
+	this.op("je", ".esign")
+	this.op("cmp", "al", "'-'")
+	this.op("jne", ".efirst")
+	this.op("inc", r.bx)
+	fmt.Fprintln(this.w, ".esign:")
+	this.op("call", "_getchar")
+	fmt.Fprintln(this.w, ".efirst:")
+	this.op("sub", r.ax, "'0'")
+	this.op("cmp", r.ax, "9")
+	this.op("ja", "_badinput")
+	fmt.Fprintln(this.w, ".edigit:")
+	this.op("imul", r.cx, rexp, "10")
+	this.op("add", r.cx, r.ax)
+	this.op("mov", rexp, r.cx)
+	this.op("call", "_getchar")
+	this.op("sub", r.ax, "'0'")
+	this.op("cmp", r.ax, "9")
+	this.op("jbe", ".edigit")
+	this.op("mov", r.ax, rexp)
+	this.op("test", r.bx, r.bx)
+	this.op("jz", ".eadd")
+	this.op("neg", r.ax)
+	fmt.Fprintln(this.w, ".eadd:")
+	this.op("add", r.di, r.ax)
+	this.op("pop", r.bx)
+
+	fmt.Fprintln(this.w, ".scale:")
+	this.op("test", r.di, r.di)
+	this.op("jle", ".down")
+	this.realArith("mul", r.real+" [_c10]")
+	this.op("dec", r.di)
+	this.op("jmp", ".scale")
+	fmt.Fprintln(this.w, ".down:")
+	this.op("test", r.di, r.di)
+	this.op("jge", ".sign")
+	this.realArith("div", r.real+" [_c10]")
+	this.op("inc", r.di)
+	this.op("jmp", ".down")
+	fmt.Fprintln(this.w, ".sign:")
+	this.op("test", r.bx, r.bx)
+	this.op("jz", ".done")
+	if this.sse() {
+		this.op("movq", r.ax, "xmm0")
+		this.op("btc", r.ax, "63")
+		this.op("movq", "xmm0", r.ax)
+	} else {
+		this.op("fchs")
+	}
+	fmt.Fprintln(this.w, ".done:")
+	this.op("ret")
+}
+
+// readDigit() - Multiply the value read so far by ten and add the digit in ax
+func (this *x86Generator) readDigit() {
+	r := this.r
+	if this.sse() {
+		this.op("mulsd", "xmm0", r.real+" [_c10]")
+		this.op("cvtsi2sd", "xmm1", r.ax)
+		this.op("addsd", "xmm0", "xmm1")
+	} else {
+		this.op("mov", r.word+" [_itmp]", r.ax)
+		this.op("fmul", r.real+" [_c10]")
+		this.op("fiadd", r.word+" [_itmp]")
+	}
+	this.op("inc", r.si)
+}
+
+// realCompare() - Compare the value being worked on with a real in memory
+func (this *x86Generator) realCompare(operand string) {
+	if this.sse() {
+		this.op("ucomisd", "xmm0", operand)
+		return
+	}
+	this.op("fcom", operand)
+	this.op("fnstsw", "ax")
+	this.op("sahf")
+}
+
+// realArith() - Apply mul or div by a real in memory to the value being worked on
+func (this *x86Generator) realArith(op, operand string) {
+	if this.sse() {
+		this.op(op+"sd", "xmm0", operand)
+	} else {
+		this.op("f"+op, operand)
+	}
+}
+
+// realLiterals() - Every real literal in the attribute table
+func (this *x86Generator) realLiterals() (list []int) {
+	for i := 0; i < this.st.attribTabLen; i++ {
+		if this.st.Getsmclass(i) == Stliteral && this.st.Getdatatype(i) == Dtreal {
+			list = append(list, i)
+		}
+	}
+	return
+}
+
+// realData() - The constants the runtime uses and the program's real literals
+func (this *x86Generator) realData() {
+	def := this.r.define
+	fmt.Fprintf(this.w, "_c10:\t%s 10.0\n", def)
+	fmt.Fprintf(this.w, "_c1e5:\t%s 1.0e5\n", def)
+	fmt.Fprintf(this.w, "_c1e6:\t%s 1.0e6\n", def)
+	for _, n := range this.realLiterals() {
+		v, _ := strconv.ParseFloat(this.st.Getlexeme(n), 64)
+		//NASM needs the point to know it is not an integer
+		text := strconv.FormatFloat(v, 'e', -1, 64)
+		if !strings.Contains(text, ".") {
+			text = strings.Replace(text, "e", ".0e", 1)
+		}
+		fmt.Fprintf(this.w, "%s:\t%s %s\t; %s\n", this.symbol(n), def, text, this.st.Getlexeme(n))
+	}
+}
+
+// realBss() - Scratch memory for the real runtime
+func (this *x86Generator) realBss() {
+	reserve := x86Reserve[this.r.size]
+	fmt.Fprintf(this.w, "_itmp:\t%s 1\n", reserve)
+	fmt.Fprintf(this.w, "_rexp:\t%s 1\n", reserve)
+	fmt.Fprintf(this.w, "_fe:\t%s 1\n", reserve)
+	fmt.Fprintf(this.w, "_fm:\tresd 1\n")
+	fmt.Fprintf(this.w, "_fbuf:\tresb 6\n")
+}
@@ -0,0 +1,631 @@
+package pascomp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//////////////////////////x86 Code Generator//////////////////////////
+//Translates the quadruples into NASM assembly.  Parameters, locals and
+//temporaries of a procedure use the [bp+N] / [bp-N] labels labelscope
+//gives them, scaled to the target's word size; the program's variables
+//and temporaries are labelled memory in .bss.  Every quadruple is done
+//through the accumulator, cx and dx; integer temporaries and locals are
+//kept in the registers regalloc.go assigns them wherever it can, which a
+//procedure saves on entry and every call to the runtime preserves.
+//A small runtime for reading and writing integers is appended.  Reals are
+//handled in x86float.go.  Integers are the target's word, so unlike the
+//other targets, which wrap around at 32 bits, they wrap at 16 bits for DOS
+//and 64 bits for x86-64.
+
+type X86Target int
+
+const (
+	X86Dos16   X86Target = 16 // a DOS .COM file using int 21h
+	X86Linux32 X86Target = 32 // an i386 ELF executable using int 80h
+	X86Linux64 X86Target = 64 // an x86-64 ELF executable using syscall
+)
+
+// The registers and operand size names for each target.  Reals are
+// single precision on the 16-bit target where labelscope gives them
+// 4 bytes and double precision elsewhere.
+type x86Regs struct {
+	ax, bx, cx, dx, si, di, bp, sp string
+	word, cwd                      string
+	size                           int
+	real, define                   string
+	realsize                       int
+}
+
+var x86RegSets = map[X86Target]x86Regs{
+	X86Dos16:   {"ax", "bx", "cx", "dx", "si", "di", "bp", "sp", "word", "cwd", 2, "dword", "dd", 4},
+	X86Linux32: {"eax", "ebx", "ecx", "edx", "esi", "edi", "ebp", "esp", "dword", "cdq", 4, "qword", "dq", 8},
+	X86Linux64: {"rax", "rbx", "rcx", "rdx", "rsi", "rdi", "rbp", "rsp", "qword", "cqo", 8, "qword", "dq", 8},
+}
+
+// The registers the allocator may assign.  The quadruples only use the
+// accumulator, cx and dx themselves.
+var x86Allocatable = map[X86Target][]string{
+	X86Dos16:   {"bx", "si", "di"},
+	X86Linux32: {"ebx", "esi", "edi"},
+	X86Linux64: {"rbx", "rsi", "rdi", "r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15"},
+}
+
+// The reservation directive for each size of variable
+var x86Reserve = map[int]string{2: "resw", 4: "resd", 8: "resq"}
+
+// The jump taken for each relational operator and for its negation
+var x86Jumps = map[TokenType][2]string{
+	Tokequals:   {"je", "jne"},
+	Tokgreater:  {"jg", "jle"},
+	Tokless:     {"jl", "jge"},
+	Toknotequal: {"jne", "je"},
+}
+
+type x86Generator struct {
+	ir     *IrProgram
+	st     *SymbolTable
+	target X86Target
+	r      x86Regs
+	w      *bufio.Writer
+	main   int  // the program's attribute table index
+	checks int  // the number of division checks emitted so far
+	reals  bool // whether the real runtime is needed
+
+	// The registers assigned in the current procedure, the ones
+	// it saves on entry and the quadruple being generated
+	intervals []*liveInterval
+	regs      map[int]string
+	saved     []string
+	pos       int
+}
+
+// GenerateX86() -	Write NASM assembly for the program to w
+func GenerateX86(ir *IrProgram, target X86Target, w io.Writer) error {
+	regs, ok := x86RegSets[target]
+	if !ok {
+		return fmt.Errorf("unknown x86 target %d", target)
+	}
+	this := &x86Generator{
+		ir:     ir,
+		st:     ir.St,
+		target: target,
+		r:      regs,
+		w:      bufio.NewWriter(w),
+		main:   ir.Procs[0].Index,
+	}
+	this.reals = len(this.realLiterals()) > 0
+	for _, p := range ir.Procs {
+		for _, list := range [][]int{p.Params, p.Vars, p.Temps} {
+			for _, n := range list {
+				this.reals = this.reals || this.st.Getdatatype(n) == Dtreal
+			}
+		}
+	}
+
+	this.header()
+	for _, p := range ir.Procs {
+		this.proc(p)
+	}
+	this.runtime()
+	if this.reals {
+		this.realRuntime()
+	}
+	this.data()
+	return this.w.Flush()
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Procedures
+////////////////////////////////////////////////////////////////////
+
+func (this *x86Generator) header() {
+	fmt.Fprintf(this.w, "; %s - generated by JAPC for %s\n",
+		this.st.Getlexeme(this.main), map[X86Target]string{
+			X86Dos16:   "16-bit DOS (nasm -f bin -o prog.com)",
+			X86Linux32: "32-bit Linux (nasm -f elf32; ld -m elf_i386)",
+			X86Linux64: "64-bit Linux (nasm -f elf64; ld)",
+		}[this.target])
+
+	switch this.target {
+	case X86Dos16:
+		this.line("bits 16")
+		this.line("org 100h")
+		this.line("section .text")
+	case X86Linux64:
+		this.line("bits 64")
+		this.line("default rel")
+		this.line("section .text")
+		this.line("global _start")
+		fmt.Fprintln(this.w, "_start:")
+	default:
+		this.line("bits 32")
+		this.line("section .text")
+		this.line("global _start")
+		fmt.Fprintln(this.w, "_start:")
+	}
+}
+
+func (this *x86Generator) proc(p *IrProc) {
+	r := this.r
+	this.intervals = allocateRegisters(this.st, p, this.main, x86Allocatable[this.target])
+	this.regs = make(map[int]string)
+	for _, iv := range this.intervals {
+		this.regs[iv.sym] = iv.reg
+	}
+	this.saved = this.registers(func(*liveInterval) bool { return true })
+
+	fmt.Fprintln(this.w)
+	for _, iv := range this.intervals {
+		fmt.Fprintf(this.w, "; %s in %s\n", this.ir.Operand(iv.sym), iv.reg)
+	}
+	if p.Index == this.main {
+		//The program's variables are global so it needs no frame
+		fmt.Fprintf(this.w, "%s:\n", this.symbol(p.Index))
+	} else {
+		locals := this.st.labelscope(p.Index) * r.size / 2
+		fmt.Fprintf(this.w, "%s:\n", this.symbol(p.Index))
+		this.op("push", r.bp)
+		this.op("mov", r.bp, r.sp)
+		if locals > 0 {
+			this.op("sub", r.sp, strconv.Itoa(locals))
+		}
+		for _, reg := range this.saved {
+			this.op("push", reg)
+		}
+	}
+
+	for i, q := range p.Code {
+		this.pos = i
+		this.quad(p, q)
+	}
+}
+
+func (this *x86Generator) quad(p *IrProc, q Quad) {
+	r := this.r
+	if this.isReal(q) {
+		this.realQuad(q)
+		return
+	}
+
+	switch q.Op {
+	case IrAssign:
+		this.load(r.ax, q.Arg1)
+		this.store(q.Result)
+
+	case IrAdd, IrSub:
+		this.load(r.ax, q.Arg1)
+		this.op(map[IrOp]string{IrAdd: "add", IrSub: "sub"}[q.Op], r.ax, this.source(q.Arg2))
+		this.store(q.Result)
+
+	case IrMul:
+		this.load(r.ax, q.Arg1)
+		this.load(r.cx, q.Arg2)
+		this.op("imul", r.ax, r.cx)
+		this.store(q.Result)
+
+	case IrDiv:
+		this.load(r.ax, q.Arg1)
+		this.load(r.cx, q.Arg2)
+		this.divzeroCheck(q.Line)
+		this.op(r.cwd)
+		this.op("idiv", r.cx)
+		this.store(q.Result)
+
+	case IrNeg:
+		this.load(r.ax, q.Arg1)
+		this.op("neg", r.ax)
+		this.store(q.Result)
+
+	case IrLabel:
+		fmt.Fprintf(this.w, "%s:\n", this.symbol(q.Result))
+
+	case IrGoto:
+		this.op("jmp", this.symbol(q.Result))
+
+	case IrIf, IrIffalse:
+		this.load(r.ax, q.Arg1)
+		this.op("cmp", r.ax, this.source(q.Arg2))
+		jumps := x86Jumps[q.Rel]
+		if q.Op == IrIf {
+			this.op(jumps[0], this.symbol(q.Result))
+		} else {
+			this.op(jumps[1], this.symbol(q.Result))
+		}
+
+	case IrRead:
+		this.runtimeCall("_readint")
+		this.store(q.Result)
+
+	case IrWrite:
+		this.load(r.ax, q.Arg1)
+		this.runtimeCall("_writeint")
+
+	case IrWritesp, IrWriteln:
+		char := "' '"
+		if q.Op == IrWriteln {
+			char = "10"
+		}
+		this.op("mov", "al", char)
+		this.runtimeCall("_putchar")
+
+	case IrParam:
+		this.op("push", this.source(q.Arg1))
+
+	case IrCall:
+		this.op("call", this.symbol(q.Arg1))
+		//Reals take two of labelscope's words on the stack
+		bytes := 0
+		for param := this.st.Getivalue(q.Arg1); param != 0; param = this.st.Getivalue(param) {
+			bytes += r.size
+			if this.st.Getdatatype(param) == Dtreal {
+				bytes += r.size
+			}
+		}
+		if bytes > 0 {
+			this.op("add", r.sp, strconv.Itoa(bytes))
+		}
+
+	case IrReturn:
+		if p.Index == this.main {
+			this.op("jmp", "_exit")
+		} else {
+			for i := len(this.saved) - 1; i >= 0; i-- {
+				this.op("pop", this.saved[i])
+			}
+			this.op("mov", r.sp, r.bp)
+			this.op("pop", r.bp)
+			this.op("ret")
+		}
+
+	default:
+		panic(fmt.Sprintf("x86: cannot generate %s", q.Op))
+	}
+}
+
+// runtimeCall() -	Call a runtime routine, which may use any register,
+//					keeping the values still needed afterwards
+func (this *x86Generator) runtimeCall(routine string) {
+	live := this.registers(func(iv *liveInterval) bool { return iv.live(this.pos) })
+	for _, reg := range live {
+		this.op("push", reg)
+	}
+	this.op("call", routine)
+	for i := len(live) - 1; i >= 0; i-- {
+		this.op("pop", live[i])
+	}
+}
+
+// registers() -	The registers of the intervals chosen, each once and
+//					in the order they are allocated
+func (this *x86Generator) registers(chosen func(*liveInterval) bool) (list []string) {
+	for _, reg := range x86Allocatable[this.target] {
+		for _, iv := range this.intervals {
+			if iv.reg == reg && chosen(iv) {
+				list = append(list, reg)
+				break
+			}
+		}
+	}
+	return
+}
+
+// divzeroCheck() - Stop with a runtime error if cx is zero
+func (this *x86Generator) divzeroCheck(line int) {
+	r := this.r
+	this.checks++
+	ok := "_nonzero" + strconv.Itoa(this.checks)
+	this.op("test", r.cx, r.cx)
+	this.op("jnz", ok)
+	this.op("mov", r.ax, strconv.Itoa(line))
+	this.op("jmp", "_divzero")
+	fmt.Fprintf(this.w, "%s:\n", ok)
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Operands
+////////////////////////////////////////////////////////////////////
+
+func (this *x86Generator) load(reg string, tabindex int) {
+	this.op("mov", reg, this.operand(tabindex))
+}
+
+func (this *x86Generator) store(tabindex int) {
+	this.op("mov", this.operand(tabindex), this.r.ax)
+}
+
+// source() -	An operand for instructions that only take a 32-bit
+//				immediate; larger literals are loaded into cx first
+func (this *x86Generator) source(tabindex int) string {
+	if this.st.Getsmclass(tabindex) == Stliteral {
+		if v := this.st.Getivalue(tabindex); v != int(int32(v)) {
+			this.load(this.r.cx, tabindex)
+			return this.r.cx
+		}
+	}
+	return this.operand(tabindex)
+}
+
+// operand() -	An integer literal as an immediate, a symbol in a
+//				register as that register and anything else as the
+//				memory it lives in
+func (this *x86Generator) operand(tabindex int) string {
+	if reg, ok := this.regs[tabindex]; ok {
+		return reg
+	}
+	if this.st.Getsmclass(tabindex) == Stliteral {
+		return strconv.Itoa(this.st.Getivalue(tabindex))
+	}
+	return fmt.Sprintf("%s [%s]", this.r.word, this.addr(tabindex))
+}
+
+// addr() -	The address of a symbol's memory: a frame offset for
+//			procedures' symbols and a label for everything else
+func (this *x86Generator) addr(tabindex int) string {
+	if this.st.Getsmclass(tabindex) == Stliteral || this.st.Getproc(tabindex) == this.main {
+		return this.symbol(tabindex)
+	}
+	return this.frameOffset(tabindex)
+}
+
+// frameOffset() -	Convert the 16-bit [bp+N] label labelscope gave
+//					a symbol to the target's frame pointer and words
+func (this *x86Generator) frameOffset(tabindex int) string {
+	label := this.st.Getlabelname(tabindex)
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(label, "[bp"), "]"))
+	if err != nil {
+		panic(fmt.Sprintf("x86: %s has no frame label", this.st.Getlexeme(tabindex)))
+	}
+	n = n * this.r.size / 2
+	if n < 0 {
+		return fmt.Sprintf("%s-%d", this.r.bp, -n)
+	}
+	return fmt.Sprintf("%s+%d", this.r.bp, n)
+}
+
+// symbol() -	The assembler symbol for a label, procedure or global.
+//				The $ prefix lets names like AX be used as symbols.
+//				Named symbols are numbered by their entries after an
+//				underscore no identifier can hold, since a procedure
+//				may share the program's name and a long name's label
+//				is cut short.
+func (this *x86Generator) symbol(tabindex int) string {
+	switch this.st.Getsmclass(tabindex) {
+	case Stprogram, Stprocedure, Stvariable:
+		return fmt.Sprintf("$%s_%d", this.st.Getlexeme(tabindex), tabindex)
+	}
+	return "$" + this.st.Getlabelname(tabindex)
+}
+
+////////////////////////////////////////////////////////////////////
+//Mark: Runtime and Data
+////////////////////////////////////////////////////////////////////
+
+// runtime() -	The routines every program uses.  Integers are passed
+//				and returned in the accumulator and characters in al.
+func (this *x86Generator) runtime() {
+	r := this.r
+	fmt.Fprintf(this.w, "\n; ---- runtime ----\n")
+
+	//_writeint: print the accumulator as a signed decimal
+	fmt.Fprintln(this.w, "_writeint:")
+	this.op("test", r.ax, r.ax)
+	this.op("jns", ".pos")
+	this.op("push", r.ax)
+	this.op("mov", "al", "'-'")
+	this.op("call", "_putchar")
+	this.op("pop", r.ax)
+	this.op("neg", r.ax)
+	fmt.Fprintln(this.w, ".pos:")
+	this.op("mov", r.bx, "10")
+	this.op("xor", r.cx, r.cx)
+	fmt.Fprintln(this.w, ".digit:")
+	this.op("xor", r.dx, r.dx)
+	this.op("div", r.bx)
+	this.op("push", r.dx)
+	this.op("inc", r.cx)
+	this.op("test", r.ax, r.ax)
+	this.op("jnz", ".digit")
+	fmt.Fprintln(this.w, ".print:")
+	this.op("pop", r.ax)
+	this.op("add", "al", "'0'")
+	this.op("push", r.cx)
+	this.op("call", "_putchar")
+	this.op("pop", r.cx)
+	this.op("loop", ".print")
+	this.op("ret")
+
+	//_readint: skip white space and read a signed decimal
+	fmt.Fprintln(this.w, "\n_readint:")
+	this.op("xor", r.di, r.di) // the value
+	this.op("xor", r.bx, r.bx) // 1 if negative
+	fmt.Fprintln(this.w, ".skip:")
+	this.op("call", "_getchar")
+	this.op("cmp", r.ax, "-1")
+	this.op("je", "_badinput")
+	this.op("cmp", r.ax, "' '")
+	this.op("jle", ".skip")
+	this.op("cmp", "al", "'-'")
+	this.op("jne", ".first")
+	this.op("inc", r.bx)
+	this.op("call", "_getchar")
+	fmt.Fprintln(this.w, ".first:")
+	this.op("sub", r.ax, "'0'")
+	this.op("cmp", r.ax, "9")
+	this.op("ja", "_badinput")
+	fmt.Fprintln(this.w, ".next:")
+	this.op("imul", r.di, r.di, "10")
+	this.op("add", r.di, r.ax)
+	this.op("call", "_getchar")
+	this.op("sub", r.ax, "'0'")
+	this.op("cmp", r.ax, "9")
+	this.op("jbe", ".next")
+	this.op("mov", r.ax, r.di)
+	this.op("test", r.bx, r.bx)
+	this.op("jz", ".done")
+	this.op("neg", r.ax)
+	fmt.Fprintln(this.w, ".done:")
+	this.op("ret")
+
+	//Runtime errors print a message and stop with exit status 1
+	fmt.Fprintln(this.w, "\n_divzero:")
+	this.op("push", r.ax)
+	this.op("mov", r.si, "_msgdiv")
+	this.op("call", "_puts")
+	this.op("pop", r.ax)
+	this.op("call", "_writeint")
+	this.op("mov", "al", "10")
+	this.op("call", "_putchar")
+	this.op("jmp", "_fail")
+	fmt.Fprintln(this.w, "_badinput:")
+	this.op("mov", r.si, "_msginput")
+	this.op("call", "_puts")
+	fmt.Fprintln(this.w, "_fail:")
+	this.op("mov", "al", "1")
+	this.op("jmp", "_exitcode")
+
+	//_puts: print the zero terminated string at si
+	fmt.Fprintln(this.w, "\n_puts:")
+	this.op("mov", "al", "["+r.si+"]")
+	this.op("test", "al", "al")
+	this.op("jz", ".end")
+	this.op("push", r.si)
+	this.op("call", "_putchar")
+	this.op("pop", r.si)
+	this.op("inc", r.si)
+	this.op("jmp", "_puts")
+	fmt.Fprintln(this.w, ".end:")
+	this.op("ret")
+
+	this.system()
+}
+
+// system() -	Character I/O and exit for the target operating system.
+//				_getchar returns -1 in the accumulator at end of file.
+func (this *x86Generator) system() {
+	r := this.r
+	fmt.Fprintln(this.w, "\n_exit:")
+	this.op("xor", "al", "al")
+	fmt.Fprintln(this.w, "_exitcode:")
+
+	switch this.target {
+	case X86Dos16:
+		this.op("mov", "ah", "4ch")
+		this.op("int", "21h")
+		fmt.Fprintln(this.w, "\n_putchar:")
+		this.op("mov", "dl", "al")
+		this.op("mov", "ah", "2")
+		this.op("int", "21h")
+		this.op("ret")
+		fmt.Fprintln(this.w, "\n_getchar:")
+		this.op("push", "bx")
+		this.op("mov", "ah", "3fh")
+		this.op("xor", "bx", "bx")
+		this.op("mov", "cx", "1")
+		this.op("mov", "dx", "_char")
+		this.op("int", "21h")
+		this.op("pop", "bx")
+
+	case X86Linux32:
+		this.op("movzx", "ebx", "al")
+		this.op("mov", "eax", "1")
+		this.op("int", "80h")
+		fmt.Fprintln(this.w, "\n_putchar:")
+		this.op("push", "ebx")
+		this.op("mov", "[_char]", "al")
+		this.op("mov", "eax", "4")
+		this.op("mov", "ebx", "1")
+		this.op("mov", "ecx", "_char")
+		this.op("mov", "edx", "1")
+		this.op("int", "80h")
+		this.op("pop", "ebx")
+		this.op("ret")
+		fmt.Fprintln(this.w, "\n_getchar:")
+		this.op("push", "ebx")
+		this.op("mov", "eax", "3")
+		this.op("xor", "ebx", "ebx")
+		this.op("mov", "ecx", "_char")
+		this.op("mov", "edx", "1")
+		this.op("int", "80h")
+		this.op("pop", "ebx")
+
+	case X86Linux64:
+		this.op("movzx", "edi", "al")
+		this.op("mov", "eax", "60")
+		this.op("syscall")
+		fmt.Fprintln(this.w, "\n_putchar:")
+		this.op("push", "rdi")
+		this.op("push", "rsi")
+		this.op("mov", "[rel _char]", "al")
+		this.op("mov", "eax", "1")
+		this.op("mov", "edi", "1")
+		this.op("lea", "rsi", "[rel _char]")
+		this.op("mov", "edx", "1")
+		this.op("syscall")
+		this.op("pop", "rsi")
+		this.op("pop", "rdi")
+		this.op("ret")
+		fmt.Fprintln(this.w, "\n_getchar:")
+		this.op("push", "rdi")
+		this.op("push", "rsi")
+		this.op("xor", "eax", "eax")
+		this.op("xor", "edi", "edi")
+		this.op("lea", "rsi", "[rel _char]")
+		this.op("mov", "edx", "1")
+		this.op("syscall")
+		this.op("pop", "rsi")
+		this.op("pop", "rdi")
+	}
+
+	//Both system calls return the number of bytes read in the accumulator
+	this.op("cmp", r.ax, "1")
+	this.op("jne", ".eof")
+	this.op("movzx", r.ax, "byte [_char]")
+	this.op("ret")
+	fmt.Fprintln(this.w, ".eof:")
+	this.op("mov", r.ax, "-1")
+	this.op("ret")
+}
+
+// data() - The program's variables and temporaries and the messages
+func (this *x86Generator) data() {
+	fmt.Fprintf(this.w, "\nsection .data\n")
+	fmt.Fprintf(this.w, "_msgdiv:\tdb \"runtime error: division by zero on line #\", 0\n")
+	fmt.Fprintf(this.w, "_msginput:\tdb \"runtime error: invalid input\", 10, 0\n")
+
+	if this.reals {
+		this.realData()
+	}
+
+	fmt.Fprintf(this.w, "\nsection .bss\n")
+	fmt.Fprintf(this.w, "_char:\tresb 1\n")
+	main := this.ir.Procs[0]
+	for _, list := range [][]int{main.Vars, main.Temps} {
+		for _, n := range list {
+			size := this.r.size
+			if this.st.Getdatatype(n) == Dtreal {
+				size = this.r.realsize
+			}
+			fmt.Fprintf(this.w, "%s:\t%s 1\n", this.symbol(n), x86Reserve[size])
+		}
+	}
+	if this.reals {
+		this.realBss()
+	}
+}
+
+// op() - Write one instruction with its operands
+func (this *x86Generator) op(mnemonic string, operands ...string) {
+	if len(operands) == 0 {
+		this.line("%s", mnemonic)
+		return
+	}
+	this.line("%-7s %s", mnemonic, strings.Join(operands, ", "))
+}
+
+func (this *x86Generator) line(format string, args ...interface{}) {
+	fmt.Fprintf(this.w, "\t"+format+"\n", args...)
+}
@@ -0,0 +1,81 @@
+package pascomp
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	x86LabelDef  = regexp.MustCompile(`^([\w$][\w$.]*):`) // not local labels, which start with .
+	x86LabelUse  = regexp.MustCompile(`^\s+(?:call|jmp|j[a-z]+)\s+(\$[\w.]+)$`)
+	x86Colliding = []struct{ name, source string }{
+		{"program and procedure", `PROGRAM Main;
+	DECLARE INTEGER n;
+	PROCEDURE main PARAMETERS INTEGER k;
+	BEGIN
+		WRITE k
+	END;
+	BEGIN
+		SET n = 3;
+		CALL main(n)
+	END.
+`},
+		{"long names", `PROGRAM Longnames;
+	DECLARE INTEGER Counterfirst, Countersecond;
+	PROCEDURE Calculatearea;
+	BEGIN
+		WRITE 1
+	END;
+	PROCEDURE Calculateaverage;
+	BEGIN
+		WRITE 2
+	END;
+	BEGIN
+		SET Counterfirst = 1;
+		SET Countersecond = Counterfirst + 1;
+		WRITE Countersecond;
+		CALL Calculatearea;
+		CALL Calculateaverage
+	END.
+`},
+		{"sample", factProgram},
+	}
+)
+
+func TestX86Symbols(t *testing.T) {
+	for _, test := range x86Colliding {
+		for _, target := range []X86Target{X86Dos16, X86Linux32, X86Linux64} {
+			var out bytes.Buffer
+			if err := GenerateX86(GenerateIR(parseSource(t, test.source)), target, &out); err != nil {
+				t.Fatal(err)
+			}
+			asm := out.String()
+
+			defined := make(map[string]bool)
+			for _, line := range strings.Split(asm, "\n") {
+				if m := x86LabelDef.FindStringSubmatch(line); m != nil {
+					if defined[m[1]] {
+						t.Errorf("%s for x86-%d: %s is defined twice:\n%s", test.name, target, m[1], asm)
+					}
+					defined[m[1]] = true
+				}
+			}
+			calls := 0
+			for _, line := range strings.Split(asm, "\n") {
+				if m := x86LabelUse.FindStringSubmatch(line); m != nil {
+					if !defined[m[1]] {
+						t.Errorf("%s for x86-%d: %s is used but never defined", test.name, target, m[1])
+					}
+					if strings.Contains(line, "call") {
+						calls++
+					}
+				}
+			}
+			if calls == 0 {
+				t.Errorf("%s for x86-%d: no calls found in\n%s", test.name, target, asm)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * japcrt.c - the runtime for programs compiled to LLVM IR by JAPC.
+ *
+ * Values print and parse the way the interpreter does: integers in
+ * decimal, reals like %g, values separated by single spaces.  Runtime
+ * errors are reported on stderr and stop the program with status 1.
+ */
+#include <errno.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+static void fail(int32_t line, const char *msg, const char *word)
+{
+	fflush(stdout);
+	if (word != NULL)
+		fprintf(stderr, "runtime error: \"%s\" is not a valid number on line #%d\n", word, line);
+	else
+		fprintf(stderr, "runtime error: %s on line #%d\n", msg, line);
+	exit(1);
+}
+
+/* next_word - read the next white space separated word of input */
+static char *next_word(int32_t line)
+{
+	static char word[256];
+	if (scanf("%255s", word) != 1)
+		fail(line, "no input left to read", NULL);
+	return word;
+}
+
+void japc_write_int(int32_t v)
+{
+	printf("%d", v);
+}
+
+void japc_write_real(double v)
+{
+	printf("%g", v);
+}
+
+int32_t japc_read_int(int32_t line)
+{
+	char *word = next_word(line), *end;
+	long v;
+
+	errno = 0;
+	v = strtol(word, &end, 10);
+	if (*end != '\0' || errno != 0 || v != (int32_t)v)
+		fail(line, NULL, word);
+	return (int32_t)v;
+}
+
+double japc_read_real(int32_t line)
+{
+	char *word = next_word(line), *end;
+	double v = strtod(word, &end);
+
+	if (*end != '\0')
+		fail(line, NULL, word);
+	return v;
+}
+
+void japc_divzero(int32_t line)
+{
+	fail(line, "division by zero", NULL);
+}
@@ -0,0 +1,87 @@
+/*
+ * japcrt.js - the host for programs compiled to WebAssembly by JAPC.
+ *
+ * runJapc(wasm, input) instantiates a compiled module (the binary made
+ * from the -wat output, e.g. with wat2wasm), runs its main program with
+ * the given input text and resolves to everything it wrote.  A runtime
+ * error rejects with an Error whose output property holds what was
+ * written before it.  Works in browsers and in Node.
+ */
+(function (root) {
+	"use strict";
+
+	function runtimeError(msg, line) {
+		return new Error("runtime error: " + msg + " on line #" + line);
+	}
+
+	function formatReal(v) {
+		// Six significant digits like C's %g
+		if (v === 0 || !isFinite(v))
+			return isNaN(v) ? "NaN" : v === 0 ? "0" : (v > 0 ? "+Inf" : "-Inf");
+		var exp = Math.floor(Math.log10(Math.abs(v)));
+		// toPrecision rounds halves up where %g rounds them to even
+		var scale = Math.pow(10, Math.abs(5 - exp));
+		var six = exp <= 5 ? Math.abs(v) * scale : Math.abs(v) / scale;
+		if (six % 1 === 0.5 && Math.floor(six) % 2 === 0) {
+			six = Math.floor(six);
+			v = (v < 0 ? -1 : 1) * (exp <= 5 ? six / scale : six * scale);
+		}
+		var digits = Number(v.toPrecision(6));
+		if (Math.abs(digits) >= Math.pow(10, exp + 1))
+			exp++;
+		if (exp < -4 || exp >= 6) {
+			var parts = digits.toExponential(5).split("e");
+			var mantissa = parts[0].replace(/\.?0+$/, "");
+			var e = Number(parts[1]);
+			return mantissa + "e" + (e < 0 ? "-" : "+") + (Math.abs(e) < 10 ? "0" : "") + Math.abs(e);
+		}
+		return String(digits);
+	}
+
+	function runJapc(wasm, input) {
+		var words = String(input || "").split(/\s+/).filter(function (w) { return w !== ""; });
+		var next = 0, output = "";
+
+		function word(line) {
+			if (next >= words.length)
+				throw runtimeError("no input left to read", line);
+			return words[next++];
+		}
+
+		var imports = {
+			japc: {
+				write_int: function (v) { output += String(v); },
+				write_real: function (v) { output += formatReal(v); },
+				write_char: function (c) { output += String.fromCharCode(c); },
+				read_int: function (line) {
+					var w = word(line);
+					if (!/^[-+]?\d+$/.test(w) || Number(w) !== (Number(w) | 0))
+						throw runtimeError(JSON.stringify(w) + " is not a valid number", line);
+					return Number(w);
+				},
+				read_real: function (line) {
+					var w = word(line);
+					if (!/^[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$/.test(w))
+						throw runtimeError(JSON.stringify(w) + " is not a valid number", line);
+					return Number(w);
+				},
+				divzero: function (line) { throw runtimeError("division by zero", line); }
+			}
+		};
+
+		return WebAssembly.instantiate(wasm, imports).then(function (result) {
+			try {
+				result.instance.exports.main();
+			} catch (err) {
+				err.output = output;
+				throw err;
+			}
+			return output;
+		});
+	}
+
+	if (typeof module !== "undefined" && module.exports)
+		module.exports = { runJapc: runJapc };
+	else
+		root.runJapc = runJapc;
+})(this);